@@ -10,13 +10,24 @@ import (
 	"os/exec"
 	"testing"
 
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/hanwen/go-fuse/v2/internal/testutil"
 	"golang.org/x/sync/errgroup"
 )
 
 func BenchmarkGoFuseRead(b *testing.B) {
-	fs := &readFS{}
-	wd, clean := setupFs(fs, b.N)
+	benchmarkGoFuseRead(b, fuse.ReadWrite)
+}
+
+func BenchmarkGoFuseReadIOUring(b *testing.B) {
+	benchmarkGoFuseRead(b, fuse.IOUring)
+}
+
+func benchmarkGoFuseRead(b *testing.B, transport fuse.Transport) {
+	opts := &fs.Options{}
+	opts.Transport = transport
+	wd, clean := setupFsOptions(&readFS{}, b.N, opts)
 	defer clean()
 
 	jobs := 32
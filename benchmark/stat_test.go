@@ -23,7 +23,10 @@ import (
 )
 
 func setupFs(node fs.InodeEmbedder, N int) (string, func()) {
-	opts := &fs.Options{}
+	return setupFsOptions(node, N, &fs.Options{})
+}
+
+func setupFsOptions(node fs.InodeEmbedder, N int, opts *fs.Options) (string, func()) {
 	opts.Debug = testutil.VerboseTest()
 	mountPoint := testutil.TempDir()
 	server, err := fs.Mount(mountPoint, node, opts)
@@ -0,0 +1,64 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// fusedump prints a recording of FUSE traffic (see
+// fuse.MountOptions.RecordTraffic, or the -record flag of
+// example/loopback). With -loopback, it replays the requests against
+// a loopback file system instead, and prints the replies that differ.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func main() {
+	loopback := flag.String("loopback", "", "replay against a loopback file system of this directory")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [-loopback DIR] RECORDING\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Open: %v", err)
+	}
+	recs, err := fuse.ReadRecording(f)
+	f.Close()
+	if err != nil {
+		// Print what we have, eg. if the server crashed
+		// while recording.
+		log.Printf("ReadRecording: %v", err)
+	}
+
+	if *loopback == "" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := fuse.DumpRecording(w, recs); err != nil {
+			log.Fatalf("DumpRecording: %v", err)
+		}
+		w.Flush()
+		return
+	}
+
+	root, err := fs.NewLoopbackRoot(*loopback)
+	if err != nil {
+		log.Fatalf("NewLoopbackRoot(%s): %v", *loopback, err)
+	}
+	diffs, err := fuse.Replay(recs, fs.NewNodeFS(root, &fs.Options{}), nil)
+	if err != nil {
+		log.Fatalf("Replay: %v", err)
+	}
+	for _, d := range diffs {
+		fmt.Println(d.String())
+	}
+	fmt.Printf("%d requests with different replies\n", len(diffs))
+}
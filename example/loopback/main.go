@@ -19,6 +19,8 @@ import (
 	"time"
 
 	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/introspect"
 )
 
 func writeMemProfile(fn string, sigs <-chan os.Signal) {
@@ -47,8 +49,13 @@ func main() {
 	other := flag.Bool("allow-other", false, "mount with -o allowother.")
 	quiet := flag.Bool("q", false, "quiet")
 	ro := flag.Bool("ro", false, "mount read-only")
+	passthrough := flag.Bool("passthrough", false, "let the kernel do file I/O directly on the original files (Linux 6.9+)")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to this file")
 	memprofile := flag.String("memprofile", "", "write memory profile to this file")
+	trace := flag.String("trace", "", "log requests that match this filter, eg. \"op=LOOKUP,GETATTR pid=123\"")
+	record := flag.String("record", "", "record FUSE traffic to this file, for example/fusedump")
+	introspectSock := flag.String("introspect", "", "serve the requests in flight on this Unix socket")
+	stuck := flag.Duration("stuck", 0, "log requests that take longer than this")
 	flag.Parse()
 	if flag.NArg() < 2 {
 		fmt.Printf("usage: %s MOUNTPOINT ORIGINAL\n", path.Base(os.Args[0]))
@@ -97,6 +104,7 @@ func main() {
 	}
 	opts.Debug = *debug
 	opts.AllowOther = *other
+	opts.EnablePassthrough = *passthrough
 	if opts.AllowOther {
 		// Make the kernel check file permissions for us
 		opts.MountOptions.Options = append(opts.MountOptions.Options, "default_permissions")
@@ -108,6 +116,22 @@ func main() {
 	opts.MountOptions.Options = append(opts.MountOptions.Options, "fsname="+orig)
 	// Second column in "df -T" will be shown as "fuse." + Name
 	opts.MountOptions.Name = "loopback"
+	if *trace != "" {
+		f, err := fuse.ParseTraceFilter(*trace, &fuse.LogTracer{})
+		if err != nil {
+			log.Fatalf("-trace: %v", err)
+		}
+		opts.MountOptions.Tracer = f
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatalf("os.Create: %v", err)
+		}
+		defer f.Close()
+		opts.MountOptions.RecordTraffic = f
+	}
+	opts.MountOptions.StuckRequestThreshold = *stuck
 	// Leave file permissions on "000" files as-is
 	opts.NullPermissions = true
 	// Enable diagnostics logging
@@ -118,6 +142,13 @@ func main() {
 	if err != nil {
 		log.Fatalf("Mount fail: %v\n", err)
 	}
+	if *introspectSock != "" {
+		l, err := introspect.ListenUnix(*introspectSock, server)
+		if err != nil {
+			log.Fatalf("ListenUnix: %v", err)
+		}
+		defer l.Close()
+	}
 	if !*quiet {
 		fmt.Println("Mounted!")
 	}
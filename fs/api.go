@@ -202,6 +202,14 @@ type NodeStatfser interface {
 	Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno
 }
 
+// Syncfs flushes the state of the entire file system to stable
+// storage, as requested by syncfs(2) or `sync -f`. It is only called
+// on the root node. If the root does not implement it, syncfs(2)
+// succeeds without further action.
+type NodeSyncfser interface {
+	Syncfs(ctx context.Context) syscall.Errno
+}
+
 // Access should return if the caller can access the file with the
 // given mode.  This is used for two purposes: to determine if a user
 // may enter a directory, and to answer to implement the access system
@@ -229,6 +237,16 @@ type NodeGetattrer interface {
 	Getattr(ctx context.Context, f FileHandle, out *fuse.AttrOut) syscall.Errno
 }
 
+// Statx is like Getattr, but for statx(2), which can also return
+// the birth time and file attributes. `mask` has the STATX_* fields
+// the caller asked for; out.Mask should say which fields were
+// actually filled in. If not defined, the result is taken from
+// Getattr. The mount ID cannot be passed on, as the protocol has no
+// field for it; statx(2) reports that of the FUSE mount.
+type NodeStatxer interface {
+	Statx(ctx context.Context, f FileHandle, flags uint32, mask uint32, out *fuse.StatxOut) syscall.Errno
+}
+
 // SetAttr sets attributes for an Inode.
 type NodeSetattrer interface {
 	Setattr(ctx context.Context, f FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno
@@ -340,6 +358,18 @@ type NodeLseeker interface {
 	Lseek(ctx context.Context, f FileHandle, Off uint64, whence uint32) (uint64, syscall.Errno)
 }
 
+// Poll reports which of the poll(2) `events` are ready for the
+// file, and returns them as `revents`. If `flags` has
+// fuse.FUSE_POLL_SCHEDULE_NOTIFY set, the caller wants to be woken
+// up once the readiness changes: the file system should then call
+// Inode.NotifyPoll with the poll handle `kh`. The default
+// implementation forwards to the FileHandle, or if the handle does
+// not support FilePoller, reports the file as always ready. Polling
+// must be enabled with fuse.MountOptions.EnablePoll.
+type NodePoller interface {
+	Poll(ctx context.Context, f FileHandle, kh uint64, flags uint32, events uint32) (revents uint32, errno syscall.Errno)
+}
+
 // Getlk returns locks that would conflict with the given input
 // lock. If no locks conflict, the output has type L_UNLCK. See
 // fcntl(2) for more information.
@@ -461,6 +491,14 @@ type NodeCreater interface {
 	Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (node *Inode, fh FileHandle, fuseFlags uint32, errno syscall.Errno)
 }
 
+// Tmpfile is similar to Create, but the new child has no name, as
+// for open(2) with O_TMPFILE. The returned Inode is not added to the
+// tree, but it can be given a name later through NodeLinker.
+// Default is to return ENOTSUP.
+type NodeTmpfiler interface {
+	Tmpfile(ctx context.Context, flags uint32, mode uint32, out *fuse.EntryOut) (node *Inode, fh FileHandle, fuseFlags uint32, errno syscall.Errno)
+}
+
 // Unlink should remove a child from this directory.  If the
 // return status is OK, the Inode is removed as child in the
 // FS tree automatically. Default is to return EROFS.
@@ -512,6 +550,16 @@ type FileGetattrer interface {
 	Getattr(ctx context.Context, out *fuse.AttrOut) syscall.Errno
 }
 
+// FilePassthroughFder is implemented by FileHandles that are backed
+// by a file descriptor. If the mount has
+// MountOptions.EnablePassthrough set, the kernel then reads and
+// writes the descriptor directly, and the FileReader and FileWriter
+// methods are not called. The fd must stay valid until the
+// FileHandle is released.
+type FilePassthroughFder interface {
+	PassthroughFd() (fd int, ok bool)
+}
+
 // See NodeReader.
 type FileReader interface {
 	Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno)
@@ -522,6 +570,13 @@ type FileWriter interface {
 	Write(ctx context.Context, data []byte, off int64) (written uint32, errno syscall.Errno)
 }
 
+// FilePipeWriter is a FileHandle that takes the data of a write
+// straight from a pipe (see fuse.MountOptions.EnableSpliceRead). If
+// it returns ENOSYS without consuming the data, FileWriter is used.
+type FilePipeWriter interface {
+	WritePipe(ctx context.Context, data *fuse.PipeData, off int64) (written uint32, errno syscall.Errno)
+}
+
 // See NodeGetlker.
 type FileGetlker interface {
 	Getlk(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) syscall.Errno
@@ -542,6 +597,11 @@ type FileLseeker interface {
 	Lseek(ctx context.Context, off uint64, whence uint32) (uint64, syscall.Errno)
 }
 
+// See NodePoller.
+type FilePoller interface {
+	Poll(ctx context.Context, kh uint64, flags uint32, events uint32) (revents uint32, errno syscall.Errno)
+}
+
 // See NodeFlusher.
 type FileFlusher interface {
 	Flush(ctx context.Context) syscall.Errno
@@ -605,6 +665,13 @@ type Options struct {
 	// functions for testing a filesystem without mounting it.
 	ServerCallbacks ServerCallbacks
 
+	// RestoreState, if set, has the node IDs and file handles
+	// that a previous process recorded with SaveState. After
+	// OnAdd, NewNodeFS looks up the nodes and reopens the files,
+	// so the kernel's references stay valid. This is not needed
+	// with fuse.Takeover, which passes the state along itself.
+	RestoreState *BridgeState
+
 	// Logger is a sink for diagnostic messages. Diagnostic
 	// messages are printed under conditions where we cannot
 	// return error, but want to signal something seems off
@@ -41,6 +41,12 @@ type fileEntry struct {
 	dirOffset uint64
 
 	wg sync.WaitGroup
+
+	// backingID is the kernel passthrough ID for the file, or 0.
+	backingID int32
+
+	// flags are the open flags, kept for SaveState.
+	flags uint32
 }
 
 // ServerCallbacks are calls into the kernel to manipulate the inode,
@@ -52,6 +58,9 @@ type ServerCallbacks interface {
 	InodeNotify(node uint64, off int64, length int64) fuse.Status
 	InodeRetrieveCache(node uint64, offset int64, dest []byte) (n int, st fuse.Status)
 	InodeNotifyStoreCache(node uint64, offset int64, data []byte) fuse.Status
+	PollNotify(kh uint64) fuse.Status
+	RegisterBackingFd(fd int) (int32, error)
+	CloseBackingFd(id int32) error
 }
 
 type rawBridge struct {
@@ -217,7 +226,11 @@ func (b *rawBridge) addNewChild(parent *Inode, name string, child *Inode, file F
 		fh = b.registerFile(child, file, fileFlags)
 	}
 
-	parent.setEntry(name, child)
+	// Unnamed children (from NodeTmpfiler) stay out of the tree
+	// until they are linked.
+	if name != "" {
+		parent.setEntry(name, child)
+	}
 
 	out.NodeId = child.nodeId
 	out.Generation = child.stableAttr.Gen
@@ -310,6 +323,9 @@ func NewNodeFS(root InodeEmbedder, opts *Options) fuse.RawFileSystem {
 		oa.OnAdd(context.Background())
 	}
 
+	if bridge.options.RestoreState != nil {
+		bridge.restoreState(bridge.options.RestoreState)
+	}
 	return bridge
 }
 
@@ -467,6 +483,31 @@ func (b *rawBridge) Create(cancel <-chan struct{}, input *fuse.CreateIn, name st
 
 	out.Fh = uint64(fh)
 	out.OpenFlags = flags
+	b.setBackingFd(child, fh, f, &out.OpenOut)
+
+	child.setEntryOut(&out.EntryOut)
+	b.setEntryOutTimeout(&out.EntryOut)
+	return fuse.OK
+}
+
+func (b *rawBridge) Tmpfile(cancel <-chan struct{}, input *fuse.CreateIn, out *fuse.CreateOut) fuse.Status {
+	ctx := &fuse.Context{Caller: input.Caller, Cancel: cancel}
+	parent, _ := b.inode(input.NodeId, 0)
+
+	mops, ok := parent.ops.(NodeTmpfiler)
+	if !ok {
+		return fuse.ENOTSUP
+	}
+	child, f, flags, errno := mops.Tmpfile(ctx, input.Flags, input.Mode, &out.EntryOut)
+	if errno != 0 {
+		return errnoToStatus(errno)
+	}
+
+	child, fh := b.addNewChild(parent, "", child, f, input.Flags|syscall.O_CREAT|syscall.O_EXCL, &out.EntryOut)
+
+	out.Fh = uint64(fh)
+	out.OpenFlags = flags
+	b.setBackingFd(child, fh, f, &out.OpenOut)
 
 	child.setEntryOut(&out.EntryOut)
 	b.setEntryOutTimeout(&out.EntryOut)
@@ -522,22 +563,77 @@ func (b *rawBridge) SetDebug(debug bool) {}
 
 func (b *rawBridge) GetAttr(cancel <-chan struct{}, input *fuse.GetAttrIn, out *fuse.AttrOut) fuse.Status {
 	n, fEntry := b.inode(input.NodeId, input.Fh())
-	f := fEntry.file
+	f, done := b.attrFile(n, fEntry)
+	defer done()
+	ctx := &fuse.Context{Caller: input.Caller, Cancel: cancel}
+	return errnoToStatus(b.getattr(ctx, n, f, out))
+}
+
+// attrFile returns the file to pass to Getattr or Statx. Call done
+// once the file is no longer used.
+func (b *rawBridge) attrFile(n *Inode, fEntry *fileEntry) (f FileHandle, done func()) {
+	f = fEntry.file
+	done = func() {}
 	if f == nil {
 		// The linux kernel doesnt pass along the file
 		// descriptor, so we have to fake it here.
 		// See https://github.com/libfuse/libfuse/issues/62
 		b.mu.Lock()
 		for _, fh := range n.openFiles {
-			f = b.files[fh].file
-			b.files[fh].wg.Add(1)
-			defer b.files[fh].wg.Done()
+			entry := b.files[fh]
+			f = entry.file
+			entry.wg.Add(1)
+			done = entry.wg.Done
 			break
 		}
 		b.mu.Unlock()
 	}
+	return f, done
+}
+
+func (b *rawBridge) Statx(cancel <-chan struct{}, input *fuse.StatxIn, out *fuse.StatxOut) fuse.Status {
+	var fh uint64
+	if input.GetattrFlags&fuse.FUSE_GETATTR_FH != 0 {
+		fh = input.Fh
+	}
+	n, fEntry := b.inode(input.NodeId, fh)
+	f, done := b.attrFile(n, fEntry)
+	defer done()
 	ctx := &fuse.Context{Caller: input.Caller, Cancel: cancel}
-	return errnoToStatus(b.getattr(ctx, n, f, out))
+
+	sops, ok := n.ops.(NodeStatxer)
+	if !ok {
+		attrOut := fuse.AttrOut{}
+		if errno := b.getattr(ctx, n, f, &attrOut); errno != 0 {
+			return errnoToStatus(errno)
+		}
+		out.AttrValid = attrOut.AttrValid
+		out.AttrValidNsec = attrOut.AttrValidNsec
+		out.Statx.FromAttr(&attrOut.Attr)
+		return fuse.OK
+	}
+
+	if errno := sops.Statx(ctx, f, input.SxFlags, input.SxMask, out); errno != 0 {
+		return errnoToStatus(errno)
+	}
+	out.Ino = n.stableAttr.Ino
+	out.Mode = (out.Mode & 07777) | uint16(n.stableAttr.Mode)
+	if !b.options.NullPermissions && out.Mode&07777 == 0 {
+		out.Mode |= 0644
+		if uint32(out.Mode)&syscall.S_IFDIR != 0 {
+			out.Mode |= 0111
+		}
+	}
+	if b.options.UID != 0 && out.Uid == 0 {
+		out.Uid = b.options.UID
+	}
+	if b.options.GID != 0 && out.Gid == 0 {
+		out.Gid = b.options.GID
+	}
+	if b.options.AttrTimeout != nil && out.Timeout() == 0 {
+		out.SetTimeout(*b.options.AttrTimeout)
+	}
+	return fuse.OK
 }
 
 func (b *rawBridge) getattr(ctx context.Context, n *Inode, f FileHandle, out *fuse.AttrOut) syscall.Errno {
@@ -726,18 +822,68 @@ func (b *rawBridge) Open(cancel <-chan struct{}, input *fuse.OpenIn, out *fuse.O
 			return errnoToStatus(errno)
 		}
 
+		out.OpenFlags = flags
 		if f != nil {
 			b.mu.Lock()
-			defer b.mu.Unlock()
-			out.Fh = uint64(b.registerFile(n, f, input.Flags))
+			fh := b.registerFile(n, f, input.Flags)
+			b.mu.Unlock()
+			out.Fh = uint64(fh)
+			b.setBackingFd(n, fh, f, out)
 		}
-		out.OpenFlags = flags
 		return fuse.OK
 	}
 
 	return fuse.ENOTSUP
 }
 
+// setBackingFd sets up kernel passthrough for f, if it implements
+// FilePassthroughFder and the mount allows it. Otherwise, I/O goes
+// through the bridge as usual. The kernel takes only one backing file
+// per inode while it is open, so the open files of n share the
+// backing ID of the first one.
+func (b *rawBridge) setBackingFd(n *Inode, fh uint32, f FileHandle, out *fuse.OpenOut) {
+	pf, ok := f.(FilePassthroughFder)
+	if !ok || b.server == nil {
+		return
+	}
+	fd, ok := pf.PassthroughFd()
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n.backingID == 0 {
+		id, err := b.server.RegisterBackingFd(fd)
+		if err != nil {
+			if err != syscall.ENOTSUP {
+				b.logf("RegisterBackingFd: %v", err)
+			}
+			return
+		}
+		n.backingID = id
+	}
+	n.backingRefs++
+	b.files[fh].backingID = n.backingID
+	out.OpenFlags |= fuse.FOPEN_PASSTHROUGH
+	out.BackingId = n.backingID
+}
+
+// releaseBackingFd drops the reference of a released file to the
+// backing ID of n, and closes it with the last one.
+func (b *rawBridge) releaseBackingFd(n *Inode) {
+	b.mu.Lock()
+	n.backingRefs--
+	if n.backingRefs > 0 {
+		b.mu.Unlock()
+		return
+	}
+	id := n.backingID
+	n.backingID = 0
+	b.mu.Unlock()
+	b.server.CloseBackingFd(id)
+}
+
 // registerFile hands out a file handle. Must have bridge.mu
 func (b *rawBridge) registerFile(n *Inode, f FileHandle, flags uint32) uint32 {
 	var fh uint32
@@ -750,12 +896,19 @@ func (b *rawBridge) registerFile(n *Inode, f FileHandle, flags uint32) uint32 {
 		b.files = append(b.files, &fileEntry{})
 	}
 
+	b.attachFile(n, fh, f, flags)
+	return fh
+}
+
+// attachFile fills the file entry fh and adds it to n. Must have
+// bridge.mu
+func (b *rawBridge) attachFile(n *Inode, fh uint32, f FileHandle, flags uint32) {
 	fileEntry := b.files[fh]
 	fileEntry.nodeIndex = len(n.openFiles)
 	fileEntry.file = f
+	fileEntry.flags = flags
 
 	n.openFiles = append(n.openFiles, fh)
-	return fh
 }
 
 func (b *rawBridge) Read(cancel <-chan struct{}, input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
@@ -814,6 +967,11 @@ func (b *rawBridge) Release(cancel <-chan struct{}, input *fuse.ReleaseIn) {
 
 	f.wg.Wait()
 
+	if f.backingID != 0 {
+		b.releaseBackingFd(n)
+		f.backingID = 0
+	}
+
 	if r, ok := n.ops.(NodeReleaser); ok {
 		r.Release(&fuse.Context{Caller: input.Caller, Cancel: cancel}, f.file)
 	} else if r, ok := f.file.(FileReleaser); ok {
@@ -875,6 +1033,21 @@ func (b *rawBridge) Write(cancel <-chan struct{}, input *fuse.WriteIn, data []by
 	return 0, fuse.ENOTSUP
 }
 
+func (b *rawBridge) WritePipe(cancel <-chan struct{}, input *fuse.WriteIn, data *fuse.PipeData) (written uint32, status fuse.Status) {
+	n, f := b.inode(input.NodeId, input.Fh)
+
+	// NodeWriter takes precedence over the file handle, so let
+	// it have the data through Write.
+	if _, ok := n.ops.(NodeWriter); ok {
+		return 0, fuse.ENOSYS
+	}
+	if fw, ok := f.file.(FilePipeWriter); ok {
+		w, errno := fw.WritePipe(&fuse.Context{Caller: input.Caller, Cancel: cancel}, data, int64(input.Offset))
+		return w, errnoToStatus(errno)
+	}
+	return 0, fuse.ENOSYS
+}
+
 func (b *rawBridge) Flush(cancel <-chan struct{}, input *fuse.FlushIn) fuse.Status {
 	n, f := b.inode(input.NodeId, input.Fh)
 	if fl, ok := n.ops.(NodeFlusher); ok {
@@ -1103,6 +1276,13 @@ func (b *rawBridge) StatFs(cancel <-chan struct{}, input *fuse.InHeader, out *fu
 	return fuse.OK
 }
 
+func (b *rawBridge) SyncFs(cancel <-chan struct{}, input *fuse.SyncFsIn) fuse.Status {
+	if sf, ok := b.root.ops.(NodeSyncfser); ok {
+		return errnoToStatus(sf.Syncfs(&fuse.Context{Caller: input.Caller, Cancel: cancel}))
+	}
+	return fuse.ENOSYS
+}
+
 func (b *rawBridge) Init(s *fuse.Server) {
 	b.server = s
 }
@@ -1148,3 +1328,27 @@ func (b *rawBridge) Lseek(cancel <-chan struct{}, in *fuse.LseekIn, out *fuse.Ls
 func (fs *rawBridge) Ioctl(cancel <-chan struct{}, in *fuse.IoctlIn, out *fuse.IoctlOut, bufIn, bufOut []byte) fuse.Status {
 	return fuse.ENOSYS
 }
+
+// defaultPollMask is what the kernel assumes for files that don't
+// support polling.
+const defaultPollMask = fuse.POLLIN | fuse.POLLOUT | fuse.POLLRDNORM | fuse.POLLWRNORM
+
+func (b *rawBridge) Poll(cancel <-chan struct{}, in *fuse.PollIn, out *fuse.PollOut) fuse.Status {
+	n, f := b.inode(in.NodeId, in.Fh)
+
+	if p, ok := n.ops.(NodePoller); ok {
+		revents, errno := p.Poll(&fuse.Context{Caller: in.Caller, Cancel: cancel}, f.file, in.Kh, in.Flags, in.Events)
+		out.Revents = revents
+		return errnoToStatus(errno)
+	}
+	if p, ok := f.file.(FilePoller); ok {
+		revents, errno := p.Poll(&fuse.Context{Caller: in.Caller, Cancel: cancel}, in.Kh, in.Flags, in.Events)
+		out.Revents = revents
+		return errnoToStatus(errno)
+	}
+
+	// Don't return ENOSYS: the kernel would stop sending POLL for
+	// all files in the mount.
+	out.Revents = defaultPollMask
+	return fuse.OK
+}
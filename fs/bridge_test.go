@@ -201,3 +201,52 @@ func (n *testDeletedIno) Getattr(ctx context.Context, f FileHandle, out *fuse.At
 	// Otherwise EILSEQ
 	return syscall.EILSEQ
 }
+
+type syncfsRoot struct {
+	Inode
+
+	calls int32
+}
+
+func (r *syncfsRoot) Syncfs(ctx context.Context) syscall.Errno {
+	atomic.AddInt32(&r.calls, 1)
+	return OK
+}
+
+func TestBridgeSyncfs(t *testing.T) {
+	in := fuse.SyncFsIn{}
+	in.NodeId = 1
+
+	root := &syncfsRoot{}
+	rb := NewNodeFS(root, &Options{}).(*rawBridge)
+	if code := rb.SyncFs(nil, &in); !code.Ok() {
+		t.Errorf("SyncFs: %v", code)
+	}
+	if got := atomic.LoadInt32(&root.calls); got != 1 {
+		t.Errorf("got %d Syncfs calls, want 1", got)
+	}
+
+	// Without NodeSyncfser, the kernel should stop asking.
+	rb = NewNodeFS(&Inode{}, &Options{}).(*rawBridge)
+	if code := rb.SyncFs(nil, &in); code != fuse.ENOSYS {
+		t.Errorf("SyncFs: got %v, want ENOSYS", code)
+	}
+}
+
+func TestBridgeStatxFallback(t *testing.T) {
+	root := &Inode{}
+	rb := NewNodeFS(root, &Options{}).(*rawBridge)
+
+	in := fuse.StatxIn{}
+	in.NodeId = 1
+	out := fuse.StatxOut{}
+	if code := rb.Statx(nil, &in, &out); !code.Ok() {
+		t.Fatalf("Statx: %v", code)
+	}
+	if out.Mask == 0 {
+		t.Errorf("got empty mask")
+	}
+	if out.Mode != syscall.S_IFDIR|0755 {
+		t.Errorf("got mode %o, want %o", out.Mode, syscall.S_IFDIR|0755)
+	}
+}
@@ -34,10 +34,12 @@ var _ = (FileReleaser)((*loopbackFile)(nil))
 var _ = (FileGetattrer)((*loopbackFile)(nil))
 var _ = (FileReader)((*loopbackFile)(nil))
 var _ = (FileWriter)((*loopbackFile)(nil))
+var _ = (FilePipeWriter)((*loopbackFile)(nil))
 var _ = (FileGetlker)((*loopbackFile)(nil))
 var _ = (FileSetlker)((*loopbackFile)(nil))
 var _ = (FileSetlkwer)((*loopbackFile)(nil))
 var _ = (FileLseeker)((*loopbackFile)(nil))
+var _ = (FilePassthroughFder)((*loopbackFile)(nil))
 var _ = (FileFlusher)((*loopbackFile)(nil))
 var _ = (FileFsyncer)((*loopbackFile)(nil))
 var _ = (FileSetattrer)((*loopbackFile)(nil))
@@ -57,6 +59,18 @@ func (f *loopbackFile) Write(ctx context.Context, data []byte, off int64) (uint3
 	return uint32(n), ToErrno(err)
 }
 
+func (f *loopbackFile) WritePipe(ctx context.Context, data *fuse.PipeData, off int64) (uint32, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := data.SpliceTo(uintptr(f.fd), off)
+	if n == 0 && ToErrno(err) == syscall.EINVAL {
+		// Eg. files opened with O_APPEND; Write copies the
+		// data instead.
+		return 0, syscall.ENOSYS
+	}
+	return uint32(n), ToErrno(err)
+}
+
 func (f *loopbackFile) Release(ctx context.Context) syscall.Errno {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -68,6 +82,12 @@ func (f *loopbackFile) Release(ctx context.Context) syscall.Errno {
 	return syscall.EBADF
 }
 
+func (f *loopbackFile) PassthroughFd() (int, bool) {
+	// The fd only changes in Release, after which the kernel
+	// does not use it anymore.
+	return f.fd, true
+}
+
 func (f *loopbackFile) Flush(ctx context.Context) syscall.Errno {
 	f.mu.Lock()
 	defer f.mu.Unlock()
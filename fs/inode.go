@@ -69,6 +69,12 @@ type Inode struct {
 	// protected by bridge.mu
 	openFiles []uint32
 
+	// backingID is the kernel passthrough ID that the open files
+	// share, and backingRefs the number of files using it.
+	// protected by bridge.mu
+	backingID   int32
+	backingRefs int
+
 	// mu protects the following mutable fields. When locking
 	// multiple Inodes, locks must be acquired using
 	// lockNodes/unlockNodes
@@ -392,7 +398,9 @@ func (n *Inode) removeRef(nlookup uint64, dropPersistence bool) (forgotten bool,
 		forgotten = true
 		// Dropping the node from stableAttrs guarantees that no new references to this node are
 		// handed out to the kernel, hence we can also safely delete it from kernelNodeIds.
-		delete(n.bridge.stableAttrs, n.stableAttr)
+		if n.bridge.stableAttrs[n.stableAttr] == n {
+			delete(n.bridge.stableAttrs, n.stableAttr)
+		}
 		delete(n.bridge.kernelNodeIds, n.nodeId)
 	}
 	n.bridge.mu.Unlock()
@@ -523,6 +531,25 @@ func (n *Inode) Parent() (string, *Inode) {
 	return p.name, p.parent
 }
 
+// hasParent returns true if this Inode has a name in the tree.
+func (n *Inode) hasParent() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.parents.get() != nil
+}
+
+// openFileHandles returns the FileHandles that are currently open on
+// this Inode.
+func (n *Inode) openFileHandles() []FileHandle {
+	n.bridge.mu.Lock()
+	defer n.bridge.mu.Unlock()
+	var r []FileHandle
+	for _, fh := range n.openFiles {
+		r = append(r, n.bridge.files[fh].file)
+	}
+	return r
+}
+
 // RmAllChildren recursively drops a tree, forgetting all persistent
 // nodes.
 func (n *Inode) RmAllChildren() {
@@ -738,6 +765,12 @@ func (n *Inode) NotifyContent(off, sz int64) syscall.Errno {
 	return syscall.Errno(n.bridge.server.InodeNotify(n.nodeId, off, sz))
 }
 
+// NotifyPoll wakes up processes polling a file of this file system,
+// using the poll handle that was passed to NodePoller.Poll.
+func (n *Inode) NotifyPoll(kh uint64) syscall.Errno {
+	return syscall.Errno(n.bridge.server.PollNotify(kh))
+}
+
 // WriteCache stores data in the kernel cache.
 func (n *Inode) WriteCache(offset int64, data []byte) syscall.Errno {
 	return syscall.Errno(n.bridge.server.InodeNotifyStoreCache(n.nodeId, offset, data))
@@ -125,14 +125,24 @@ func (n *LoopbackNode) Lookup(ctx context.Context, name string, out *fuse.EntryO
 // preserveOwner sets uid and gid of `path` according to the caller information
 // in `ctx`.
 func (n *LoopbackNode) preserveOwner(ctx context.Context, path string) error {
-	if os.Getuid() != 0 {
+	uid, gid, ok := callerOwner(ctx)
+	if !ok {
 		return nil
 	}
+	return syscall.Lchown(path, uid, gid)
+}
+
+// callerOwner returns the uid and gid of the caller in `ctx`, which
+// new files should get. It returns false if we cannot change owners.
+func callerOwner(ctx context.Context) (uid, gid int, ok bool) {
+	if os.Getuid() != 0 {
+		return 0, 0, false
+	}
 	caller, ok := fuse.FromContext(ctx)
 	if !ok {
-		return nil
+		return 0, 0, false
 	}
-	return syscall.Lchown(path, int(caller.Uid), int(caller.Gid))
+	return int(caller.Uid), int(caller.Gid), true
 }
 
 func (n *LoopbackNode) Mknod(ctx context.Context, name string, mode, rdev uint32, out *fuse.EntryOut) (*Inode, syscall.Errno) {
@@ -247,7 +257,14 @@ func (n *LoopbackNode) Symlink(ctx context.Context, target, name string, out *fu
 func (n *LoopbackNode) Link(ctx context.Context, target InodeEmbedder, name string, out *fuse.EntryOut) (*Inode, syscall.Errno) {
 
 	p := filepath.Join(n.path(), name)
-	err := syscall.Link(filepath.Join(n.RootData.Path, target.EmbeddedInode().Path(nil)), p)
+	var err error
+	if ti := target.EmbeddedInode(); !ti.IsRoot() && !ti.hasParent() {
+		// Unnamed files (see Tmpfile) can only be reached
+		// through their open file descriptor.
+		err = n.linkUnnamed(ti, p)
+	} else {
+		err = syscall.Link(filepath.Join(n.RootData.Path, ti.Path(nil)), p)
+	}
 	if err != nil {
 		return nil, ToErrno(err)
 	}
@@ -36,6 +36,10 @@ func (n *LoopbackNode) renameExchange(name string, newparent InodeEmbedder, newN
 	return syscall.ENOSYS
 }
 
+func (n *LoopbackNode) linkUnnamed(target *Inode, p string) error {
+	return syscall.ENOENT
+}
+
 func (f *loopbackFile) Allocate(ctx context.Context, off uint64, sz uint64, mode uint32) syscall.Errno {
 	// TODO: Handle `mode` parameter.
 
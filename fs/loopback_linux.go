@@ -8,9 +8,11 @@ package fs
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
 	"syscall"
 
+	"github.com/hanwen/go-fuse/v2/fuse"
 	"golang.org/x/sys/unix"
 )
 
@@ -34,6 +36,84 @@ func (n *LoopbackNode) Listxattr(ctx context.Context, dest []byte) (uint32, sysc
 	return uint32(sz), ToErrno(err)
 }
 
+var _ = (NodeSyncfser)((*LoopbackNode)(nil))
+
+func (n *LoopbackNode) Syncfs(ctx context.Context) syscall.Errno {
+	fd, err := syscall.Open(n.RootData.Path, syscall.O_DIRECTORY|syscall.O_RDONLY, 0)
+	if err != nil {
+		return ToErrno(err)
+	}
+	defer syscall.Close(fd)
+	return ToErrno(unix.Syncfs(fd))
+}
+
+var _ = (NodeTmpfiler)((*LoopbackNode)(nil))
+
+func (n *LoopbackNode) Tmpfile(ctx context.Context, flags uint32, mode uint32, out *fuse.EntryOut) (inode *Inode, fh FileHandle, fuseFlags uint32, errno syscall.Errno) {
+	flags = flags &^ (syscall.O_APPEND | syscall.O_CREAT)
+	fd, err := syscall.Open(n.path(), int(flags)|unix.O_TMPFILE, mode)
+	if err != nil {
+		return nil, nil, 0, ToErrno(err)
+	}
+	// The file has no name yet, so preserveOwner cannot be used.
+	if uid, gid, ok := callerOwner(ctx); ok {
+		if err := syscall.Fchown(fd, uid, gid); err != nil {
+			syscall.Close(fd)
+			return nil, nil, 0, ToErrno(err)
+		}
+	}
+	st := syscall.Stat_t{}
+	if err := syscall.Fstat(fd, &st); err != nil {
+		syscall.Close(fd)
+		return nil, nil, 0, ToErrno(err)
+	}
+
+	node := n.RootData.newNode(n.EmbeddedInode(), "", &st)
+	ch := n.NewInode(ctx, node, n.RootData.idFromStat(&st))
+	lf := NewLoopbackFile(fd)
+
+	out.FromStat(&st)
+	return ch, lf, 0, 0
+}
+
+// linkUnnamed links a file created by Tmpfile to p, using one of
+// its open file descriptors.
+func (n *LoopbackNode) linkUnnamed(target *Inode, p string) error {
+	for _, f := range target.openFileHandles() {
+		lf, ok := f.(*loopbackFile)
+		if !ok {
+			continue
+		}
+		lf.mu.Lock()
+		defer lf.mu.Unlock()
+		return unix.Linkat(unix.AT_FDCWD, fmt.Sprintf("/proc/self/fd/%d", lf.fd),
+			unix.AT_FDCWD, p, unix.AT_SYMLINK_FOLLOW)
+	}
+	return syscall.ENOENT
+}
+
+var _ = (NodeStatxer)((*LoopbackNode)(nil))
+
+func (n *LoopbackNode) Statx(ctx context.Context, f FileHandle, flags uint32, mask uint32, out *fuse.StatxOut) syscall.Errno {
+	var st unix.Statx_t
+	var err error
+	if lf, ok := f.(*loopbackFile); ok {
+		lf.mu.Lock()
+		err = unix.Statx(lf.fd, "", int(flags)|unix.AT_EMPTY_PATH, int(mask), &st)
+		lf.mu.Unlock()
+	} else {
+		if &n.Inode != n.Root() {
+			flags |= unix.AT_SYMLINK_NOFOLLOW
+		}
+		err = unix.Statx(unix.AT_FDCWD, n.path(), int(flags), int(mask), &st)
+	}
+	if err != nil {
+		return ToErrno(err)
+	}
+	out.FromStatx(&st)
+	return OK
+}
+
 func (n *LoopbackNode) renameExchange(name string, newparent InodeEmbedder, newName string) syscall.Errno {
 	fd1, err := syscall.Open(n.path(), syscall.O_DIRECTORY, 0)
 	if err != nil {
@@ -6,6 +6,7 @@ package fs
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -248,6 +249,87 @@ func TestCopyFileRange(t *testing.T) {
 
 }
 
+func TestTmpfile(t *testing.T) {
+	tc := newTestCase(t, &testOptions{attrCache: true, entryCache: true})
+	defer tc.Clean()
+
+	if !tc.server.KernelSettings().SupportsVersion(7, 37) {
+		t.Skip("need v7.37 for TMPFILE")
+	}
+
+	fd, err := syscall.Open(tc.mntDir, unix.O_TMPFILE|syscall.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Open(O_TMPFILE): %v", err)
+	}
+	defer syscall.Close(fd)
+
+	if _, err := syscall.Write(fd, []byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := os.Lstat(tc.origDir + "/file"); !os.IsNotExist(err) {
+		t.Fatalf("Lstat before link: %v", err)
+	}
+
+	src := fmt.Sprintf("/proc/self/fd/%d", fd)
+	if err := unix.Linkat(unix.AT_FDCWD, src, unix.AT_FDCWD, tc.mntDir+"/file", unix.AT_SYMLINK_FOLLOW); err != nil {
+		t.Fatalf("Linkat: %v", err)
+	}
+
+	for _, dir := range []string{tc.origDir, tc.mntDir} {
+		if c, err := ioutil.ReadFile(dir + "/file"); err != nil {
+			t.Errorf("ReadFile: %v", err)
+		} else if string(c) != "hello" {
+			t.Errorf("got %q, want %q", c, "hello")
+		}
+	}
+}
+
+func TestStatx(t *testing.T) {
+	tc := newTestCase(t, &testOptions{})
+	defer tc.Clean()
+
+	if !tc.server.KernelSettings().SupportsVersion(7, 39) {
+		t.Skip("need v7.39 for STATX")
+	}
+
+	tc.writeOrig("file", "hello", 0644)
+
+	var want unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, tc.origDir+"/file", 0, unix.STATX_BTIME, &want); err != nil {
+		t.Fatalf("Statx orig: %v", err)
+	}
+	if want.Mask&unix.STATX_BTIME == 0 {
+		t.Skip("backing file system has no birth time")
+	}
+
+	var got unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, tc.mntDir+"/file", 0, unix.STATX_BTIME, &got); err != nil {
+		t.Fatalf("Statx mnt: %v", err)
+	}
+	if got.Mask&unix.STATX_BTIME == 0 {
+		t.Fatalf("got mask %x, want STATX_BTIME", got.Mask)
+	}
+	if got.Btime != want.Btime {
+		t.Errorf("got btime %v, want %v", got.Btime, want.Btime)
+	}
+	if got.Size != 5 {
+		t.Errorf("got size %d, want 5", got.Size)
+	}
+}
+
+func TestLoopbackSyncfs(t *testing.T) {
+	tc := newTestCase(t, &testOptions{})
+	defer tc.Clean()
+
+	// Only virtiofs mounts get SYNCFS from the kernel, so call
+	// the bridge directly.
+	in := fuse.SyncFsIn{}
+	in.NodeId = 1
+	if code := tc.rawFS.SyncFs(nil, &in); !code.Ok() {
+		t.Errorf("SyncFs: %v", code)
+	}
+}
+
 // Wait for a change in /proc/self/mounts. Efficient through the use of
 // unix.Poll().
 func waitProcMountsChange() error {
@@ -0,0 +1,140 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// passthroughNode serves "wrong" from the bridge, so reads only see
+// the backing file if they bypass the daemon.
+type passthroughNode struct {
+	Inode
+
+	path  string
+	reads int32
+}
+
+var _ = (NodeOpener)((*passthroughNode)(nil))
+var _ = (NodeGetattrer)((*passthroughNode)(nil))
+var _ = (NodeReader)((*passthroughNode)(nil))
+
+func (n *passthroughNode) Open(ctx context.Context, flags uint32) (FileHandle, uint32, syscall.Errno) {
+	fd, err := syscall.Open(n.path, int(flags), 0)
+	if err != nil {
+		return nil, 0, ToErrno(err)
+	}
+	return NewLoopbackFile(fd), 0, OK
+}
+
+func (n *passthroughNode) Getattr(ctx context.Context, f FileHandle, out *fuse.AttrOut) syscall.Errno {
+	st := syscall.Stat_t{}
+	if err := syscall.Stat(n.path, &st); err != nil {
+		return ToErrno(err)
+	}
+	out.FromStat(&st)
+	return OK
+}
+
+func (n *passthroughNode) Read(ctx context.Context, f FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	atomic.AddInt32(&n.reads, 1)
+	return fuse.ReadResultData([]byte("wrong")), OK
+}
+
+// mountPassthrough mounts a file system with passthrough enabled,
+// whose "file" is served by node.
+func mountPassthrough(t *testing.T) (mntDir string, node *passthroughNode, clean func()) {
+	backing := filepath.Join(testutil.TempDir(), "file")
+	if err := ioutil.WriteFile(backing, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	node = &passthroughNode{path: backing}
+	root := &Inode{}
+	mntDir, server, cleanMount := testMount(t, root, &Options{
+		MountOptions: fuse.MountOptions{
+			EnablePassthrough: true,
+		},
+		OnAdd: func(ctx context.Context) {
+			ch := root.NewPersistentInode(ctx, node, StableAttr{})
+			root.AddChild("file", ch, false)
+		},
+	})
+	clean = func() {
+		cleanMount()
+		os.RemoveAll(filepath.Dir(backing))
+	}
+
+	if server.NegotiatedCapabilities()&fuse.CAP_PASSTHROUGH == 0 {
+		clean()
+		t.Skip("kernel does not support passthrough")
+	}
+	return mntDir, node, clean
+}
+
+func TestPassthrough(t *testing.T) {
+	mntDir, node, clean := mountPassthrough(t)
+	defer clean()
+
+	content, err := ioutil.ReadFile(mntDir + "/file")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("got %q, want %q", content, "hello")
+	}
+	if got := atomic.LoadInt32(&node.reads); got != 0 {
+		t.Errorf("got %d READ calls, want 0", got)
+	}
+}
+
+// TestPassthroughOpenTwice checks that a file can be opened again
+// while it is open, as the kernel refuses a second backing file for
+// the inode.
+func TestPassthroughOpenTwice(t *testing.T) {
+	mntDir, node, clean := mountPassthrough(t)
+	defer clean()
+
+	f1, err := os.Open(mntDir + "/file")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f1.Close()
+	f2, err := os.OpenFile(mntDir+"/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("second Open: %v", err)
+	}
+	for _, f := range []*os.File{f1, f2} {
+		buf := make([]byte, 5)
+		if n, err := f.ReadAt(buf, 0); err != nil || string(buf[:n]) != "hello" {
+			t.Errorf("ReadAt: %q, %v", buf[:n], err)
+		}
+	}
+	f2.Close()
+
+	// The backing ID stays valid until the last file is closed.
+	buf := make([]byte, 5)
+	if n, err := f1.ReadAt(buf, 0); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("ReadAt after closing the other file: %q, %v", buf[:n], err)
+	}
+	f1.Close()
+
+	// After both are closed, the file can be opened again.
+	if content, err := ioutil.ReadFile(mntDir + "/file"); err != nil || string(content) != "hello" {
+		t.Errorf("ReadFile: %q, %v", content, err)
+	}
+	if got := atomic.LoadInt32(&node.reads); got != 0 {
+		t.Errorf("got %d READ calls, want 0", got)
+	}
+}
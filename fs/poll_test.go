@@ -0,0 +1,96 @@
+// Copyright 2019 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"golang.org/x/sys/unix"
+)
+
+type pollNode struct {
+	Inode
+
+	mu    sync.Mutex
+	ready bool
+	kh    uint64
+	khSet chan struct{}
+}
+
+var _ = (NodeOpener)((*pollNode)(nil))
+var _ = (NodePoller)((*pollNode)(nil))
+
+func (n *pollNode) Open(ctx context.Context, flags uint32) (FileHandle, uint32, syscall.Errno) {
+	return nil, fuse.FOPEN_DIRECT_IO, OK
+}
+
+func (n *pollNode) Poll(ctx context.Context, f FileHandle, kh uint64, flags uint32, events uint32) (uint32, syscall.Errno) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ready {
+		return fuse.POLLIN, OK
+	}
+	if flags&fuse.FUSE_POLL_SCHEDULE_NOTIFY != 0 && n.kh == 0 {
+		n.kh = kh
+		close(n.khSet)
+	}
+	return 0, OK
+}
+
+func TestPoll(t *testing.T) {
+	node := &pollNode{khSet: make(chan struct{})}
+	root := &Inode{}
+	mntDir, _, clean := testMount(t, root, &Options{
+		MountOptions: fuse.MountOptions{
+			EnablePoll: true,
+		},
+		OnAdd: func(ctx context.Context) {
+			ch := root.NewPersistentInode(ctx, node, StableAttr{})
+			root.AddChild("events", ch, false)
+		},
+	})
+	defer clean()
+
+	fd, err := syscall.Open(mntDir+"/events", syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	done := make(chan error, 1)
+	var fds []unix.PollFd
+	go func() {
+		fds = []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		_, err := unix.Poll(fds, 5000)
+		done <- err
+	}()
+
+	select {
+	case <-node.khSet:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for POLL with FUSE_POLL_SCHEDULE_NOTIFY")
+	}
+
+	node.mu.Lock()
+	node.ready = true
+	kh := node.kh
+	node.mu.Unlock()
+
+	if errno := node.NotifyPoll(kh); errno != 0 {
+		t.Fatalf("NotifyPoll: %v", errno)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if fds[0].Revents&unix.POLLIN == 0 {
+		t.Errorf("got revents %x, want POLLIN", fds[0].Revents)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// blocksFile serves its content out of fixed-size blocks, through
+// one of the ReadResult implementations.
+type blocksFile struct {
+	Inode
+
+	blocks [][]byte
+	result func(blocks [][]byte) fuse.ReadResult
+}
+
+var _ = (NodeOpener)((*blocksFile)(nil))
+var _ = (NodeReader)((*blocksFile)(nil))
+var _ = (NodeGetattrer)((*blocksFile)(nil))
+
+func (f *blocksFile) size() int {
+	n := 0
+	for _, b := range f.blocks {
+		n += len(b)
+	}
+	return n
+}
+
+func (f *blocksFile) Open(ctx context.Context, flags uint32) (FileHandle, uint32, syscall.Errno) {
+	return nil, fuse.FOPEN_DIRECT_IO, OK
+}
+
+func (f *blocksFile) Getattr(ctx context.Context, fh FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0444
+	out.Size = uint64(f.size())
+	return OK
+}
+
+func (f *blocksFile) Read(ctx context.Context, fh FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	// Select the parts of the blocks in [off, off+len(dest)).
+	var sel [][]byte
+	end := off + int64(len(dest))
+	var start int64
+	for _, b := range f.blocks {
+		bEnd := start + int64(len(b))
+		if bEnd > off && start < end {
+			lo, hi := int64(0), int64(len(b))
+			if off > start {
+				lo = off - start
+			}
+			if end < bEnd {
+				hi = end - start
+			}
+			sel = append(sel, b[lo:hi])
+		}
+		start = bEnd
+	}
+	return f.result(sel), OK
+}
+
+func TestReadResults(t *testing.T) {
+	pageSize := os.Getpagesize()
+	mem, err := syscall.Mmap(-1, 0, 4*pageSize, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		t.Fatalf("Mmap: %v", err)
+	}
+	defer syscall.Munmap(mem)
+	for i := range mem {
+		mem[i] = byte('a' + i%26)
+	}
+	pages := [][]byte{mem[:2*pageSize], mem[2*pageSize:]}
+	small := [][]byte{[]byte("hello, "), []byte("world"), nil, []byte("!")}
+
+	files := map[string]*blocksFile{
+		"vec":   {blocks: small, result: fuse.ReadResultVec},
+		"pages": {blocks: pages, result: fuse.ReadResultPages},
+		"func": {blocks: pages, result: func(blocks [][]byte) fuse.ReadResult {
+			var sz int
+			for _, b := range blocks {
+				sz += len(b)
+			}
+			return fuse.ReadResultFunc(sz, func(dest []byte) (int, fuse.Status) {
+				n := 0
+				for _, b := range blocks {
+					n += copy(dest[n:], b)
+				}
+				return n, fuse.OK
+			})
+		}},
+		"funcerr": {blocks: small, result: func(blocks [][]byte) fuse.ReadResult {
+			return fuse.ReadResultFunc(10, func(dest []byte) (int, fuse.Status) {
+				return 0, fuse.EIO
+			})
+		}},
+		"funcbad": {blocks: small, result: func(blocks [][]byte) fuse.ReadResult {
+			return fuse.ReadResultFunc(10, func(dest []byte) (int, fuse.Status) {
+				return len(dest) + 1, fuse.OK
+			})
+		}},
+	}
+
+	root := &Inode{}
+	mntDir, _, clean := testMount(t, root, &Options{
+		OnAdd: func(ctx context.Context) {
+			for name, f := range files {
+				root.AddChild(name, root.NewPersistentInode(ctx, f, StableAttr{}), false)
+			}
+		},
+	})
+	defer clean()
+
+	for name, f := range files {
+		if name == "funcerr" || name == "funcbad" {
+			continue
+		}
+		got, err := ioutil.ReadFile(mntDir + "/" + name)
+		if err != nil {
+			t.Errorf("ReadFile(%s): %v", name, err)
+			continue
+		}
+		if want := bytes.Join(f.blocks, nil); !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes %.20q, want %d bytes %.20q", name, len(got), got, len(want), want)
+		}
+	}
+
+	// A partial read in the middle of the blocks.
+	fd, err := os.Open(mntDir + "/pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	buf := make([]byte, pageSize)
+	off := int64(pageSize + pageSize/2)
+	if _, err := fd.ReadAt(buf, off); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if want := mem[off : off+int64(pageSize)]; !bytes.Equal(buf, want) {
+		t.Errorf("ReadAt: got %.20q, want %.20q", buf, want)
+	}
+
+	for _, name := range []string{"funcerr", "funcbad"} {
+		_, err = ioutil.ReadFile(mntDir + "/" + name)
+		if pe, ok := err.(*os.PathError); !ok || pe.Err != syscall.EIO {
+			t.Errorf("ReadFile(%s): got %v, want EIO", name, err)
+		}
+	}
+}
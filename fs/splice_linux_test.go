@@ -0,0 +1,142 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// spliceNode opens a backing file. If pipes is set, its file handles
+// take data from pipes.
+type spliceNode struct {
+	Inode
+
+	path    string
+	pipes   bool
+	spliced int32
+	copied  int32
+}
+
+var _ = (NodeOpener)((*spliceNode)(nil))
+var _ = (NodeGetattrer)((*spliceNode)(nil))
+
+func (n *spliceNode) Open(ctx context.Context, flags uint32) (FileHandle, uint32, syscall.Errno) {
+	fd, err := syscall.Open(n.path, int(flags), 0)
+	if err != nil {
+		return nil, 0, ToErrno(err)
+	}
+	f := &spliceFile{node: n, FileHandle: NewLoopbackFile(fd)}
+	if n.pipes {
+		return &splicePipeFile{f}, fuse.FOPEN_DIRECT_IO, OK
+	}
+	return f, fuse.FOPEN_DIRECT_IO, OK
+}
+
+func (n *spliceNode) Getattr(ctx context.Context, f FileHandle, out *fuse.AttrOut) syscall.Errno {
+	st := syscall.Stat_t{}
+	if err := syscall.Stat(n.path, &st); err != nil {
+		return ToErrno(err)
+	}
+	out.FromStat(&st)
+	return OK
+}
+
+type spliceFile struct {
+	FileHandle
+	node *spliceNode
+}
+
+func (f *spliceFile) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	atomic.AddInt32(&f.node.copied, 1)
+	return f.FileHandle.(FileWriter).Write(ctx, data, off)
+}
+
+func (f *spliceFile) Release(ctx context.Context) syscall.Errno {
+	return f.FileHandle.(FileReleaser).Release(ctx)
+}
+
+type splicePipeFile struct {
+	*spliceFile
+}
+
+func (f *splicePipeFile) WritePipe(ctx context.Context, data *fuse.PipeData, off int64) (uint32, syscall.Errno) {
+	atomic.AddInt32(&f.node.spliced, 1)
+	return f.FileHandle.(FilePipeWriter).WritePipe(ctx, data, off)
+}
+
+func TestSpliceWrite(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	spliced := &spliceNode{path: filepath.Join(dir, "spliced"), pipes: true}
+	copied := &spliceNode{path: filepath.Join(dir, "copied")}
+	root := &Inode{}
+	mntDir, server, clean := testMount(t, root, &Options{
+		MountOptions: fuse.MountOptions{
+			EnableSpliceRead: true,
+		},
+		OnAdd: func(ctx context.Context) {
+			for _, n := range []*spliceNode{spliced, copied} {
+				if err := ioutil.WriteFile(n.path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				ch := root.NewPersistentInode(ctx, n, StableAttr{})
+				root.AddChild(filepath.Base(n.path), ch, false)
+			}
+		},
+	})
+	defer clean()
+
+	if server.NegotiatedCapabilities()&fuse.CAP_SPLICE_READ == 0 {
+		t.Skip("kernel does not support splice read")
+	}
+
+	big := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	small := []byte("small")
+	for _, n := range []*spliceNode{spliced, copied} {
+		f, err := os.OpenFile(filepath.Join(mntDir, filepath.Base(n.path)), os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		if _, err := f.WriteAt(big, 0); err != nil {
+			t.Fatalf("WriteAt: %v", err)
+		}
+		if _, err := f.WriteAt(small, int64(len(big))); err != nil {
+			t.Fatalf("WriteAt: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		got, err := ioutil.ReadFile(n.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := append(big, small...); !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d", n.path, len(got), len(want))
+		}
+	}
+
+	// The large write arrives in a pipe, the small one is copied.
+	if spliced.spliced != 1 || spliced.copied != 1 {
+		t.Errorf("spliced file: got %d spliced and %d copied writes, want 1 and 1",
+			spliced.spliced, spliced.copied)
+	}
+	// Without WritePipe, the data is copied out of the pipe.
+	if copied.spliced != 0 || copied.copied != 2 {
+		t.Errorf("copied file: got %d spliced and %d copied writes, want 0 and 2",
+			copied.spliced, copied.copied)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// BridgeState records the node IDs and file handles that the kernel
+// holds for a file system created with NewNodeFS. It lets a new
+// process continue serving a mount after a live upgrade (see
+// fuse.Takeover): obtain it with SaveState in the old process, and
+// pass it as Options.RestoreState in the new one.
+type BridgeState struct {
+	// NextNodeID is larger than all node IDs handed out so far.
+	NextNodeID uint64
+	Nodes      []NodeState
+	Files      []FileState
+}
+
+// NodeState describes a node ID that the kernel knows about.
+type NodeState struct {
+	NodeID uint64
+
+	// Path has the names from the root to the node. It is empty
+	// if the node has no name in the tree, e.g. files that were
+	// deleted while open.
+	Path []string
+
+	StableAttr  StableAttr
+	LookupCount uint64
+}
+
+// FileState describes an open file or directory handle.
+type FileState struct {
+	Fh     uint64
+	NodeID uint64
+
+	// Flags are the flags the file was opened with.
+	Flags uint32
+
+	// BackingID is the kernel passthrough ID of the file, if any.
+	BackingID int32
+}
+
+// SaveState records the node IDs and file handles of a file system
+// returned by NewNodeFS. It must be called while the server does not
+// process requests, e.g. from a fuse.TakeoverListener, which does so
+// automatically.
+func SaveState(rawFS fuse.RawFileSystem) (*BridgeState, error) {
+	b, ok := rawFS.(*rawBridge)
+	if !ok {
+		return nil, fmt.Errorf("SaveState: %T was not created by NewNodeFS", rawFS)
+	}
+	return b.saveState(), nil
+}
+
+func (b *rawBridge) saveState() *BridgeState {
+	b.mu.Lock()
+	st := &BridgeState{NextNodeID: b.nextNodeId}
+	nodes := make([]*Inode, 0, len(b.kernelNodeIds))
+	for id, n := range b.kernelNodeIds {
+		if id != 1 {
+			nodes = append(nodes, n)
+		}
+		for _, fh := range n.openFiles {
+			f := b.files[fh]
+			st.Files = append(st.Files, FileState{
+				Fh:        uint64(fh),
+				NodeID:    id,
+				Flags:     f.flags,
+				BackingID: f.backingID,
+			})
+		}
+	}
+	b.mu.Unlock()
+
+	for _, n := range nodes {
+		n.mu.Lock()
+		lookupCount := n.lookupCount
+		n.mu.Unlock()
+		st.Nodes = append(st.Nodes, NodeState{
+			NodeID:      n.nodeId,
+			Path:        b.treePath(n),
+			StableAttr:  n.stableAttr,
+			LookupCount: lookupCount,
+		})
+	}
+	sort.Slice(st.Nodes, func(i, j int) bool {
+		return st.Nodes[i].NodeID < st.Nodes[j].NodeID
+	})
+	sort.Slice(st.Files, func(i, j int) bool {
+		return st.Files[i].Fh < st.Files[j].Fh
+	})
+	return st
+}
+
+// treePath returns the names leading from the root to n, or nil if n
+// is not reachable from the root.
+func (b *rawBridge) treePath(n *Inode) []string {
+	var segments []string
+	for p := n; p != b.root; {
+		p.mu.Lock()
+		pd := p.parents.get()
+		p.mu.Unlock()
+		if pd == nil {
+			return nil
+		}
+		segments = append(segments, pd.name)
+		p = pd.parent
+	}
+	for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+		segments[i], segments[j] = segments[j], segments[i]
+	}
+	return segments
+}
+
+// restoreState rebuilds the node IDs and file handles of st by
+// looking up the nodes (NodeLookuper) and opening the files again
+// (NodeOpener). Nodes that no longer exist, or were replaced by a
+// different file, are kept as placeholders, so the kernel can still
+// forget them; their file handles fail I/O.
+func (b *rawBridge) restoreState(st *BridgeState) {
+	ctx := &fuse.Context{}
+
+	// Renumber nodes created so far (e.g. by OnAdd), so they
+	// don't clash with the node IDs from st.
+	if st.NextNodeID > b.nextNodeId {
+		b.nextNodeId = st.NextNodeID
+	}
+	b.renumber(b.root)
+
+	nodes := append([]NodeState(nil), st.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return len(nodes[i].Path) < len(nodes[j].Path)
+	})
+	for _, ns := range nodes {
+		n := b.restoreNode(ctx, &ns)
+		if n == nil {
+			b.logf("restore: n%d %q is gone", ns.NodeID, ns.Path)
+			lost := &lostNode{}
+			initInode(&lost.Inode, lost, ns.StableAttr, b, false, ns.NodeID)
+			n = &lost.Inode
+		}
+
+		n.mu.Lock()
+		b.mu.Lock()
+		n.nodeId = ns.NodeID
+		n.lookupCount += ns.LookupCount
+		n.changeCounter++
+		b.kernelNodeIds[ns.NodeID] = n
+		if _, ok := n.ops.(*lostNode); !ok {
+			b.stableAttrs[n.stableAttr] = n
+		}
+		b.mu.Unlock()
+		n.mu.Unlock()
+	}
+	if len(b.kernelNodeIds) > b.nodeCountHigh {
+		b.nodeCountHigh = len(b.kernelNodeIds)
+	}
+
+	restored := map[uint64]bool{0: true}
+	for _, fe := range st.Files {
+		if b.restoreFile(ctx, &fe) {
+			restored[fe.Fh] = true
+		}
+	}
+	b.mu.Lock()
+	b.freeFiles = b.freeFiles[:0]
+	for fh := range b.files {
+		if !restored[uint64(fh)] {
+			b.freeFiles = append(b.freeFiles, uint32(fh))
+		}
+	}
+	b.mu.Unlock()
+}
+
+// lostNode stands in for a node that could not be restored.
+type lostNode struct {
+	Inode
+}
+
+// renumber gives fresh node IDs to n's descendants.
+func (b *rawBridge) renumber(n *Inode) {
+	for _, ch := range n.Children() {
+		b.mu.Lock()
+		ch.nodeId = b.nextNodeId
+		b.nextNodeId++
+		b.mu.Unlock()
+		b.renumber(ch)
+	}
+}
+
+// restoreNode finds the node at ns.Path, or returns nil.
+func (b *rawBridge) restoreNode(ctx *fuse.Context, ns *NodeState) *Inode {
+	if len(ns.Path) == 0 {
+		return nil
+	}
+	n := b.root
+	for _, name := range ns.Path {
+		if !n.IsDir() {
+			return nil
+		}
+		child := n.GetChild(name)
+		if child == nil {
+			var out fuse.EntryOut
+			var errno syscall.Errno
+			child, errno = b.lookup(ctx, n, name, &out)
+			if errno != 0 {
+				return nil
+			}
+
+			lockNodes(n, child)
+			b.mu.Lock()
+			if old := b.stableAttrs[child.stableAttr]; old != nil {
+				child = old
+			}
+			b.mu.Unlock()
+			n.setEntry(name, child)
+			unlockNodes(n, child)
+		}
+		n = child
+	}
+
+	want := ns.StableAttr
+	want.Mode &= syscall.S_IFMT
+	if n.stableAttr != want {
+		return nil
+	}
+	return n
+}
+
+// restoreFile reopens a file handle. It returns false if the node is
+// unknown.
+func (b *rawBridge) restoreFile(ctx *fuse.Context, fe *FileState) bool {
+	b.mu.Lock()
+	n := b.kernelNodeIds[fe.NodeID]
+	b.mu.Unlock()
+	if n == nil {
+		b.logf("restore: fh %d on unknown node n%d", fe.Fh, fe.NodeID)
+		return false
+	}
+
+	var f FileHandle
+	if _, ok := n.ops.(*lostNode); ok {
+		// I/O on the handle fails.
+	} else if n.IsDir() {
+		if od, ok := n.ops.(NodeOpendirer); ok {
+			if errno := od.Opendir(ctx); errno != 0 {
+				b.logf("restore: opendir n%d: %v", fe.NodeID, errno)
+			}
+		}
+	} else if op, ok := n.ops.(NodeOpener); ok {
+		flags := fe.Flags &^ (syscall.O_CREAT | syscall.O_EXCL | syscall.O_TRUNC)
+		var errno syscall.Errno
+		f, _, errno = op.Open(ctx, flags)
+		if errno != 0 {
+			b.logf("restore: open n%d: %v", fe.NodeID, errno)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for uint64(len(b.files)) <= fe.Fh {
+		b.files = append(b.files, &fileEntry{})
+	}
+	b.attachFile(n, uint32(fe.Fh), f, fe.Flags)
+	if fe.BackingID != 0 {
+		// The backing ID belongs to the inode, and is kept
+		// until its last file is released.
+		b.files[fe.Fh].backingID = fe.BackingID
+		n.backingID = fe.BackingID
+		n.backingRefs++
+	}
+	return true
+}
+
+// SaveTakeoverState implements fuse.TakeoverStater.
+func (b *rawBridge) SaveTakeoverState() ([]byte, error) {
+	return json.Marshal(b.saveState())
+}
+
+// RestoreTakeoverState implements fuse.TakeoverStater.
+func (b *rawBridge) RestoreTakeoverState(data []byte) error {
+	var st BridgeState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	b.restoreState(&st)
+	return nil
+}
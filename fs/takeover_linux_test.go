@@ -0,0 +1,87 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+func TestTakeoverOpenFile(t *testing.T) {
+	orig := testutil.TempDir()
+	defer os.RemoveAll(orig)
+	if err := os.Mkdir(orig+"/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(orig+"/dir/file", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldRoot, err := NewLoopbackRoot(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mntDir, oldSrv, clean := testMount(t, oldRoot, &Options{})
+	defer clean()
+
+	f, err := os.OpenFile(mntDir+"/dir/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+
+	sock := filepath.Join(orig, "takeover.sock")
+	l, err := fuse.ListenForTakeover(sock, oldSrv)
+	if err != nil {
+		t.Fatalf("ListenForTakeover: %v", err)
+	}
+	defer l.Close()
+	ctx := context.Background()
+	acceptErr := make(chan error, 1)
+	go func() {
+		acceptErr <- l.Accept(ctx)
+	}()
+
+	newRoot, err := NewLoopbackRoot(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSrv, err := fuse.Takeover(ctx, sock, NewNodeFS(newRoot, &Options{}),
+		&fuse.MountOptions{Debug: testutil.VerboseTest()})
+	if err != nil {
+		t.Fatalf("Takeover: %v", err)
+	}
+	go newSrv.Serve()
+	defer newSrv.Unmount()
+	if err := <-acceptErr; err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	// The kernel still uses the node ID and file handle from the
+	// old process.
+	if _, err := f.WriteAt([]byte("HE"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	content, err := ioutil.ReadFile(orig + "/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "HEllo" {
+		t.Errorf("got %q, want %q", content, "HEllo")
+	}
+
+	if _, err := os.Stat(mntDir + "/dir/file"); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+}
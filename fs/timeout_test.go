@@ -0,0 +1,100 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/fusetest"
+)
+
+// slowRoot blocks LOOKUP until it is canceled, and then until
+// release is closed.
+type slowRoot struct {
+	Inode
+
+	release  chan struct{}
+	deadline chan time.Time
+	err      chan error
+}
+
+func (r *slowRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*Inode, syscall.Errno) {
+	d, _ := ctx.Deadline()
+	r.deadline <- d
+	<-ctx.Done()
+	r.err <- ctx.Err()
+	<-r.release
+	ch := r.NewInode(ctx, &MemRegularFile{}, StableAttr{})
+	return ch, 0
+}
+
+func TestRequestTimeout(t *testing.T) {
+	root := &slowRoot{
+		release:  make(chan struct{}),
+		deadline: make(chan time.Time, 1),
+		err:      make(chan error, 1),
+	}
+	opts := &Options{}
+	opts.RequestTimeout = 50 * time.Millisecond
+	opts.OpTimeouts = map[string]time.Duration{"getattr": 0}
+	opts.TimeoutStatus = fuse.Status(syscall.ETIMEDOUT)
+	k, err := fusetest.New(NewNodeFS(root, opts), &opts.MountOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	start := time.Now()
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "file"); err != syscall.ETIMEDOUT {
+		t.Fatalf("Lookup: got %v, want ETIMEDOUT", err)
+	}
+	if dt := time.Since(start); dt < opts.RequestTimeout {
+		t.Errorf("Lookup returned after %v", dt)
+	}
+	if d := <-root.deadline; d.IsZero() || d.Before(start) {
+		t.Errorf("got deadline %v, start %v", d, start)
+	}
+	if err := <-root.err; err != context.DeadlineExceeded {
+		t.Errorf("got ctx.Err() %v, want DeadlineExceeded", err)
+	}
+
+	reqs := k.Server.InflightRequests()
+	if len(reqs) != 1 || !reqs[0].TimedOut {
+		t.Errorf("got in flight %v, want timed out LOOKUP", reqs)
+	}
+
+	// The late reply is dropped, and the node is not added.
+	close(root.release)
+	for start := time.Now(); len(k.Server.InflightRequests()) > 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("handler did not finish")
+		}
+	}
+	if root.GetChild("file") != nil {
+		t.Errorf("late LOOKUP result was kept")
+	}
+
+	if _, err := k.GetAttr(fuse.FUSE_ROOT_ID); err != nil {
+		t.Errorf("GetAttr: %v", err)
+	}
+}
+
+func TestRequestTimeoutBadOp(t *testing.T) {
+	opts := &Options{}
+	opts.OpTimeouts = map[string]time.Duration{"FROBNICATE": time.Second}
+	if k, err := fusetest.New(NewNodeFS(&Inode{}, opts), &opts.MountOptions); err == nil {
+		k.Close()
+		t.Errorf("unknown operation accepted")
+	}
+	opts.OpTimeouts = map[string]time.Duration{"FORGET": time.Second}
+	if k, err := fusetest.New(NewNodeFS(&Inode{}, opts), &opts.MountOptions); err == nil {
+		k.Close()
+		t.Errorf("timeout for FORGET accepted")
+	}
+}
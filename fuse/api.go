@@ -72,7 +72,8 @@
 // This can deadlock if there is no free thread to handle the FUSE server side.
 // Run your program with GOMAXPROCS=1 to make the problem easier to reproduce,
 // see https://github.com/hanwen/go-fuse/issues/261 for an example of that
-// problem.
+// problem. MountOptions.SelfAccess can serve such accesses separately, or
+// fail them with EDEADLK.
 //
 // # Higher level interfaces
 //
@@ -90,6 +91,11 @@
 // you care about correctness.
 package fuse
 
+import (
+	"io"
+	"time"
+)
+
 // Types for users to implement.
 
 // The result of Read is an array of bytes, but for performance
@@ -110,6 +116,36 @@ type ReadResult interface {
 	Done()
 }
 
+// Capabilities declares which INIT capabilities (the CAP_*
+// constants) a file system wants from the kernel.
+type Capabilities struct {
+	// Required capabilities must all be offered by the kernel,
+	// otherwise NewServer fails.
+	Required InitFlags
+
+	// Optional capabilities are granted if the kernel offers
+	// them, and silently dropped otherwise.
+	Optional InitFlags
+}
+
+// Transport is a way of exchanging requests and replies with the
+// kernel.
+type Transport int
+
+const (
+	// ReadWrite reads each request from the FUSE device and
+	// writes each reply back to it.
+	ReadWrite Transport = iota
+
+	// IOUring registers a queue of request buffers per CPU with
+	// the kernel over io_uring, so a reply and the fetch of the
+	// next request share one submission. This needs Linux 6.14
+	// or later, with the enable_uring parameter of the fuse
+	// module set. FORGET and INTERRUPT are still read from the
+	// FUSE device.
+	IOUring
+)
+
 type MountOptions struct {
 	AllowOther bool
 
@@ -121,6 +157,14 @@ type MountOptions struct {
 	// async I/O.  Concurrency for synchronous I/O is not limited.
 	MaxBackground int
 
+	// MaxReaders is the maximum number of goroutines reading
+	// requests from the kernel. If 0, use GOMAXPROCS, capped at
+	// 4. Each reader gets its own clone of the FUSE device fd,
+	// so readers do not contend for one fd; if the kernel does
+	// not support cloning, they share the fd of the mount. See
+	// Server.ChannelStats.
+	MaxReaders int
+
 	// MaxWrite is the max size for read and write requests. If 0, use
 	// go-fuse default (currently 64 kiB).
 	// This number is internally capped at MAX_KERNEL_WRITE (higher values don't make
@@ -187,10 +231,73 @@ type MountOptions struct {
 	// If set, print debugging information.
 	Debug bool
 
+	// RecordTraffic, if set, receives every raw request and reply
+	// exchanged with the kernel, in the format read by
+	// ReadRecording. Splicing and the io_uring transport are not
+	// used while recording, so all data passes through memory.
+	RecordTraffic io.Writer
+
+	// Tracer, if set, is notified of each request. Unlike Debug,
+	// it can select requests (see TraceFilter), and it sees the
+	// duration of each request.
+	Tracer Tracer
+
+	// StuckRequestThreshold, if positive, makes the server log a
+	// warning with the stack of the serving goroutine for each
+	// request that is not answered within this time. See also
+	// Server.InflightRequests.
+	StuckRequestThreshold time.Duration
+
+	// RequestTimeout, if positive, limits the time the file
+	// system may take to answer a request. When it passes, the
+	// server replies with TimeoutStatus, and cancels the request
+	// as if it were interrupted; the reply of the file system is
+	// discarded when it comes. The deadline is available through
+	// Context.Deadline. FORGET, INTERRUPT, INIT and DESTROY never
+	// time out. SETLKW, which waits until the lock is free, only
+	// times out if it is in OpTimeouts. POLL does not wait for
+	// events (see Server.PollNotify), so it times out like other
+	// operations.
+	RequestTimeout time.Duration
+
+	// OpTimeouts overrides RequestTimeout for operations, by name
+	// (eg. "LOOKUP", "READ"). A zero or negative duration disables
+	// the timeout for the operation.
+	OpTimeouts map[string]time.Duration
+
+	// TimeoutStatus is the reply to requests that time out. The
+	// default is EIO; ETIMEDOUT is another choice.
+	TimeoutStatus Status
+
+	// Scheduler, if set, makes a pool of workers serve the
+	// requests, with limits on the number of requests of each
+	// class of operations (see OpClass). By default, requests are
+	// served by the goroutines that read them, without a limit.
+	Scheduler *SchedulerOptions
+
+	// SelfAccess says what to do with requests that come from the
+	// serving process itself (see SelfAccessPolicy). Recognizing
+	// them costs a stat(2) of /proc per request.
+	SelfAccess SelfAccessPolicy
+
 	// If set, ask kernel to forward file locks to FUSE. If using,
 	// you must implement the GetLk/SetLk/SetLkw methods.
 	EnableLocks bool
 
+	// If set, pass FUSE_POLL requests to RawFileSystem.Poll, so
+	// select, poll and epoll work on files in the mount. If
+	// unset, the kernel is told at mount time that poll is not
+	// supported.
+	//
+	// The Go runtime adds every file opened through package os
+	// to its epoll set. For files on a FUSE mount with poll
+	// enabled, that epoll_ctl call waits for the FUSE_POLL
+	// reply while holding on to a runtime thread slot, which
+	// can deadlock the runtime. With this option set, the
+	// serving process should only access its own mount through
+	// raw system calls (eg. syscall.Open).
+	EnablePoll bool
+
 	// If set, ask kernel not to do automatic data cache invalidation.
 	// The filesystem is fully responsible for invalidating data cache.
 	ExplicitDataCacheControl bool
@@ -207,6 +314,16 @@ type MountOptions struct {
 	// by the kernel. See `man 2 mount` for details about MS_MGC_VAL.
 	DirectMountFlags uintptr
 
+	// AutoUnmount makes fusermount unmount the file system when
+	// the serving process exits, even if it crashes, so no dead
+	// mount ("Transport endpoint is not connected") stays behind.
+	// fusermount stays around for this, watching a socket that
+	// the server closes once Serve returns. As the kernel has no
+	// such option, DirectMount is not tried. Such servers cannot
+	// be taken over (see ListenForTakeover), as the mount would go
+	// away when the old process stops serving. Linux only.
+	AutoUnmount bool
+
 	// EnableAcls enables kernel ACL support.
 	//
 	// See the comments to FUSE_CAP_POSIX_ACL
@@ -217,14 +334,40 @@ type MountOptions struct {
 	// EnableWriteback enables kernel writeback cache.
 	EnableWriteback bool
 
+	// EnablePassthrough lets the kernel do reads and writes
+	// directly on a backing file descriptor, bypassing the
+	// file system, for files opened with FOPEN_PASSTHROUGH. This
+	// needs Linux 6.9 or later, and root privileges. See
+	// Server.RegisterBackingFd.
+	EnablePassthrough bool
+
+	// EnableSpliceRead reads requests from the kernel with
+	// splice(2), and leaves the data of large WRITE requests in
+	// the pipe, for RawFileSystem.WritePipe. This costs an extra
+	// system call per request, so it only pays off if the file
+	// system can splice the data on, e.g. into a backing file.
+	EnableSpliceRead bool
+
+	// Transport selects how requests and replies are exchanged
+	// with the kernel. If the kernel does not support the
+	// selected transport, the server falls back to ReadWrite.
+	Transport Transport
+
 	EnableIoctl bool
 
 	// If set, tell kernel not to apply umask for create/mkdir/mknod
 	DontUmask bool
 
 	// Other capability flags
+	//
+	// Deprecated: use Capabilities.Optional.
 	OtherCaps uint32
 
+	// Capabilities to request from the kernel, on top of the ones
+	// implied by other options (eg. EnableLocks). Use
+	// Server.NegotiatedCapabilities to find out what was granted.
+	Capabilities Capabilities
+
 	// don't alloc buffer for read operation
 	NoAllocForRead bool
 }
@@ -276,6 +419,13 @@ type RawFileSystem interface {
 
 	// Attributes.
 	GetAttr(cancel <-chan struct{}, input *GetAttrIn, out *AttrOut) (code Status)
+
+	// Statx is like GetAttr, but for statx(2). It is only sent
+	// if the caller asks for fields beyond those in Attr, such as
+	// the birth time. Returning ENOSYS makes the kernel fall back
+	// to GetAttr.
+	Statx(cancel <-chan struct{}, input *StatxIn, out *StatxOut) (code Status)
+
 	SetAttr(cancel <-chan struct{}, input *SetAttrIn, out *AttrOut) (code Status)
 
 	// Modifying structure.
@@ -310,6 +460,11 @@ type RawFileSystem interface {
 
 	// File handling.
 	Create(cancel <-chan struct{}, input *CreateIn, name string, out *CreateOut) (code Status)
+
+	// Tmpfile creates an unnamed file in the directory
+	// input.NodeId, for open(2) with O_TMPFILE. The new node may
+	// later be given a name through Link.
+	Tmpfile(cancel <-chan struct{}, input *CreateIn, out *CreateOut) (code Status)
 	Open(cancel <-chan struct{}, input *OpenIn, out *OpenOut) (status Status)
 	Read(cancel <-chan struct{}, input *ReadIn, buf []byte) (ReadResult, Status)
 	Lseek(cancel <-chan struct{}, in *LseekIn, out *LseekOut) Status
@@ -321,6 +476,11 @@ type RawFileSystem interface {
 
 	Release(cancel <-chan struct{}, input *ReleaseIn)
 	Write(cancel <-chan struct{}, input *WriteIn, data []byte) (written uint32, code Status)
+
+	// WritePipe is like Write, but the data is in a pipe (see
+	// MountOptions.EnableSpliceRead). If it returns ENOSYS
+	// without consuming the data, the data is passed to Write.
+	WritePipe(cancel <-chan struct{}, input *WriteIn, data *PipeData) (written uint32, code Status)
 	CopyFileRange(cancel <-chan struct{}, input *CopyFileRangeIn) (written uint32, code Status)
 
 	Flush(cancel <-chan struct{}, input *FlushIn) Status
@@ -336,8 +496,23 @@ type RawFileSystem interface {
 
 	StatFs(cancel <-chan struct{}, input *InHeader, out *StatfsOut) (code Status)
 
+	// SyncFs flushes the state of the entire file system to
+	// stable storage, for syncfs(2). Returning ENOSYS makes the
+	// kernel stop sending SYNCFS, and succeed syncfs(2) without
+	// asking.
+	SyncFs(cancel <-chan struct{}, input *SyncFsIn) (code Status)
+
 	Ioctl(cancel <-chan struct{}, in *IoctlIn, out *IoctlOut, bufIn, bufOut []byte) Status
 
+	// Poll returns the I/O readiness of an open file in
+	// out.Revents. If in.Flags has FUSE_POLL_SCHEDULE_NOTIFY set,
+	// the file system should call Server.PollNotify with in.Kh
+	// once the readiness changes. Returning ENOSYS switches off
+	// polling for the entire mount; files are then always
+	// reported as ready. Only called if MountOptions.EnablePoll
+	// is set.
+	Poll(cancel <-chan struct{}, in *PollIn, out *PollOut) Status
+
 	// This is called on processing the first request. The
 	// filesystem implementation can use the server argument to
 	// talk back to the kernel (through notify methods).
@@ -24,3 +24,25 @@ func (a *Attr) FromStat(s *syscall.Stat_t) {
 	a.Gid = uint32(s.Gid)
 	a.Rdev = uint32(s.Rdev)
 }
+
+// statxBasicStats is STATX_BASIC_STATS: the fields that are also
+// present in Attr.
+const statxBasicStats = 0x7ff
+
+// FromAttr fills the basic fields of s from a. Birth time is not
+// set.
+func (s *Statx) FromAttr(a *Attr) {
+	s.Mask = statxBasicStats
+	s.Nlink = a.Nlink
+	s.Uid = a.Uid
+	s.Gid = a.Gid
+	s.Mode = uint16(a.Mode)
+	s.Ino = a.Ino
+	s.Size = a.Size
+	s.Blocks = a.Blocks
+	s.Atime = SxTime{Sec: a.Atime, Nsec: a.Atimensec}
+	s.Mtime = SxTime{Sec: a.Mtime, Nsec: a.Mtimensec}
+	s.Ctime = SxTime{Sec: a.Ctime, Nsec: a.Ctimensec}
+	s.RdevMajor = a.Rdev >> 24
+	s.RdevMinor = a.Rdev & 0xffffff
+}
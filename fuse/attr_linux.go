@@ -6,6 +6,8 @@ package fuse
 
 import (
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 func (a *Attr) FromStat(s *syscall.Stat_t) {
@@ -25,3 +27,47 @@ func (a *Attr) FromStat(s *syscall.Stat_t) {
 	a.Rdev = uint32(s.Rdev)
 	a.Blksize = uint32(s.Blksize)
 }
+
+// FromStatx fills s from the result of statx(2). Statx has no
+// field for the mount ID (stx_mnt_id), so it is dropped; the kernel
+// fills in the ID of the FUSE mount instead.
+func (s *Statx) FromStatx(st *unix.Statx_t) {
+	s.Mask = st.Mask
+	s.Blksize = st.Blksize
+	s.Attributes = st.Attributes
+	s.Nlink = st.Nlink
+	s.Uid = st.Uid
+	s.Gid = st.Gid
+	s.Mode = st.Mode
+	s.Ino = st.Ino
+	s.Size = st.Size
+	s.Blocks = st.Blocks
+	s.AttributesMask = st.Attributes_mask
+	s.Atime = SxTime{Sec: uint64(st.Atime.Sec), Nsec: st.Atime.Nsec}
+	s.Btime = SxTime{Sec: uint64(st.Btime.Sec), Nsec: st.Btime.Nsec}
+	s.Ctime = SxTime{Sec: uint64(st.Ctime.Sec), Nsec: st.Ctime.Nsec}
+	s.Mtime = SxTime{Sec: uint64(st.Mtime.Sec), Nsec: st.Mtime.Nsec}
+	s.RdevMajor = st.Rdev_major
+	s.RdevMinor = st.Rdev_minor
+	s.DevMajor = st.Dev_major
+	s.DevMinor = st.Dev_minor
+}
+
+// FromAttr fills the basic fields of s from a. Birth time is not
+// set.
+func (s *Statx) FromAttr(a *Attr) {
+	s.Mask = unix.STATX_BASIC_STATS
+	s.Blksize = a.Blksize
+	s.Nlink = a.Nlink
+	s.Uid = a.Uid
+	s.Gid = a.Gid
+	s.Mode = uint16(a.Mode)
+	s.Ino = a.Ino
+	s.Size = a.Size
+	s.Blocks = a.Blocks
+	s.Atime = SxTime{Sec: a.Atime, Nsec: a.Atimensec}
+	s.Mtime = SxTime{Sec: a.Mtime, Nsec: a.Mtimensec}
+	s.Ctime = SxTime{Sec: a.Ctime, Nsec: a.Ctimensec}
+	s.RdevMajor = (a.Rdev & 0xfff00) >> 8
+	s.RdevMinor = (a.Rdev & 0xff) | ((a.Rdev >> 12) & 0xfff00)
+}
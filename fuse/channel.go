@@ -0,0 +1,102 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"log"
+	"sync/atomic"
+	"syscall"
+)
+
+// channel is a file descriptor for the FUSE connection. The first
+// channel is the fd of the mount; readers that find all channels busy
+// clone a new one, so they do not all contend for one fd. Replies
+// must be written to the channel the request was read from.
+type channel struct {
+	fd int
+
+	// readers is the number of goroutines reading from fd.
+	// Protected by Server.reqMu.
+	readers int
+
+	// Updated atomically.
+	requests uint64
+	bytes    uint64
+}
+
+// ChannelStats has statistics for one FUSE device channel.
+type ChannelStats struct {
+	// Fd is the file descriptor of the channel.
+	Fd int
+
+	// Readers is the number of goroutines currently reading.
+	Readers int
+
+	// Requests and Bytes count the requests read so far.
+	Requests uint64
+	Bytes    uint64
+}
+
+// ChannelStats returns statistics for each channel that the server
+// reads requests from. Unless the kernel refuses to clone the FUSE
+// device, there is a channel per reader (see MountOptions.MaxReaders).
+func (ms *Server) ChannelStats() []ChannelStats {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	r := make([]ChannelStats, 0, len(ms.channels))
+	for _, ch := range ms.channels {
+		r = append(r, ChannelStats{
+			Fd:       ch.fd,
+			Readers:  ch.readers,
+			Requests: atomic.LoadUint64(&ch.requests),
+			Bytes:    atomic.LoadUint64(&ch.bytes),
+		})
+	}
+	return r
+}
+
+// pickChannel returns a channel for a new reader: an idle one if
+// possible, else a fresh clone, else the least busy one. Must hold
+// reqMu.
+func (ms *Server) pickChannel() *channel {
+	if len(ms.channels) == 0 {
+		ms.channels = append(ms.channels, &channel{fd: ms.mountFd})
+	}
+	best := ms.channels[0]
+	for _, ch := range ms.channels {
+		if ch.readers < best.readers {
+			best = ch
+		}
+	}
+	if best.readers == 0 || ms.cloneFailed || len(ms.channels) >= ms.maxReaders {
+		return best
+	}
+
+	fd, err := ms.cloneFd()
+	if err != nil {
+		// Keep sharing the fds we have.
+		if err != syscall.ENOSYS {
+			log.Printf("clone FUSE device: %v", err)
+		}
+		ms.cloneFailed = true
+		return best
+	}
+	ch := &channel{fd: fd}
+	ms.channels = append(ms.channels, ch)
+	return ch
+}
+
+// closeChannels closes the cloned fds. The fd of the mount is closed
+// separately.
+func (ms *Server) closeChannels() {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	for _, ch := range ms.channels {
+		if ch.fd != ms.mountFd {
+			syscall.Close(ch.fd)
+		}
+	}
+	ms.channels = nil
+}
@@ -21,8 +21,10 @@ type Context struct {
 	Cancel <-chan struct{}
 }
 
+// Deadline returns the time at which the request times out, if the
+// server has a timeout for it (see MountOptions.RequestTimeout).
 func (c *Context) Deadline() (time.Time, bool) {
-	return time.Time{}, false
+	return deadlineOf(c.Cancel)
 }
 
 func (c *Context) Done() <-chan struct{} {
@@ -32,6 +34,9 @@ func (c *Context) Done() <-chan struct{} {
 func (c *Context) Err() error {
 	select {
 	case <-c.Cancel:
+		if d, ok := c.Deadline(); ok && !time.Now().Before(d) {
+			return context.DeadlineExceeded
+		}
 		return context.Canceled
 	default:
 		return nil
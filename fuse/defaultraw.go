@@ -132,6 +132,10 @@ func (fs *defaultRawFileSystem) Write(cancel <-chan struct{}, input *WriteIn, da
 	return 0, ENOSYS
 }
 
+func (fs *defaultRawFileSystem) WritePipe(cancel <-chan struct{}, input *WriteIn, data *PipeData) (written uint32, code Status) {
+	return 0, ENOSYS
+}
+
 func (fs *defaultRawFileSystem) Flush(cancel <-chan struct{}, input *FlushIn) Status {
 	return OK
 }
@@ -163,6 +167,18 @@ func (fs *defaultRawFileSystem) CopyFileRange(cancel <-chan struct{}, input *Cop
 	return 0, ENOSYS
 }
 
+func (fs *defaultRawFileSystem) Statx(cancel <-chan struct{}, input *StatxIn, out *StatxOut) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) Tmpfile(cancel <-chan struct{}, input *CreateIn, out *CreateOut) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) SyncFs(cancel <-chan struct{}, input *SyncFsIn) (code Status) {
+	return ENOSYS
+}
+
 func (fs *defaultRawFileSystem) Lseek(cancel <-chan struct{}, in *LseekIn, out *LseekOut) Status {
 	return ENOSYS
 }
@@ -170,3 +186,7 @@ func (fs *defaultRawFileSystem) Lseek(cancel <-chan struct{}, in *LseekIn, out *
 func (fs *defaultRawFileSystem) Ioctl(cancel <-chan struct{}, in *IoctlIn, out *IoctlOut, bufIn, bufOut []byte) Status {
 	return ENOSYS
 }
+
+func (fs *defaultRawFileSystem) Poll(cancel <-chan struct{}, in *PollIn, out *PollOut) Status {
+	return ENOSYS
+}
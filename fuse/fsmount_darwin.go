@@ -0,0 +1,22 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"os"
+	"syscall"
+)
+
+// MoveMount attaches a mount returned by NewDetachedServer. It is not
+// supported on OSX.
+func MoveMount(mnt *os.File, target string) error {
+	return syscall.ENOSYS
+}
+
+// NewDetachedServer mounts fs without attaching the mount. It is not
+// supported on OSX.
+func NewDetachedServer(fs RawFileSystem, opts *MountOptions) (*Server, *os.File, error) {
+	return nil, nil, syscall.ENOSYS
+}
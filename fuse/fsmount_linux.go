@@ -0,0 +1,289 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The mount API of Linux 5.2 (fsopen(2), fsconfig(2), fsmount(2) and
+// move_mount(2)) sets up a mount step by step: options are passed one
+// at a time, and the mount can be created without attaching it.
+
+const (
+	_SYS_MOVE_MOUNT = 429
+	_SYS_FSOPEN     = 430
+	_SYS_FSCONFIG   = 431
+	_SYS_FSMOUNT    = 432
+
+	_FSOPEN_CLOEXEC  = 1
+	_FSMOUNT_CLOEXEC = 1
+
+	_FSCONFIG_SET_FLAG   = 0
+	_FSCONFIG_SET_STRING = 1
+	_FSCONFIG_CMD_CREATE = 6
+
+	_MOUNT_ATTR_RDONLY     = 0x1
+	_MOUNT_ATTR_NOSUID     = 0x2
+	_MOUNT_ATTR_NODEV      = 0x4
+	_MOUNT_ATTR_NOEXEC     = 0x8
+	_MOUNT_ATTR_NOATIME    = 0x10
+	_MOUNT_ATTR_NODIRATIME = 0x80
+
+	_MOVE_MOUNT_F_EMPTY_PATH = 0x4
+
+	// _MS_MGC_MSK marks the flags of mount(2) as such; see
+	// MountOptions.DirectMountFlags.
+	_MS_MGC_MSK = 0xffff0000
+)
+
+// errFsmountFlags means that DirectMountFlags has flags that the new
+// mount API does not take.
+var errFsmountFlags = errors.New("mount flags not supported by fsmount(2)")
+
+// fsmountUnsupported tells if an error from fsmountFUSE means that
+// mount(2) should be used instead. Container runtimes often have
+// seccomp fail unknown syscalls with EPERM, so EPERM from fsopen(2),
+// which only needs the privileges that mount(2) needs too, counts as
+// well.
+func fsmountUnsupported(err error) bool {
+	if errors.Is(err, syscall.ENOSYS) || errors.Is(err, errFsmountFlags) {
+		return true
+	}
+	var se *os.SyscallError
+	return errors.As(err, &se) && se.Syscall == "fsopen" && se.Err == syscall.EPERM
+}
+
+// fsmountAttrs splits the flags of mount(2) into flags of the file
+// system, for fsconfig(2), and attributes of the mount, for
+// fsmount(2).
+func fsmountAttrs(flags uintptr) (sbFlags []string, attrs uintptr, err error) {
+	if flags&_MS_MGC_MSK == syscall.MS_MGC_VAL {
+		flags &^= _MS_MGC_MSK
+	}
+	for _, f := range []struct {
+		ms   uintptr
+		sb   string
+		attr uintptr
+	}{
+		{syscall.MS_RDONLY, "ro", _MOUNT_ATTR_RDONLY},
+		{syscall.MS_SYNCHRONOUS, "sync", 0},
+		{syscall.MS_DIRSYNC, "dirsync", 0},
+		{syscall.MS_NOSUID, "", _MOUNT_ATTR_NOSUID},
+		{syscall.MS_NODEV, "", _MOUNT_ATTR_NODEV},
+		{syscall.MS_NOEXEC, "", _MOUNT_ATTR_NOEXEC},
+		{syscall.MS_NOATIME, "", _MOUNT_ATTR_NOATIME},
+		{syscall.MS_NODIRATIME, "", _MOUNT_ATTR_NODIRATIME},
+	} {
+		if flags&f.ms == 0 {
+			continue
+		}
+		flags &^= f.ms
+		if f.sb != "" {
+			sbFlags = append(sbFlags, f.sb)
+		}
+		attrs |= f.attr
+	}
+	if flags != 0 {
+		return nil, 0, fmt.Errorf("%w: %#x", errFsmountFlags, flags)
+	}
+	return sbFlags, attrs, nil
+}
+
+// fsmountFUSE creates a FUSE mount with the new mount API, without
+// attaching it, and returns its file descriptor. The arguments are
+// those of mount(2), with the options split up.
+func fsmountFUSE(source string, opts *MountOptions, flags uintptr, params []string) (int, error) {
+	sbFlags, attrs, err := fsmountAttrs(flags)
+	if err != nil {
+		return -1, err
+	}
+
+	fsfd, err := fsopen("fuse")
+	if err != nil {
+		return -1, err
+	}
+	defer syscall.Close(fsfd)
+
+	set := func(param string) error {
+		key, value := param, ""
+		cmd := _FSCONFIG_SET_FLAG
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			key, value = param[:i], param[i+1:]
+			cmd = _FSCONFIG_SET_STRING
+		}
+		if err := fsconfig(fsfd, cmd, key, value); err != nil {
+			return fsContextError(fsfd, fmt.Sprintf("fsconfig %q", param), err)
+		}
+		return nil
+	}
+	all := []string{"source=" + source}
+	if opts.Name != "" {
+		all = append(all, "subtype="+opts.Name)
+	}
+	all = append(all, params...)
+	all = append(all, sbFlags...)
+	for _, p := range all {
+		if err := set(p); err != nil {
+			return -1, err
+		}
+	}
+	if err := fsconfig(fsfd, _FSCONFIG_CMD_CREATE, "", ""); err != nil {
+		return -1, fsContextError(fsfd, "fsconfig create", err)
+	}
+
+	mnt, _, errno := syscall.Syscall(_SYS_FSMOUNT, uintptr(fsfd), _FSMOUNT_CLOEXEC, attrs)
+	if errno != 0 {
+		return -1, fsContextError(fsfd, "fsmount", errno)
+	}
+	return int(mnt), nil
+}
+
+func fsopen(fstype string) (int, error) {
+	p, err := syscall.BytePtrFromString(fstype)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := syscall.Syscall(_SYS_FSOPEN, uintptr(unsafe.Pointer(p)), _FSOPEN_CLOEXEC, 0)
+	if errno != 0 {
+		return -1, os.NewSyscallError("fsopen", errno)
+	}
+	return int(fd), nil
+}
+
+// fsconfig runs cmd on the file system context fd. An empty key or
+// value is passed as NULL.
+func fsconfig(fd int, cmd int, key, value string) error {
+	var k, v *byte
+	var err error
+	if key != "" {
+		if k, err = syscall.BytePtrFromString(key); err != nil {
+			return err
+		}
+	}
+	if value != "" || cmd == _FSCONFIG_SET_STRING {
+		if v, err = syscall.BytePtrFromString(value); err != nil {
+			return err
+		}
+	}
+	_, _, errno := syscall.Syscall6(_SYS_FSCONFIG, uintptr(fd), uintptr(cmd),
+		uintptr(unsafe.Pointer(k)), uintptr(unsafe.Pointer(v)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// fsContextError adds the messages that the kernel logged on the file
+// system context fd to err.
+func fsContextError(fd int, what string, err error) error {
+	var msgs []string
+	buf := make([]byte, 1024)
+	for len(msgs) < 8 {
+		n, rerr := syscall.Read(fd, buf)
+		if rerr != nil || n <= 0 {
+			break
+		}
+		// Messages start with "e ", "w " or "i ".
+		msgs = append(msgs, strings.TrimSpace(string(buf[:n])))
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return fmt.Errorf("%s: %w (%s)", what, err, strings.Join(msgs, "; "))
+}
+
+// moveMount attaches the detached mount mnt at target.
+func moveMount(mnt int, target string) error {
+	empty, err := syscall.BytePtrFromString("")
+	if err != nil {
+		return err
+	}
+	to, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	cwd := unix.AT_FDCWD
+	_, _, errno := syscall.Syscall6(_SYS_MOVE_MOUNT, uintptr(mnt), uintptr(unsafe.Pointer(empty)),
+		uintptr(cwd), uintptr(unsafe.Pointer(to)), _MOVE_MOUNT_F_EMPTY_PATH, 0)
+	if errno != 0 {
+		return os.NewSyscallError("move_mount", errno)
+	}
+	return nil
+}
+
+// MoveMount attaches a mount returned by NewDetachedServer at target.
+// To attach it in another mount namespace, call it from a thread that
+// joined that namespace (see setns(2)).
+func MoveMount(mnt *os.File, target string) error {
+	return moveMount(int(mnt.Fd()), target)
+}
+
+// NewDetachedServer mounts fs like NewServer with DirectMount, but
+// does not attach the mount anywhere: it returns the mount as a file
+// from fsmount(2), which the caller can attach with MoveMount, eg. in
+// another mount namespace. As with NewServer, call WaitMount after
+// starting Serve, and before using the mount. The caller must close
+// the file; if the mount was not attached by then, this unmounts it
+// once WaitMount returned. Server.Unmount and Server.UnmountLazy do
+// nothing for such servers; the mount goes away with umount(2) of the
+// place where it was attached.
+//
+// This needs the privileges to mount, and Linux 5.2 or later.
+// MountOptions.DirectMountFlags apply, while AutoUnmount is
+// ignored.
+func NewDetachedServer(fs RawFileSystem, opts *MountOptions) (*Server, *os.File, error) {
+	o := MountOptions{MaxBackground: _DEFAULT_BACKGROUND_TASKS}
+	if opts != nil {
+		o = *opts
+	}
+	// Options may have ',', as they are not joined.
+	o.DirectMount = true
+	ms, err := newServer(fs, "/", &o)
+	if err != nil {
+		return nil, nil, err
+	}
+	ms.mountPoint = ""
+
+	fd, err := syscall.Open("/dev/fuse", os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	source, flags, params := directMountArgs(fd, ms.opts)
+	mnt, err := fsmountFUSE(source, ms.opts, flags, params)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+	mntFile := os.NewFile(uintptr(mnt), "fsmount")
+	dup, err := syscall.Dup(mnt)
+	if err != nil {
+		mntFile.Close()
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+	syscall.CloseOnExec(dup)
+	ms.detachedMount = os.NewFile(uintptr(dup), "fsmount")
+
+	ms.mountFd = fd
+	close(ms.ready)
+	if code := ms.handleInit(); !code.Ok() {
+		ms.detachedMount.Close()
+		mntFile.Close()
+		syscall.Close(fd)
+		return nil, nil, fmt.Errorf("init: %s", code)
+	}
+	// This prepares for Serve being called somewhere, either
+	// synchronously or asynchronously.
+	ms.loops.Add(1)
+	return ms, mntFile, nil
+}
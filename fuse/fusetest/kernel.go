@@ -0,0 +1,320 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fusetest runs a fuse.Server against an in-process fake
+// kernel, so file systems can be tested without mounting, and without
+// the privileges that mounting needs.
+//
+// The fake kernel speaks the FUSE protocol to the server over a socket
+// pair. Its methods send one request each, and wait for the reply.
+// Like the kernel, it counts the lookups of each node ID and tracks
+// open file handles, so tests can check that a file system gets the
+// FORGETs and RELEASEs it expects:
+//
+//	k, err := fusetest.New(fs.NewNodeFS(root, opts), &opts.MountOptions)
+//	...
+//	defer k.Close()
+//	out, err := k.Lookup(fuse.FUSE_ROOT_ID, "file")
+//	fh, err := k.Open(out.NodeId, syscall.O_RDONLY)
+//	data, err := k.Read(out.NodeId, fh, 0, 4096)
+//	err = k.Release(out.NodeId, fh)
+package fusetest
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Kernel is a fake FUSE kernel driving a fuse.Server. Its methods may
+// be called concurrently. Errors from the file system are returned as
+// syscall.Errno.
+type Kernel struct {
+	// Server is the server under test. It is already serving.
+	Server *fuse.Server
+
+	// Caller is sent as the caller of each request.
+	Caller fuse.Caller
+
+	fd, serverFd int
+	bufSize      int
+
+	mu      sync.Mutex
+	unique  uint64
+	pending map[uint64]chan []byte
+	lookups map[uint64]uint64
+	handles map[uint64]uint64
+	readErr error
+
+	readerDone chan struct{}
+	closed     bool
+}
+
+// kernelFlags are the capabilities the fake kernel offers.
+const kernelFlags = fuse.CAP_ASYNC_READ | fuse.CAP_BIG_WRITES | fuse.CAP_PARALLEL_DIROPS |
+	fuse.CAP_EXPORT_SUPPORT | fuse.CAP_MAX_PAGES | fuse.CAP_AUTO_INVAL_DATA
+
+// protocolMinor is the protocol version of the fake kernel.
+const protocolMinor = 31
+
+// New starts a server for fs on a fake kernel. opts may be nil.
+func New(fs fuse.RawFileSystem, opts *fuse.MountOptions) (*Kernel, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		return nil, fmt.Errorf("socketpair: %v", err)
+	}
+	syscall.CloseOnExec(fds[0])
+	syscall.CloseOnExec(fds[1])
+
+	maxWrite := 128 * 1024
+	if opts != nil && opts.MaxWrite > maxWrite {
+		maxWrite = opts.MaxWrite
+	}
+	k := &Kernel{
+		Caller:     fuse.Caller{Owner: fuse.Owner{Uid: uint32(syscall.Getuid()), Gid: uint32(syscall.Getgid())}, Pid: uint32(syscall.Getpid())},
+		fd:         fds[0],
+		serverFd:   fds[1],
+		bufSize:    maxWrite + 4096,
+		pending:    map[uint64]chan []byte{},
+		lookups:    map[uint64]uint64{},
+		handles:    map[uint64]uint64{},
+		readerDone: make(chan struct{}),
+	}
+	go k.readReplies()
+
+	// INIT is answered by NewSocketServer itself.
+	initReply := make(chan []byte, 1)
+	go func() {
+		in := fuse.InitIn{
+			Major:        7,
+			Minor:        protocolMinor,
+			MaxReadAhead: 128 * 1024,
+			Flags:        uint32(kernelFlags),
+		}
+		data, err := k.call(opInit, 0, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+		if err != nil {
+			data = nil
+		}
+		initReply <- data
+	}()
+
+	srv, err := fuse.NewSocketServer(fs, k.serverFd, opts)
+	if err == nil && <-initReply == nil {
+		err = fmt.Errorf("INIT failed")
+	}
+	if err != nil {
+		k.shutdown()
+		syscall.Close(k.serverFd)
+		return nil, err
+	}
+	k.Server = srv
+	go srv.Serve()
+	return k, nil
+}
+
+// readReplies passes replies to the requests waiting for them, until
+// the socket is closed.
+func (k *Kernel) readReplies() {
+	defer close(k.readerDone)
+	buf := make([]byte, k.bufSize)
+	for {
+		n, err := syscall.Read(k.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == nil && n == 0 {
+			err = syscall.ENOTCONN
+		}
+		if err != nil {
+			k.mu.Lock()
+			k.readErr = err
+			for u, ch := range k.pending {
+				close(ch)
+				delete(k.pending, u)
+			}
+			k.mu.Unlock()
+			return
+		}
+		if n < int(unsafe.Sizeof(fuse.OutHeader{})) {
+			log.Printf("fusetest: short reply of %d bytes", n)
+			continue
+		}
+		h := (*fuse.OutHeader)(unsafe.Pointer(&buf[0]))
+		if h.Unique == 0 {
+			// A notification; the fake kernel has no caches
+			// to invalidate.
+			continue
+		}
+		k.mu.Lock()
+		ch := k.pending[h.Unique]
+		delete(k.pending, h.Unique)
+		k.mu.Unlock()
+		if ch == nil {
+			log.Printf("fusetest: reply to unknown request %d", h.Unique)
+			continue
+		}
+		ch <- append([]byte(nil), buf[:n]...)
+	}
+}
+
+// send writes a request. The struct at in, of size inSize, must start
+// with a fuse.InHeader, which send fills in. If wait is set, send
+// returns a channel for the reply.
+func (k *Kernel) send(opcode uint32, node uint64, in unsafe.Pointer, inSize uintptr, data []byte, wait bool) (chan []byte, error) {
+	msg := make([]byte, int(inSize)+len(data))
+	copy(msg, (*[1 << 20]byte)(in)[:inSize])
+	copy(msg[inSize:], data)
+
+	k.mu.Lock()
+	if k.closed || k.readErr != nil {
+		k.mu.Unlock()
+		return nil, syscall.ENOTCONN
+	}
+	k.unique += 2
+	h := (*fuse.InHeader)(unsafe.Pointer(&msg[0]))
+	*h = fuse.InHeader{
+		Length: uint32(len(msg)),
+		Opcode: opcode,
+		Unique: k.unique,
+		NodeId: node,
+		Caller: k.Caller,
+	}
+	var ch chan []byte
+	if wait {
+		ch = make(chan []byte, 1)
+		k.pending[h.Unique] = ch
+	}
+	k.mu.Unlock()
+
+	if _, err := syscall.Write(k.fd, msg); err != nil {
+		if wait {
+			k.mu.Lock()
+			delete(k.pending, h.Unique)
+			k.mu.Unlock()
+		}
+		return nil, err
+	}
+	return ch, nil
+}
+
+// call sends a request and returns the reply data after the
+// OutHeader, or the error status.
+func (k *Kernel) call(opcode uint32, node uint64, in unsafe.Pointer, inSize uintptr, data []byte) ([]byte, error) {
+	ch, err := k.send(opcode, node, in, inSize, data, true)
+	if err != nil {
+		return nil, err
+	}
+	reply, ok := <-ch
+	if !ok {
+		return nil, syscall.ENOTCONN
+	}
+	h := (*fuse.OutHeader)(unsafe.Pointer(&reply[0]))
+	if h.Status != 0 {
+		return nil, syscall.Errno(-h.Status)
+	}
+	return reply[unsafe.Sizeof(fuse.OutHeader{}):], nil
+}
+
+// callHeader sends a request that has no arguments besides names.
+func (k *Kernel) callHeader(opcode uint32, node uint64, names ...string) ([]byte, error) {
+	var h fuse.InHeader
+	return k.call(opcode, node, unsafe.Pointer(&h), unsafe.Sizeof(h), nameBytes(names...))
+}
+
+// nameBytes encodes file name arguments.
+func nameBytes(names ...string) []byte {
+	var b []byte
+	for _, n := range names {
+		b = append(b, n...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+// decode copies the start of data into the struct at out.
+func decode(data []byte, out unsafe.Pointer, size uintptr) error {
+	if uintptr(len(data)) < size {
+		return fmt.Errorf("fusetest: reply has %d bytes, want %d", len(data), size)
+	}
+	copy((*[1 << 20]byte)(out)[:size], data)
+	return nil
+}
+
+// NextUnique returns the unique ID that the next request will get,
+// if no other requests are sent concurrently. Unique IDs are even,
+// and increase by 2 for each request, as in the kernel.
+func (k *Kernel) NextUnique() uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.unique + 2
+}
+
+// Lookups returns the lookup count of a node ID, ie. how many
+// FORGETs the kernel owes the file system.
+func (k *Kernel) Lookups(node uint64) uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lookups[node]
+}
+
+// OpenHandles returns the number of file and directory handles that
+// were opened and not released.
+func (k *Kernel) OpenHandles() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.handles)
+}
+
+func (k *Kernel) addLookup(out *fuse.EntryOut) {
+	if out.NodeId == 0 {
+		// Negative entry.
+		return
+	}
+	k.mu.Lock()
+	k.lookups[out.NodeId]++
+	k.mu.Unlock()
+}
+
+// Close forgets all node IDs, like the kernel does on unmount, and
+// stops the server. It returns an error if file handles are still
+// open.
+func (k *Kernel) Close() error {
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return nil
+	}
+	lookups := k.lookups
+	k.lookups = map[uint64]uint64{}
+	open := len(k.handles)
+	k.mu.Unlock()
+
+	for node, n := range lookups {
+		k.sendForget(node, n)
+	}
+	var h fuse.InHeader
+	k.call(opDestroy, 0, unsafe.Pointer(&h), unsafe.Sizeof(h), nil)
+
+	// Serve closes the server end.
+	k.shutdown()
+	k.Server.Wait()
+	if open > 0 {
+		return fmt.Errorf("fusetest: %d handles still open", open)
+	}
+	return nil
+}
+
+// shutdown closes the kernel end of the socket, which ends Serve.
+func (k *Kernel) shutdown() {
+	k.mu.Lock()
+	k.closed = true
+	k.mu.Unlock()
+	syscall.Shutdown(k.fd, syscall.SHUT_RDWR)
+	<-k.readerDone
+	syscall.Close(k.fd)
+}
@@ -0,0 +1,207 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fusetest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+func newLoopback(t *testing.T) (*Kernel, string) {
+	dir := testutil.TempDir()
+	root, err := fs.NewLoopbackRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &fs.Options{}
+	k, err := New(fs.NewNodeFS(root, opts), &opts.MountOptions)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return k, dir
+}
+
+func TestKernelFileOps(t *testing.T) {
+	k, dir := newLoopback(t)
+	defer os.RemoveAll(dir)
+
+	out, fh, err := k.Create(fuse.FUSE_ROOT_ID, "file", syscall.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	file := out.NodeId
+	want := []byte("hello world")
+	if n, err := k.Write(file, fh, 0, want); err != nil || n != len(want) {
+		t.Fatalf("Write: %d, %v", n, err)
+	}
+	if got, err := k.Read(file, fh, 6, 100); err != nil || string(got) != "world" {
+		t.Fatalf("Read: %q, %v", got, err)
+	}
+	if err := k.Flush(file, fh); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := k.Release(file, fh); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(dir, "file")); err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("backing file: %q, %v", got, err)
+	}
+
+	attr, err := k.GetAttr(file)
+	if err != nil {
+		t.Fatalf("GetAttr: %v", err)
+	}
+	if attr.Size != uint64(len(want)) || attr.Mode&syscall.S_IFMT != syscall.S_IFREG {
+		t.Errorf("GetAttr: got size %d mode %o", attr.Size, attr.Mode)
+	}
+
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "nonexistent"); err != syscall.ENOENT {
+		t.Errorf("Lookup nonexistent: got %v, want ENOENT", err)
+	}
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "file"); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got := k.Lookups(file); got != 2 {
+		t.Errorf("got %d lookups, want 2", got)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestKernelDirOps(t *testing.T) {
+	k, dir := newLoopback(t)
+	defer os.RemoveAll(dir)
+	defer k.Close()
+
+	sub, err := k.Mkdir(fuse.FUSE_ROOT_ID, "sub", 0755)
+	if err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	for _, n := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "sub", n), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := k.ReadDir(sub.NodeId)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	if got := names; len(got) != 4 || got[0] != "." || got[1] != ".." || got[2] != "a" || got[3] != "b" {
+		t.Errorf("ReadDir: got %q", got)
+	}
+	if n := k.OpenHandles(); n != 0 {
+		t.Errorf("got %d open handles after ReadDir", n)
+	}
+
+	if err := k.Rename(sub.NodeId, "a", fuse.FUSE_ROOT_ID, "c"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c")); err != nil {
+		t.Errorf("after Rename: %v", err)
+	}
+	if err := k.Unlink(fuse.FUSE_ROOT_ID, "c"); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	if err := k.Rmdir(fuse.FUSE_ROOT_ID, "sub"); err != syscall.ENOTEMPTY {
+		t.Errorf("Rmdir nonempty: got %v, want ENOTEMPTY", err)
+	}
+	if err := k.Unlink(sub.NodeId, "b"); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	if err := k.Rmdir(fuse.FUSE_ROOT_ID, "sub"); err != nil {
+		t.Fatalf("Rmdir: %v", err)
+	}
+}
+
+type lookupRoot struct {
+	fs.Inode
+}
+
+func (r *lookupRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if name != "file" {
+		return nil, syscall.ENOENT
+	}
+	return r.NewInode(ctx, &fs.MemRegularFile{Data: []byte("x")}, fs.StableAttr{}), 0
+}
+
+func TestKernelForget(t *testing.T) {
+	root := &lookupRoot{}
+	opts := &fs.Options{}
+	k, err := New(fs.NewNodeFS(root, opts), &opts.MountOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	out, err := k.Lookup(fuse.FUSE_ROOT_ID, "file")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	fh, err := k.Open(out.NodeId, syscall.O_RDONLY)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got, err := k.Read(out.NodeId, fh, 0, 10); err != nil || string(got) != "x" {
+		t.Errorf("Read: %q, %v", got, err)
+	}
+	if err := k.Release(out.NodeId, fh); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := k.Release(out.NodeId, fh); err == nil {
+		t.Errorf("second Release succeeded")
+	}
+	if root.GetChild("file") == nil {
+		t.Fatalf("child missing before Forget")
+	}
+
+	if err := k.Forget(out.NodeId, 2); err == nil {
+		t.Errorf("Forget of more lookups than held succeeded")
+	}
+	if err := k.Forget(out.NodeId, 1); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if got := k.Lookups(out.NodeId); got != 0 {
+		t.Errorf("got %d lookups after Forget", got)
+	}
+
+	// FORGET has no reply, so poll for its effect.
+	deadline := time.Now().Add(5 * time.Second)
+	for root.GetChild("file") != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("child still present after Forget")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKernelCloseOpenHandle(t *testing.T) {
+	k, dir := newLoopback(t)
+	defer os.RemoveAll(dir)
+	if _, _, err := k.Create(fuse.FUSE_ROOT_ID, "file", syscall.O_WRONLY, 0644); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := k.Close(); err == nil {
+		t.Errorf("Close with open handle succeeded")
+	}
+}
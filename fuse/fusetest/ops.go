@@ -0,0 +1,306 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fusetest
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Opcodes of the FUSE protocol, see linux/fuse.h.
+const (
+	opLookup     = 1
+	opForget     = 2
+	opGetAttr    = 3
+	opMkdir      = 9
+	opUnlink     = 10
+	opRmdir      = 11
+	opRename     = 12
+	opOpen       = 14
+	opRead       = 15
+	opWrite      = 16
+	opRelease    = 18
+	opFlush      = 25
+	opInit       = 26
+	opOpenDir    = 27
+	opReadDir    = 28
+	opReleaseDir = 29
+	opCreate     = 35
+	opInterrupt  = 36
+	opDestroy    = 38
+)
+
+// Lookup looks up name in the directory parent. If the entry exists,
+// its lookup count is incremented.
+func (k *Kernel) Lookup(parent uint64, name string) (*fuse.EntryOut, error) {
+	data, err := k.callHeader(opLookup, parent, name)
+	if err != nil {
+		return nil, err
+	}
+	return k.entry(data)
+}
+
+// entry decodes an EntryOut reply, and counts the lookup.
+func (k *Kernel) entry(data []byte) (*fuse.EntryOut, error) {
+	out := &fuse.EntryOut{}
+	if err := decode(data, unsafe.Pointer(out), unsafe.Sizeof(*out)); err != nil {
+		return nil, err
+	}
+	k.addLookup(out)
+	return out, nil
+}
+
+// Forget drops n lookups of node. It returns an error if the kernel
+// does not hold that many.
+func (k *Kernel) Forget(node, n uint64) error {
+	k.mu.Lock()
+	have := k.lookups[node]
+	if n > have {
+		k.mu.Unlock()
+		return fmt.Errorf("fusetest: forget %d of node %d, which has %d lookups", n, node, have)
+	}
+	if have == n {
+		delete(k.lookups, node)
+	} else {
+		k.lookups[node] = have - n
+	}
+	k.mu.Unlock()
+	return k.sendForget(node, n)
+}
+
+// sendForget sends FORGET, which has no reply.
+func (k *Kernel) sendForget(node, n uint64) error {
+	in := fuse.ForgetIn{Nlookup: n}
+	_, err := k.send(opForget, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil, false)
+	return err
+}
+
+// GetAttr returns the attributes of node.
+func (k *Kernel) GetAttr(node uint64) (*fuse.AttrOut, error) {
+	var in fuse.GetAttrIn
+	data, err := k.call(opGetAttr, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+	if err != nil {
+		return nil, err
+	}
+	out := &fuse.AttrOut{}
+	if err := decode(data, unsafe.Pointer(out), unsafe.Sizeof(*out)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Open opens node with the given open(2) flags, and returns the file
+// handle.
+func (k *Kernel) Open(node uint64, flags uint32) (uint64, error) {
+	in := fuse.OpenIn{Flags: flags}
+	data, err := k.call(opOpen, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+	if err != nil {
+		return 0, err
+	}
+	return k.opened(node, data)
+}
+
+// opened decodes an OpenOut reply, and records the handle.
+func (k *Kernel) opened(node uint64, data []byte) (uint64, error) {
+	var out fuse.OpenOut
+	if err := decode(data, unsafe.Pointer(&out), unsafe.Sizeof(out)); err != nil {
+		return 0, err
+	}
+	k.mu.Lock()
+	k.handles[out.Fh] = node
+	k.mu.Unlock()
+	return out.Fh, nil
+}
+
+// Create creates and opens name in the directory parent. The new
+// entry counts as a lookup.
+func (k *Kernel) Create(parent uint64, name string, flags, mode uint32) (*fuse.EntryOut, uint64, error) {
+	in := fuse.CreateIn{Flags: flags, Mode: mode}
+	data, err := k.call(opCreate, parent, unsafe.Pointer(&in), unsafe.Sizeof(in), nameBytes(name))
+	if err != nil {
+		return nil, 0, err
+	}
+	out, err := k.entry(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	fh, err := k.opened(out.NodeId, data[unsafe.Sizeof(*out):])
+	return out, fh, err
+}
+
+// Read reads up to size bytes at off from an open file.
+func (k *Kernel) Read(node, fh uint64, off int64, size int) ([]byte, error) {
+	in := fuse.ReadIn{Fh: fh, Offset: uint64(off), Size: uint32(size)}
+	return k.call(opRead, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+}
+
+// Write writes data at off to an open file, and returns the number of
+// bytes written.
+func (k *Kernel) Write(node, fh uint64, off int64, data []byte) (int, error) {
+	in := fuse.WriteIn{Fh: fh, Offset: uint64(off), Size: uint32(len(data))}
+	reply, err := k.call(opWrite, node, unsafe.Pointer(&in), unsafe.Sizeof(in), data)
+	if err != nil {
+		return 0, err
+	}
+	var out fuse.WriteOut
+	if err := decode(reply, unsafe.Pointer(&out), unsafe.Sizeof(out)); err != nil {
+		return 0, err
+	}
+	return int(out.Size), nil
+}
+
+// Flush sends FLUSH for an open file, as close(2) does.
+func (k *Kernel) Flush(node, fh uint64) error {
+	in := fuse.FlushIn{Fh: fh}
+	_, err := k.call(opFlush, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+	return err
+}
+
+// Release closes a file handle returned by Open or Create.
+func (k *Kernel) Release(node, fh uint64) error {
+	return k.release(opRelease, node, fh)
+}
+
+func (k *Kernel) release(opcode uint32, node, fh uint64) error {
+	k.mu.Lock()
+	n, ok := k.handles[fh]
+	if ok && n == node {
+		delete(k.handles, fh)
+	}
+	k.mu.Unlock()
+	if !ok || n != node {
+		return fmt.Errorf("fusetest: handle %d is not open on node %d", fh, node)
+	}
+
+	in := fuse.ReleaseIn{Fh: fh}
+	_, err := k.call(opcode, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+	return err
+}
+
+// Mkdir creates a directory. The new entry counts as a lookup.
+func (k *Kernel) Mkdir(parent uint64, name string, mode uint32) (*fuse.EntryOut, error) {
+	in := fuse.MkdirIn{Mode: mode}
+	data, err := k.call(opMkdir, parent, unsafe.Pointer(&in), unsafe.Sizeof(in), nameBytes(name))
+	if err != nil {
+		return nil, err
+	}
+	return k.entry(data)
+}
+
+// Unlink removes a file.
+func (k *Kernel) Unlink(parent uint64, name string) error {
+	_, err := k.callHeader(opUnlink, parent, name)
+	return err
+}
+
+// Rmdir removes a directory.
+func (k *Kernel) Rmdir(parent uint64, name string) error {
+	_, err := k.callHeader(opRmdir, parent, name)
+	return err
+}
+
+// Rename moves oldName in oldParent to newName in newParent.
+func (k *Kernel) Rename(oldParent uint64, oldName string, newParent uint64, newName string) error {
+	in := fuse.Rename1In{Newdir: newParent}
+	_, err := k.call(opRename, oldParent, unsafe.Pointer(&in), unsafe.Sizeof(in), nameBytes(oldName, newName))
+	return err
+}
+
+// direntHeader is the fixed part of an entry in a READDIR reply.
+type direntHeader struct {
+	Ino     uint64
+	Off     uint64
+	NameLen uint32
+	Typ     uint32
+}
+
+// ReadDir opens the directory node, reads all of its entries, and
+// closes it again. Like getdents(2), the entries include "." and ".."
+// if the file system returns them.
+func (k *Kernel) ReadDir(node uint64) ([]fuse.DirEntry, error) {
+	var oin fuse.OpenIn
+	data, err := k.call(opOpenDir, node, unsafe.Pointer(&oin), unsafe.Sizeof(oin), nil)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := k.opened(node, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fuse.DirEntry
+	var off uint64
+	for {
+		in := fuse.ReadIn{Fh: fh, Offset: off, Size: 8192}
+		data, err = k.call(opReadDir, node, unsafe.Pointer(&in), unsafe.Sizeof(in), nil)
+		if err != nil || len(data) == 0 {
+			break
+		}
+		for len(data) > 0 {
+			var d direntHeader
+			hdrSize := int(unsafe.Sizeof(d))
+			if err = decode(data, unsafe.Pointer(&d), uintptr(hdrSize)); err != nil {
+				break
+			}
+			if hdrSize+int(d.NameLen) > len(data) {
+				err = fmt.Errorf("fusetest: truncated directory entry")
+				break
+			}
+			entries = append(entries, fuse.DirEntry{
+				Ino:  d.Ino,
+				Mode: d.Typ << 12,
+				Name: string(data[hdrSize : hdrSize+int(d.NameLen)]),
+			})
+			off = d.Off
+			// Entries are padded to 8 bytes.
+			l := (hdrSize + int(d.NameLen) + 7) &^ 7
+			if l > len(data) {
+				l = len(data)
+			}
+			data = data[l:]
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if rerr := k.release(opReleaseDir, node, fh); err == nil {
+		err = rerr
+	}
+	return entries, err
+}
+
+// Interrupt sends an INTERRUPT for the request with the given unique
+// ID, and waits up to wait for a reply. The server only replies if it
+// cannot apply the interrupt, so Interrupt returns nil if no reply
+// came, and the error of the reply otherwise (normally EAGAIN).
+func (k *Kernel) Interrupt(unique uint64, wait time.Duration) error {
+	in := fuse.InterruptIn{Unique: unique}
+	ch, err := k.send(opInterrupt, 0, unsafe.Pointer(&in), unsafe.Sizeof(in), nil, true)
+	if err != nil {
+		return err
+	}
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return syscall.ENOTCONN
+		}
+		h := (*fuse.OutHeader)(unsafe.Pointer(&reply[0]))
+		return syscall.Errno(-h.Status)
+	case <-time.After(wait):
+		k.mu.Lock()
+		for u, c := range k.pending {
+			if c == ch {
+				delete(k.pending, u)
+			}
+		}
+		k.mu.Unlock()
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// InflightRequest describes a request that was read from the kernel
+// but not answered yet.
+type InflightRequest struct {
+	Unique uint64
+
+	// Op is the name of the opcode, eg. "LOOKUP".
+	Op     string
+	NodeId uint64
+
+	// Names has the file name arguments, eg. for LOOKUP. It is
+	// empty until the request is parsed.
+	Names []string
+
+	// Caller is the process that issued the request. The kernel
+	// reports its thread ID as Pid.
+	Caller Caller
+
+	// Process is the command name of the caller, or "" if it
+	// cannot be found, eg. because it exited.
+	Process string
+
+	// Age is the time since the request was read.
+	Age time.Duration
+
+	// Interrupted is set if the request was canceled, by an
+	// INTERRUPT from the kernel or a timeout. TimedOut is set if
+	// the request was answered because of its timeout, while the
+	// file system still works on it.
+	Interrupted bool
+	TimedOut    bool
+}
+
+func (r *InflightRequest) String() string {
+	names := ""
+	if len(r.Names) > 0 {
+		names = fmt.Sprintf(" %q", r.Names)
+	}
+	intr := ""
+	if r.TimedOut {
+		intr = ", timed out"
+	} else if r.Interrupted {
+		intr = ", interrupted"
+	}
+	return fmt.Sprintf("%d: %s n%d%s from pid %d (%s) uid %d, %v%s",
+		r.Unique, r.Op, r.NodeId, names, r.Caller.Pid, r.Process,
+		r.Caller.Uid, r.Age.Round(time.Microsecond), intr)
+}
+
+// InflightRequests returns the requests that the server is working
+// on, oldest first.
+func (ms *Server) InflightRequests() []InflightRequest {
+	now := time.Now()
+	ms.reqMu.Lock()
+	r := make([]InflightRequest, 0, len(ms.reqInflight))
+	for _, req := range ms.reqInflight {
+		r = append(r, req.inflightInfo(now))
+	}
+	ms.reqMu.Unlock()
+
+	sort.Slice(r, func(i, j int) bool { return r[i].Age > r[j].Age })
+	for i := range r {
+		r[i].Process = processName(r[i].Caller.Pid)
+	}
+	return r
+}
+
+// inflightInfo describes req, which must be in flight. It must be
+// called under Server.reqMu.
+func (r *request) inflightInfo(now time.Time) InflightRequest {
+	info := InflightRequest{
+		Unique:      r.inHeader.Unique,
+		Op:          operationName(r.inHeader.Opcode),
+		NodeId:      r.inHeader.NodeId,
+		Caller:      r.inHeader.Caller,
+		Age:         now.Sub(r.startTime),
+		Interrupted: r.interrupted,
+		TimedOut:    r.timedOut,
+	}
+	// The serving goroutine parses the request without holding
+	// reqMu.
+	if atomic.LoadUint32(&r.parsed) != 0 {
+		info.Names = r.filenames
+	}
+	return info
+}
+
+// processName returns the command name of a process or thread.
+func processName(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// watchStuck logs a warning for each request that is in flight for
+// longer than MountOptions.StuckRequestThreshold, until stop is
+// closed.
+func (ms *Server) watchStuck(stop <-chan struct{}) {
+	threshold := ms.opts.StuckRequestThreshold
+	interval := threshold / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		var stuck []InflightRequest
+		var goids []int64
+		ms.reqMu.Lock()
+		for _, req := range ms.reqInflight {
+			if req.stuckWarned || now.Sub(req.startTime) < threshold {
+				continue
+			}
+			req.stuckWarned = true
+			stuck = append(stuck, req.inflightInfo(now))
+			goids = append(goids, atomic.LoadInt64(&req.goroutine))
+		}
+		ms.reqMu.Unlock()
+		if len(stuck) == 0 {
+			continue
+		}
+
+		stacks := allStacks()
+		for i := range stuck {
+			stuck[i].Process = processName(stuck[i].Caller.Pid)
+			stack := goroutineStack(stacks, goids[i])
+			if stack == "" {
+				stack = "(stack not found)"
+			}
+			log.Printf("request in flight for more than %v: %v\n%s", threshold, &stuck[i], stack)
+		}
+	}
+}
+
+// goroutineID returns the ID of the current goroutine.
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	// "goroutine 123 [running]: ..."
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// allStacks returns the stacks of all goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineStack returns the stack of goroutine id from the output of
+// allStacks, or "" if it is not there.
+func goroutineStack(stacks []byte, id int64) string {
+	if id == 0 {
+		return ""
+	}
+	prefix := fmt.Sprintf("goroutine %d [", id)
+	for _, s := range bytes.Split(stacks, []byte("\n\n")) {
+		if bytes.HasPrefix(s, []byte(prefix)) {
+			return string(s)
+		}
+	}
+	return ""
+}
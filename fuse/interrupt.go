@@ -0,0 +1,116 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"log"
+	"time"
+)
+
+// With several readers, an INTERRUPT can be read and handled before
+// the request that it targets. Following the kernel documentation
+// (Documentation/filesystems/fuse.rst), such interrupts are kept for
+// interruptWait, and applied when the request shows up. If it does
+// not, the INTERRUPT is answered with EAGAIN, which makes the kernel
+// send it again if the request is still pending.
+const interruptWait = 10 * time.Millisecond
+
+// completedRingSize is the number of recently answered requests that
+// the server remembers, so INTERRUPTs that lost the race against the
+// reply can be dropped right away.
+const completedRingSize = 256
+
+// pendingInterrupt is an INTERRUPT whose request has not been read
+// yet.
+type pendingInterrupt struct {
+	// header of the INTERRUPT request, and the channel it came
+	// from, which is tried first for the EAGAIN reply.
+	header  InHeader
+	channel *channel
+	timer   *time.Timer
+}
+
+// addInflight adds a request that was read to the requests in flight,
+// and applies an INTERRUPT that came before it. It must be called
+// under reqMu, after parseHeader.
+func (ms *Server) addInflight(req *request) {
+	req.inflightIndex = len(ms.reqInflight)
+	ms.reqInflight = append(ms.reqInflight, req)
+
+	if p := ms.pendingInterrupts[req.inHeader.Unique]; p != nil {
+		delete(ms.pendingInterrupts, req.inHeader.Unique)
+		p.timer.Stop()
+		close(req.cancel)
+		req.interrupted = true
+		if ms.opts.Debug {
+			log.Printf("Applying early INTERRUPT %d to request %d",
+				p.header.Unique, req.inHeader.Unique)
+		}
+	}
+}
+
+// recordCompleted remembers that the request with the given unique ID
+// was answered. It must be called under reqMu.
+func (ms *Server) recordCompleted(unique uint64) {
+	ms.completed[ms.completedNext%completedRingSize] = unique
+	ms.completedNext++
+}
+
+// recentlyCompleted tells if the request with the given unique ID was
+// answered recently. It must be called under reqMu.
+func (ms *Server) recentlyCompleted(unique uint64) bool {
+	for _, u := range ms.completed {
+		if u == unique && u != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// expireInterrupt answers a pending INTERRUPT for target, whose
+// request did not show up, with EAGAIN.
+func (ms *Server) expireInterrupt(target uint64, p *pendingInterrupt) {
+	ms.reqMu.Lock()
+	if ms.pendingInterrupts[target] != p {
+		ms.reqMu.Unlock()
+		return
+	}
+	delete(ms.pendingInterrupts, target)
+	completed := ms.recentlyCompleted(target)
+	// The kernel looks for the target among the requests read
+	// from the channel that the reply is written to. The target
+	// may have been read from another one since, so try them all,
+	// starting with the channel of the INTERRUPT.
+	channels := []*channel{p.channel}
+	for _, ch := range ms.channels {
+		if ch != p.channel {
+			channels = append(channels, ch)
+		}
+	}
+	ms.reqMu.Unlock()
+	if completed {
+		return
+	}
+
+	for _, ch := range channels {
+		reply := request{
+			inHeader: &p.header,
+			handler:  operationHandlers[_OP_INTERRUPT],
+			status:   EAGAIN,
+			channel:  ch,
+		}
+		ms.writeMu.RLock()
+		code := ms.write(&reply)
+		ms.writeMu.RUnlock()
+		// ENOENT means the kernel does not know the request
+		// on this channel.
+		if code != ENOENT {
+			if !code.Ok() && ms.opts.Debug {
+				log.Printf("INTERRUPT %d: EAGAIN reply: %v", p.header.Unique, code)
+			}
+			return
+		}
+	}
+}
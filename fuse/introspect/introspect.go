@@ -0,0 +1,118 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package introspect serves the requests that a fuse.Server is
+// working on over HTTP, to find out what a hanging file system call
+// waits for. It can be added to an existing HTTP server:
+//
+//	http.Handle("/debug/fuse", introspect.Handler(server))
+//
+// or served on a Unix socket, so it is only reachable locally:
+//
+//	l, err := introspect.ListenUnix("/run/myfs.sock", server)
+//	...
+//	defer l.Close()
+//
+// and queried with
+//
+//	curl --unix-socket /run/myfs.sock http://localhost/
+//
+// Add "?format=json" to the URL for JSON output.
+package introspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Request is the JSON form of fuse.InflightRequest.
+type Request struct {
+	Unique      uint64   `json:"unique"`
+	Op          string   `json:"op"`
+	NodeId      uint64   `json:"node_id"`
+	Names       []string `json:"names,omitempty"`
+	Pid         uint32   `json:"pid"`
+	Uid         uint32   `json:"uid"`
+	Gid         uint32   `json:"gid"`
+	Process     string   `json:"process,omitempty"`
+	AgeSeconds  float64  `json:"age_seconds"`
+	Interrupted bool     `json:"interrupted,omitempty"`
+	TimedOut    bool     `json:"timed_out,omitempty"`
+}
+
+type handler struct {
+	srv *fuse.Server
+}
+
+// Handler returns a handler that lists the in-flight requests of srv,
+// oldest first, one per line, or as a JSON array of Request if the
+// "format" query parameter is "json".
+func Handler(srv *fuse.Server) http.Handler {
+	return &handler{srv}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqs := h.srv.InflightRequests()
+	if r.URL.Query().Get("format") == "json" {
+		out := make([]Request, 0, len(reqs))
+		for _, req := range reqs {
+			out = append(out, Request{
+				Unique:      req.Unique,
+				Op:          req.Op,
+				NodeId:      req.NodeId,
+				Names:       req.Names,
+				Pid:         req.Caller.Pid,
+				Uid:         req.Caller.Uid,
+				Gid:         req.Caller.Gid,
+				Process:     req.Process,
+				AgeSeconds:  req.Age.Seconds(),
+				Interrupted: req.Interrupted,
+				TimedOut:    req.TimedOut,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%d requests in flight at %s\n", len(reqs), time.Now().Format(time.RFC3339))
+	for i := range reqs {
+		fmt.Fprintln(w, &reqs[i])
+	}
+}
+
+// ListenUnix serves Handler(srv) on a Unix socket at path, replacing a
+// stale socket left by a previous process. Closing the returned
+// Closer stops serving and removes the socket.
+func ListenUnix(path string, srv *fuse.Server) (io.Closer, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	hs := &http.Server{Handler: Handler(srv)}
+	go hs.Serve(l)
+	return &unixServer{hs, path}, nil
+}
+
+type unixServer struct {
+	hs   *http.Server
+	path string
+}
+
+func (s *unixServer) Close() error {
+	err := s.hs.Close()
+	os.Remove(s.path)
+	return err
+}
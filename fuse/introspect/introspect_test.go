@@ -0,0 +1,196 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package introspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/fusetest"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// hangRoot blocks LOOKUP until release is closed.
+type hangRoot struct {
+	fs.Inode
+	release chan struct{}
+}
+
+func (r *hangRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	<-r.release
+	return nil, syscall.ENOENT
+}
+
+// syncBuffer is a log output that can be read while it is written.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestInflight(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	root := &hangRoot{release: make(chan struct{})}
+	opts := &fs.Options{}
+	opts.StuckRequestThreshold = 50 * time.Millisecond
+	k, err := fusetest.New(fs.NewNodeFS(root, opts), &opts.MountOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := k.Lookup(fuse.FUSE_ROOT_ID, "hanging")
+		done <- err
+	}()
+
+	var reqs []fuse.InflightRequest
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		reqs = k.Server.InflightRequests()
+		if len(reqs) > 0 && len(reqs[0].Names) > 0 {
+			break
+		}
+	}
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests in flight, want 1", len(reqs))
+	}
+	got := reqs[0]
+	if got.Op != "LOOKUP" || got.NodeId != fuse.FUSE_ROOT_ID || len(got.Names) != 1 || got.Names[0] != "hanging" {
+		t.Errorf("got %v", &got)
+	}
+	if got.Caller.Pid != uint32(os.Getpid()) || got.Caller.Uid != uint32(os.Getuid()) {
+		t.Errorf("got caller %v", got.Caller)
+	}
+	if got.Process == "" {
+		t.Errorf("process name not found")
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(k.Server).ServeHTTP(rec, httptest.NewRequest("GET", "/?format=json", nil))
+	var out []Request
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", rec.Body.String(), err)
+	}
+	if len(out) != 1 || out[0].Op != "LOOKUP" || out[0].Names[0] != "hanging" || out[0].AgeSeconds <= 0 {
+		t.Errorf("got JSON %q", rec.Body.String())
+	}
+
+	for start := time.Now(); !strings.Contains(logs.String(), "in flight for more than"); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("no warning for stuck request; log %q", logs.String())
+		}
+	}
+	if l := logs.String(); !strings.Contains(l, "hangRoot).Lookup") || !strings.Contains(l, `"hanging"`) {
+		t.Errorf("warning lacks request or stack: %q", l)
+	}
+
+	close(root.release)
+	if err := <-done; err != syscall.ENOENT {
+		t.Errorf("Lookup: got %v, want ENOENT", err)
+	}
+	if n := len(k.Server.InflightRequests()); n != 0 {
+		t.Errorf("%d requests in flight after reply", n)
+	}
+}
+
+func TestInflightTimedOut(t *testing.T) {
+	root := &hangRoot{release: make(chan struct{})}
+	opts := &fs.Options{}
+	opts.RequestTimeout = 10 * time.Millisecond
+	k, err := fusetest.New(fs.NewNodeFS(root, opts), &opts.MountOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	defer close(root.release)
+
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "hanging"); err != syscall.EIO {
+		t.Fatalf("Lookup: got %v, want EIO", err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(k.Server).ServeHTTP(rec, httptest.NewRequest("GET", "/?format=json", nil))
+	var out []Request
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", rec.Body.String(), err)
+	}
+	if len(out) != 1 || !out[0].TimedOut || !strings.Contains(rec.Body.String(), `"timed_out":true`) {
+		t.Errorf("got JSON %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(k.Server).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), "timed out") {
+		t.Errorf("got %q", rec.Body.String())
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	opts := &fs.Options{}
+	k, err := fusetest.New(fs.NewNodeFS(&fs.Inode{}, opts), &opts.MountOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	sock := filepath.Join(dir, "sock")
+	for i := 0; i < 2; i++ {
+		// The second round checks that the socket file is
+		// cleaned up.
+		l, err := ListenUnix(sock, k.Server)
+		if err != nil {
+			t.Fatalf("ListenUnix: %v", err)
+		}
+		c := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", sock)
+			},
+		}}
+		resp, err := c.Get("http://localhost/")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.HasPrefix(string(body), "0 requests in flight") {
+			t.Errorf("got %q", body)
+		}
+		l.Close()
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics collects statistics of a fuse.Server per FUSE
+// operation: latency histograms, error counts, and request and reply
+// sizes. Together with the load of the server, they are exported in
+// the Prometheus text format.
+//
+// Typical use:
+//
+//	m := metrics.New(nil)
+//	m.Attach(server)
+//	http.Handle("/metrics", m)
+//	server.Serve()
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// DefaultBuckets are the latency histogram buckets used if
+// Options.Buckets is empty.
+var DefaultBuckets = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Options configures a Metrics.
+type Options struct {
+	// Buckets are the upper bounds of the latency histogram
+	// buckets. They are sorted, and a bucket for larger latencies
+	// is added. If empty, DefaultBuckets is used.
+	Buckets []time.Duration
+
+	// Prefix is put in front of the metric names. If empty,
+	// "fuse" is used, eg. "fuse_request_duration_seconds".
+	Prefix string
+}
+
+// Metrics records the statistics of the requests of a server. It
+// implements fuse.MetricsRecorder, and http.Handler to export them.
+type Metrics struct {
+	buckets []time.Duration
+	prefix  string
+
+	mu     sync.Mutex
+	ops    map[string]*opMetrics
+	server *fuse.Server
+}
+
+// opMetrics has the statistics of one operation.
+type opMetrics struct {
+	// counts has the number of requests per bucket, not
+	// cumulative; the last entry is for latencies above all
+	// buckets.
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+
+	errors   map[fuse.Status]uint64
+	inBytes  uint64
+	outBytes uint64
+}
+
+var _ = (fuse.MetricsRecorder)((*Metrics)(nil))
+var _ = (http.Handler)((*Metrics)(nil))
+
+// New returns an empty Metrics. The options may be nil.
+func New(opts *Options) *Metrics {
+	if opts == nil {
+		opts = &Options{}
+	}
+	buckets := append([]time.Duration(nil), opts.Buckets...)
+	if len(buckets) == 0 {
+		buckets = append(buckets, DefaultBuckets...)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = "fuse"
+	}
+	return &Metrics{
+		buckets: buckets,
+		prefix:  prefix,
+		ops:     map[string]*opMetrics{},
+	}
+}
+
+// Attach makes the server record its requests in m, and adds the load
+// of the server (see fuse.Server.LoadStats and ChannelStats) to the
+// exported metrics. It should be called before Serve.
+func (m *Metrics) Attach(srv *fuse.Server) {
+	m.mu.Lock()
+	m.server = srv
+	m.mu.Unlock()
+	srv.RecordMetrics(m)
+}
+
+// RecordRequest implements fuse.MetricsRecorder.
+func (m *Metrics) RecordRequest(r *fuse.RequestMetrics) {
+	b := sort.Search(len(m.buckets), func(i int) bool {
+		return r.Latency <= m.buckets[i]
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op := m.ops[r.Op]
+	if op == nil {
+		op = &opMetrics{
+			counts: make([]uint64, len(m.buckets)+1),
+			errors: map[fuse.Status]uint64{},
+		}
+		m.ops[r.Op] = op
+	}
+	op.counts[b]++
+	op.count++
+	op.sum += r.Latency
+	if r.Status != fuse.OK {
+		op.errors[r.Status]++
+	}
+	op.inBytes += uint64(r.InBytes)
+	op.outBytes += uint64(r.OutBytes)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteText(w)
+}
+
+// WriteText writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	m.mu.Lock()
+	srv := m.server
+	names := make([]string, 0, len(m.ops))
+	for name := range m.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m.header(bw, "request_duration_seconds", "histogram", "Latency of FUSE requests.")
+	for _, name := range names {
+		op := m.ops[name]
+		var cum uint64
+		for i, c := range op.counts {
+			cum += c
+			le := "+Inf"
+			if i < len(m.buckets) {
+				le = seconds(m.buckets[i])
+			}
+			fmt.Fprintf(bw, "%s_request_duration_seconds_bucket{op=%q,le=%q} %d\n", m.prefix, name, le, cum)
+		}
+		fmt.Fprintf(bw, "%s_request_duration_seconds_sum{op=%q} %s\n", m.prefix, name, seconds(op.sum))
+		fmt.Fprintf(bw, "%s_request_duration_seconds_count{op=%q} %d\n", m.prefix, name, op.count)
+	}
+
+	m.header(bw, "request_errors_total", "counter", "FUSE requests that failed, by errno.")
+	for _, name := range names {
+		op := m.ops[name]
+		codes := make([]int, 0, len(op.errors))
+		for code := range op.errors {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(bw, "%s_request_errors_total{op=%q,errno=\"%d\"} %d\n",
+				m.prefix, name, code, op.errors[fuse.Status(code)])
+		}
+	}
+
+	m.header(bw, "request_bytes_total", "counter", "Bytes received in FUSE requests, including WRITE data.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "%s_request_bytes_total{op=%q} %d\n", m.prefix, name, m.ops[name].inBytes)
+	}
+	m.header(bw, "reply_bytes_total", "counter", "Bytes sent in FUSE replies, including READ data.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "%s_reply_bytes_total{op=%q} %d\n", m.prefix, name, m.ops[name].outBytes)
+	}
+	m.mu.Unlock()
+
+	if srv != nil {
+		load := srv.LoadStats()
+		m.header(bw, "requests_inflight", "gauge", "FUSE requests being processed.")
+		fmt.Fprintf(bw, "%s_requests_inflight %d\n", m.prefix, load.Inflight)
+		m.header(bw, "readers", "gauge", "Goroutines waiting for FUSE requests.")
+		fmt.Fprintf(bw, "%s_readers %d\n", m.prefix, load.Readers)
+		m.header(bw, "max_readers", "gauge", "Limit on goroutines waiting for FUSE requests.")
+		fmt.Fprintf(bw, "%s_max_readers %d\n", m.prefix, load.MaxReaders)
+
+		channels := srv.ChannelStats()
+		m.header(bw, "channel_readers", "gauge", "Goroutines waiting for FUSE requests, by channel.")
+		for i, ch := range channels {
+			fmt.Fprintf(bw, "%s_channel_readers{channel=\"%d\"} %d\n", m.prefix, i, ch.Readers)
+		}
+		m.header(bw, "channel_requests_total", "counter", "FUSE requests read, by channel.")
+		for i, ch := range channels {
+			fmt.Fprintf(bw, "%s_channel_requests_total{channel=\"%d\"} %d\n", m.prefix, i, ch.Requests)
+		}
+
+		if sched := srv.SchedulerStats(); sched != nil {
+			m.header(bw, "scheduler_queued", "gauge", "FUSE requests waiting for a worker, by class.")
+			for _, st := range sched {
+				fmt.Fprintf(bw, "%s_scheduler_queued{class=%q} %d\n", m.prefix, st.Class, st.Queued)
+			}
+			m.header(bw, "scheduler_running", "gauge", "FUSE requests served by workers, by class.")
+			for _, st := range sched {
+				fmt.Fprintf(bw, "%s_scheduler_running{class=%q} %d\n", m.prefix, st.Class, st.Running)
+			}
+			m.header(bw, "scheduler_limit", "gauge", "Limit on FUSE requests served by workers, by class.")
+			for _, st := range sched {
+				fmt.Fprintf(bw, "%s_scheduler_limit{class=%q} %d\n", m.prefix, st.Class, st.Limit)
+			}
+			m.header(bw, "scheduler_requests_total", "counter", "FUSE requests taken from the queue, by class.")
+			for _, st := range sched {
+				fmt.Fprintf(bw, "%s_scheduler_requests_total{class=%q} %d\n", m.prefix, st.Class, st.Served)
+			}
+			m.header(bw, "scheduler_wait_seconds_total", "counter", "Time FUSE requests spent in the queue, by class.")
+			for _, st := range sched {
+				fmt.Fprintf(bw, "%s_scheduler_wait_seconds_total{class=%q} %s\n", m.prefix, st.Class, seconds(st.Waited))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func (m *Metrics) header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", m.prefix, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", m.prefix, name, typ)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%g", d.Seconds())
+}
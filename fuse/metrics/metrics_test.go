@@ -0,0 +1,57 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestMetricsText(t *testing.T) {
+	m := New(&Options{
+		Buckets: []time.Duration{time.Second, time.Millisecond},
+	})
+	for _, r := range []fuse.RequestMetrics{
+		{Op: "LOOKUP", Latency: 500 * time.Microsecond, InBytes: 50, OutBytes: 144},
+		{Op: "LOOKUP", Latency: 2 * time.Millisecond, Status: fuse.ENOENT, InBytes: 50, OutBytes: 16},
+		{Op: "READ", Latency: 2 * time.Second, InBytes: 80, OutBytes: 4112},
+	} {
+		r := r
+		m.RecordRequest(&r)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"# TYPE fuse_request_duration_seconds histogram\n",
+		`fuse_request_duration_seconds_bucket{op="LOOKUP",le="0.001"} 1` + "\n",
+		`fuse_request_duration_seconds_bucket{op="LOOKUP",le="1"} 2` + "\n",
+		`fuse_request_duration_seconds_bucket{op="LOOKUP",le="+Inf"} 2` + "\n",
+		`fuse_request_duration_seconds_sum{op="LOOKUP"} 0.0025` + "\n",
+		`fuse_request_duration_seconds_count{op="LOOKUP"} 2` + "\n",
+		`fuse_request_duration_seconds_bucket{op="READ",le="1"} 0` + "\n",
+		`fuse_request_duration_seconds_bucket{op="READ",le="+Inf"} 1` + "\n",
+		`fuse_request_errors_total{op="LOOKUP",errno="2"} 1` + "\n",
+		`fuse_request_bytes_total{op="LOOKUP"} 100` + "\n",
+		`fuse_reply_bytes_total{op="READ"} 4112` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in output:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `errors_total{op="READ"`) {
+		t.Errorf("READ has no errors:\n%s", got)
+	}
+	if strings.Contains(got, "inflight") {
+		t.Errorf("load metrics without a server:\n%s", got)
+	}
+}
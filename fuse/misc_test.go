@@ -5,9 +5,18 @@
 package fuse
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
 	"os"
+	"reflect"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestToStatus(t *testing.T) {
@@ -28,3 +37,218 @@ func TestToStatus(t *testing.T) {
 		t.Errorf("Wrong conversion %v != %v", errNo, syscall.ENOENT)
 	}
 }
+
+func TestInitOutFlags2(t *testing.T) {
+	var out InitOut
+	out.setInitFlags(CAP_ASYNC_READ)
+	if out.Flags != CAP_ASYNC_READ || out.Flags2 != 0 {
+		t.Errorf("got Flags %x Flags2 %x, want only ASYNC_READ", out.Flags, out.Flags2)
+	}
+
+	want := InitFlags(CAP_ASYNC_READ | CAP_PASSTHROUGH)
+	out.setInitFlags(want)
+	if out.Flags&CAP_INIT_EXT == 0 {
+		t.Errorf("INIT_EXT not set for flags2 caps: %x", out.Flags)
+	}
+	if got := out.InitFlags(); !got.Has(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestInitUnofferedCapabilities checks that INIT does not grant
+// capabilities that the kernel did not offer.
+func TestInitUnofferedCapabilities(t *testing.T) {
+	ms := &Server{opts: &MountOptions{
+		MaxWrite:        128 * 1024,
+		MaxBackground:   _DEFAULT_BACKGROUND_TASKS,
+		EnableWriteback: true,
+		EnableLocks:     true,
+	}}
+	in := InitIn{
+		Major: _FUSE_KERNEL_VERSION,
+		Minor: _OUR_MINOR_VERSION,
+		Flags: CAP_ASYNC_READ | CAP_POSIX_LOCKS,
+	}
+	req := &request{handler: getHandler(_OP_INIT), inData: unsafe.Pointer(&in)}
+	doInit(ms, req)
+	if !req.status.Ok() {
+		t.Fatalf("INIT: %v", req.status)
+	}
+	out := (*InitOut)(req.outData())
+	if got := out.InitFlags(); got.Has(CAP_WRITEBACK_CACHE) || got.Has(CAP_FLOCK_LOCKS) || !got.Has(CAP_POSIX_LOCKS) {
+		t.Errorf("got reply flags %v, want POSIX_LOCKS without WRITEBACK_CACHE or FLOCK_LOCKS", got)
+	}
+	if got := ms.NegotiatedCapabilities(); got.Has(CAP_WRITEBACK_CACHE) {
+		t.Errorf("got negotiated flags %v, want no WRITEBACK_CACHE", got)
+	}
+
+	// Required capabilities are checked against what was granted.
+	ms.opts.Capabilities.Required = CAP_WRITEBACK_CACHE
+	req = &request{handler: getHandler(_OP_INIT), inData: unsafe.Pointer(&in)}
+	doInit(ms, req)
+	if req.status != ENOTSUP {
+		t.Errorf("INIT with required WRITEBACK_CACHE: got %v, want ENOTSUP", req.status)
+	}
+}
+
+func TestHandoffMessage(t *testing.T) {
+	settings := InitIn{Major: _FUSE_KERNEL_VERSION, Minor: 40, Flags: CAP_ASYNC_READ}
+	inflight := []uint64{3, 7, 1 << 40}
+
+	ho, err := parseHandoff(encodeHandoff(&settings, inflight, "/mnt", 5))
+	if err != nil {
+		t.Fatalf("parseHandoff: %v", err)
+	}
+	if ho.settings != settings {
+		t.Errorf("got settings %v, want %v", &ho.settings, &settings)
+	}
+	if !reflect.DeepEqual(ho.inflight, inflight) {
+		t.Errorf("got in-flight %v, want %v", ho.inflight, inflight)
+	}
+	if ho.mountPoint != "/mnt" || ho.stateLen != 5 {
+		t.Errorf("got mount point %q, state %d bytes; want /mnt, 5 bytes", ho.mountPoint, ho.stateLen)
+	}
+
+	msg := encodeHandoff(&settings, nil, "/mnt", 0)
+	if _, err := parseHandoff(msg[:len(msg)-1]); !errors.Is(err, ErrTakeoverProtocol) {
+		t.Errorf("truncated message: got %v, want ErrTakeoverProtocol", err)
+	}
+
+	msg[4]++
+	if _, err := parseHandoff(msg); !errors.Is(err, ErrTakeoverVersion) {
+		t.Errorf("other version: got %v, want ErrTakeoverVersion", err)
+	}
+
+	if _, err := parseHandoff(encodeTakeoverStatus(syscall.EBUSY)); !errors.Is(err, ErrTakeoverBusy) {
+		t.Errorf("refusal: got %v, want ErrTakeoverBusy", err)
+	}
+}
+
+func TestTakeoverVersionMismatch(t *testing.T) {
+	// A version 1 hello: the header lacks StateLen.
+	v1 := make([]byte, 24)
+	binary.LittleEndian.PutUint32(v1[0:], takeoverMagic)
+	binary.LittleEndian.PutUint32(v1[4:], 1)
+	if _, err := parseTakeoverHeader(v1); !errors.Is(err, ErrTakeoverVersion) {
+		t.Errorf("version 1 hello: got %v, want ErrTakeoverVersion", err)
+	}
+
+	msg := encodeTakeoverStatus(0)
+	if _, err := parseTakeoverHeader(msg[:len(msg)-1]); !errors.Is(err, ErrTakeoverProtocol) {
+		t.Errorf("truncated hello: got %v, want ErrTakeoverProtocol", err)
+	}
+}
+
+func TestReadTakeoverState(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Skipf("socketpair: %v", err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		c, err := net.FileConn(os.NewFile(uintptr(fd), "takeover"))
+		syscall.Close(fd)
+		if err != nil {
+			t.Fatalf("FileConn: %v", err)
+		}
+		defer c.Close()
+		conns[i] = c.(*net.UnixConn)
+	}
+
+	// A size from a bad peer must not be allocated up front.
+	if _, err := readTakeoverState(conns[0], 1<<62); !errors.Is(err, ErrTakeoverProtocol) {
+		t.Errorf("huge state: got %v, want ErrTakeoverProtocol", err)
+	}
+
+	conns[1].Write([]byte("hello, "))
+	conns[1].Write([]byte("world"))
+	state, err := readTakeoverState(conns[0], 12)
+	if err != nil || string(state) != "hello, world" {
+		t.Errorf("got %q, %v; want %q", state, err, "hello, world")
+	}
+}
+
+func TestSetTimeouts(t *testing.T) {
+	ms := &Server{opts: &MountOptions{RequestTimeout: time.Second}}
+	if err := ms.setTimeouts(); err != nil {
+		t.Fatalf("setTimeouts: %v", err)
+	}
+	if got := ms.timeouts[_OP_LOOKUP]; got != time.Second {
+		t.Errorf("LOOKUP: got %v, want 1s", got)
+	}
+	for _, op := range []uint32{_OP_SETLKW, _OP_FORGET} {
+		if got := ms.timeouts[op]; got != 0 {
+			t.Errorf("%s: got %v, want no timeout", operationName(op), got)
+		}
+	}
+
+	ms = &Server{opts: &MountOptions{
+		RequestTimeout: time.Second,
+		OpTimeouts:     map[string]time.Duration{"setlkw": time.Minute},
+	}}
+	if err := ms.setTimeouts(); err != nil {
+		t.Fatalf("setTimeouts: %v", err)
+	}
+	if got := ms.timeouts[_OP_SETLKW]; got != time.Minute {
+		t.Errorf("SETLKW: got %v, want 1m", got)
+	}
+}
+
+func TestParseTraceFilter(t *testing.T) {
+	f, err := ParseTraceFilter("op=lookup,GETATTR node=1 pid=42", nil)
+	if err != nil {
+		t.Fatalf("ParseTraceFilter: %v", err)
+	}
+	if !reflect.DeepEqual(f.Ops, []string{"LOOKUP", "GETATTR"}) ||
+		!reflect.DeepEqual(f.NodeIds, []uint64{1}) ||
+		!reflect.DeepEqual(f.Pids, []uint32{42}) {
+		t.Errorf("got %+v", f)
+	}
+
+	for _, c := range []struct {
+		info RequestInfo
+		want bool
+	}{
+		{RequestInfo{Op: "LOOKUP", NodeId: 1, Caller: Caller{Pid: 42}}, true},
+		{RequestInfo{Op: "READ", NodeId: 1, Caller: Caller{Pid: 42}}, false},
+		{RequestInfo{Op: "GETATTR", NodeId: 2, Caller: Caller{Pid: 42}}, false},
+		{RequestInfo{Op: "GETATTR", NodeId: 1, Caller: Caller{Pid: 7}}, false},
+	} {
+		if got := f.Match(&c.info); got != c.want {
+			t.Errorf("Match(%+v): got %v, want %v", c.info, got, c.want)
+		}
+	}
+
+	if f, err := ParseTraceFilter("", nil); err != nil || !f.Match(&RequestInfo{Op: "READ"}) {
+		t.Errorf("empty filter: got %v, %v", f, err)
+	}
+	for _, spec := range []string{"op", "node=x", "pid=-1", "uid=0"} {
+		if _, err := ParseTraceFilter(spec, nil); err == nil {
+			t.Errorf("ParseTraceFilter(%q): want error", spec)
+		}
+	}
+}
+
+func TestReadRecording(t *testing.T) {
+	var buf bytes.Buffer
+	r := newTrafficRecorder(&buf)
+	r.record(recordRequest, []byte("request"))
+	r.record(recordReply, []byte("re"), []byte("ply"))
+
+	recs, err := ReadRecording(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadRecording: %v", err)
+	}
+	if len(recs) != 2 || recs[0].Reply || string(recs[0].Data) != "request" ||
+		!recs[1].Reply || string(recs[1].Data) != "reply" {
+		t.Errorf("got %v", recs)
+	}
+
+	recs, err = ReadRecording(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if err != io.ErrUnexpectedEOF || len(recs) != 1 {
+		t.Errorf("truncated: got %d records, %v; want 1, ErrUnexpectedEOF", len(recs), err)
+	}
+	if _, err := ReadRecording(strings.NewReader("garbage")); err != ErrBadRecording {
+		t.Errorf("garbage: got %v, want ErrBadRecording", err)
+	}
+}
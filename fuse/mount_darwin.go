@@ -14,6 +14,8 @@ import (
 	"strings"
 	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 func openFUSEDevice() (*os.File, error) {
@@ -58,10 +60,12 @@ const loadBinV4 = "/Library/Filesystems/macfuse.fs/Contents/Resources/load_macfu
 const mountBinV4 = "/Library/Filesystems/macfuse.fs/Contents/Resources/mount_macfuse"
 
 // Create a FUSE FS on the specified mount point.  The returned
-// mount point is always absolute.
-func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, err error) {
+// mount point is always absolute. MountOptions.AutoUnmount is not
+// supported, so comm is always nil.
+func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, comm *os.File, err error) {
 	if _, err := os.Stat(mountBinV4); err == nil {
-		return mountV4(mountPoint, opts, ready)
+		fd, err := mountV4(mountPoint, opts, ready)
+		return fd, nil, err
 	}
 	f, err := openFUSEDevice()
 	if err != nil {
@@ -87,7 +91,7 @@ func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, e
 
 	if err = cmd.Start(); err != nil {
 		_ = f.Close()
-		return 0, err
+		return 0, nil, err
 	}
 
 	go func() {
@@ -103,7 +107,8 @@ func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, e
 
 	// The finalizer for f will close its fd so we return a dup.
 	defer f.Close()
-	return syscall.Dup(int(f.Fd()))
+	fd, err = syscall.Dup(int(f.Fd()))
+	return
 }
 
 func unixgramSocketpair() (l, r *os.File, err error) {
@@ -191,6 +196,14 @@ func mountV4(mountPoint string, opts *MountOptions, ready chan<- error) (fd int,
 	return fd, nil
 }
 
-func unmount(dir string, opts *MountOptions) error {
+func unmount(dir string, opts *MountOptions, lazy bool) error {
+	if lazy {
+		return syscall.ENOTSUP
+	}
 	return syscall.Unmount(dir, 0)
 }
+
+// unmountStale unmounts a FUSE mount whose server is gone.
+func unmountStale(mountPoint string) error {
+	return unix.Unmount(mountPoint, unix.MNT_FORCE)
+}
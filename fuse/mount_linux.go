@@ -58,27 +58,21 @@ func updateMtab(source, mnt, _type, options string) {
 	}
 }
 
-// Create a FUSE FS on the specified mount point without using
-// fusermount.
-func mountDirect(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, err error) {
-	fd, err = syscall.Open("/dev/fuse", os.O_RDWR, 0) // use syscall.Open since we want an int fd
-	if err != nil {
-		return
-	}
-
-	// managed to open dev/fuse, attempt to mount
-	source := opts.FsName
+// directMountArgs returns the source, flags and options for mounting
+// the FUSE device fd without fusermount.
+func directMountArgs(fd int, opts *MountOptions) (source string, flags uintptr, params []string) {
+	source = opts.FsName
 	if source == "" {
 		source = opts.Name
 	}
 
-	var flags uintptr = syscall.MS_NOSUID | syscall.MS_NODEV
+	flags = syscall.MS_NOSUID | syscall.MS_NODEV
 	if opts.DirectMountFlags != 0 {
 		flags = opts.DirectMountFlags
 	}
 
 	// some values we need to pass to mount, but override possible since opts.Options comes after
-	var r = []string{
+	params = []string{
 		fmt.Sprintf("fd=%d", fd),
 		"rootmode=40000",
 		"user_id=0",
@@ -86,19 +80,48 @@ func mountDirect(mountPoint string, opts *MountOptions, ready chan<- error) (fd
 	}
 	for _, o := range opts.Options {
 		if o != "nonempty" && o != "allow_root" {
-			r = append(r, o)
+			params = append(params, o)
 		}
 	}
 
 	if opts.AllowOther {
-		r = append(r, "allow_other")
+		params = append(params, "allow_other")
+	}
+	return source, flags, params
+}
+
+// Create a FUSE FS on the specified mount point without using
+// fusermount. This uses fsopen(2) and friends, which take the options
+// one by one, or mount(2) on kernels that lack them.
+func mountDirect(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, err error) {
+	fd, err = syscall.Open("/dev/fuse", os.O_RDWR, 0) // use syscall.Open since we want an int fd
+	if err != nil {
+		return
 	}
 
-	if opts.Debug {
-		log.Printf("mountDirect: calling syscall.Mount(%q, %q, %q, %#x, %q)",
-			source, mountPoint, "fuse."+opts.Name, flags, strings.Join(r, ","))
+	// managed to open dev/fuse, attempt to mount
+	source, flags, r := directMountArgs(fd, opts)
+
+	mnt, err := fsmountFUSE(source, opts, flags, r)
+	if err == nil {
+		if opts.Debug {
+			log.Printf("mountDirect: attaching fsmount(2) mount to %q", mountPoint)
+		}
+		err = moveMount(mnt, mountPoint)
+		syscall.Close(mnt)
+	} else if fsmountUnsupported(err) {
+		if opts.Debug {
+			log.Printf("mountDirect: %v; falling back to mount(2)", err)
+		}
+		err = checkOptionCommas(r)
+		if err == nil {
+			if opts.Debug {
+				log.Printf("mountDirect: calling syscall.Mount(%q, %q, %q, %#x, %q)",
+					source, mountPoint, "fuse."+opts.Name, flags, strings.Join(r, ","))
+			}
+			err = syscall.Mount(source, mountPoint, "fuse."+opts.Name, flags, strings.Join(r, ","))
+		}
 	}
-	err = syscall.Mount(source, mountPoint, "fuse."+opts.Name, flags, strings.Join(r, ","))
 	if err != nil {
 		syscall.Close(fd)
 		return
@@ -106,7 +129,7 @@ func mountDirect(mountPoint string, opts *MountOptions, ready chan<- error) (fd
 
 	if os.Geteuid() == 0 {
 		realmnt, _ := filepath.Abs(mountPoint)
-		if mtabNeedUpdate(realmnt) {
+		if mtabNeedUpdate(realmnt) && checkOptionCommas(r) == nil {
 			updateMtab(source, realmnt, opts.Name, strings.Join(r, ","))
 		}
 	}
@@ -117,32 +140,46 @@ func mountDirect(mountPoint string, opts *MountOptions, ready chan<- error) (fd
 }
 
 // Create a FUSE FS on the specified mount point.  The returned
-// mount point is always absolute.
-func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, err error) {
-	if opts.DirectMount {
+// mount point is always absolute. With MountOptions.AutoUnmount,
+// comm is the socket to fusermount, which unmounts once it is
+// closed.
+func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, comm *os.File, err error) {
+	// fusermount takes the options joined with ','.
+	s := opts.optionsStrings()
+	if opts.AutoUnmount {
+		s = append(s, "auto_unmount")
+	}
+	commaErr := checkOptionCommas(s)
+
+	if opts.DirectMount && !opts.AutoUnmount {
 		fd, err := mountDirect(mountPoint, opts, ready)
 		if err == nil {
-			return fd, nil
+			return fd, nil, nil
+		} else if commaErr != nil {
+			return 0, nil, err
 		} else if opts.Debug {
 			log.Printf("mount: failed to do direct mount: %s", err)
 		}
 	}
+	if commaErr != nil {
+		return 0, nil, commaErr
+	}
 
 	local, remote, err := unixgramSocketpair()
 	if err != nil {
 		return
 	}
 
-	defer local.Close()
 	defer remote.Close()
 
 	bin, err := fusermountBinary()
 	if err != nil {
-		return 0, err
+		local.Close()
+		return 0, nil, err
 	}
 
 	cmd := []string{bin, mountPoint}
-	if s := opts.optionsStrings(); len(s) > 0 {
+	if len(s) > 0 {
 		cmd = append(cmd, "-o", strings.Join(s, ","))
 	}
 	proc, err := os.StartProcess(bin,
@@ -152,21 +189,30 @@ func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, e
 			Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, remote}})
 
 	if err != nil {
+		local.Close()
 		return
 	}
 
-	w, err := proc.Wait()
-	if err != nil {
-		return
-	}
-	if !w.Success() {
-		err = fmt.Errorf("fusermount exited with code %v\n", w.Sys())
-		return
-	}
+	if opts.AutoUnmount {
+		fd, err = autoUnmountConnection(proc, local, remote)
+		if err != nil {
+			return -1, nil, err
+		}
+		comm = local
+	} else {
+		defer local.Close()
+		w, err := proc.Wait()
+		if err != nil {
+			return 0, nil, err
+		}
+		if !w.Success() {
+			return 0, nil, fmt.Errorf("fusermount exited with code %v\n", w.Sys())
+		}
 
-	fd, err = getConnection(local)
-	if err != nil {
-		return -1, err
+		fd, err = getConnection(local)
+		if err != nil {
+			return -1, nil, err
+		}
 	}
 
 	// golang sets CLOEXEC on file descriptors when they are
@@ -175,13 +221,41 @@ func mount(mountPoint string, opts *MountOptions, ready chan<- error) (fd int, e
 	syscall.CloseOnExec(fd)
 
 	close(ready)
-	return fd, err
+	return fd, comm, nil
 }
 
-func unmount(mountPoint string, opts *MountOptions) (err error) {
+// autoUnmountConnection gets the FUSE device from a fusermount that
+// was started with auto_unmount. Such a fusermount does not exit after
+// mounting, but waits for the other end of local to close, so it
+// can unmount.
+func autoUnmountConnection(proc *os.Process, local, remote *os.File) (int, error) {
+	// Don't let our children keep the mount.
+	syscall.CloseOnExec(int(local.Fd()))
+	// Our copy of remote would keep local from seeing EOF if
+	// fusermount fails.
+	remote.Close()
+
+	fd, err := getConnection(local)
+	if err != nil {
+		local.Close()
+		w, werr := proc.Wait()
+		if werr == nil && !w.Success() {
+			return -1, fmt.Errorf("fusermount exited with code %v\n", w.Sys())
+		}
+		return -1, err
+	}
+	go proc.Wait()
+	return fd, nil
+}
+
+func unmount(mountPoint string, opts *MountOptions, lazy bool) (err error) {
 	if opts.DirectMount {
 		// Attempt to directly unmount, if fails fallback to fusermount method
-		err := syscall.Unmount(mountPoint, 0)
+		flags := 0
+		if lazy {
+			flags = syscall.MNT_DETACH
+		}
+		err := syscall.Unmount(mountPoint, flags)
 		if err == nil {
 			return nil
 		}
@@ -191,8 +265,12 @@ func unmount(mountPoint string, opts *MountOptions) (err error) {
 	if err != nil {
 		return err
 	}
+	args := []string{"-u"}
+	if lazy {
+		args = append(args, "-z")
+	}
 	errBuf := bytes.Buffer{}
-	cmd := exec.Command(bin, "-u", mountPoint)
+	cmd := exec.Command(bin, append(args, mountPoint)...)
 	cmd.Stderr = &errBuf
 	err = cmd.Run()
 	if errBuf.Len() > 0 {
@@ -241,10 +319,24 @@ func lookPathFallback(file string, fallbackDir string) (string, error) {
 	return exec.LookPath(abs)
 }
 
+// fusermountBinary returns the fusermount of libfuse 3, which is the
+// only one that recent distributions ship, or else that of libfuse 2.
 func fusermountBinary() (string, error) {
+	if bin, err := lookPathFallback("fusermount3", "/bin"); err == nil {
+		return bin, nil
+	}
 	return lookPathFallback("fusermount", "/bin")
 }
 
+// unmountStale unmounts a FUSE mount whose server is gone.
+func unmountStale(mountPoint string) error {
+	if err := syscall.Unmount(mountPoint, syscall.MNT_DETACH); err == nil {
+		return nil
+	}
+	// Without privileges, fusermount can unmount our own mounts.
+	return unmount(mountPoint, &MountOptions{}, true)
+}
+
 func umountBinary() (string, error) {
 	return lookPathFallback("umount", "/bin")
 }
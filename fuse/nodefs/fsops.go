@@ -496,10 +496,26 @@ func (c *rawBridge) Flush(cancel <-chan struct{}, input *fuse.FlushIn) fuse.Stat
 	return fuse.OK
 }
 
+func (c *rawBridge) WritePipe(cancel <-chan struct{}, input *fuse.WriteIn, data *fuse.PipeData) (written uint32, code fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
 func (c *rawBridge) CopyFileRange(cancel <-chan struct{}, input *fuse.CopyFileRangeIn) (written uint32, code fuse.Status) {
 	return 0, fuse.ENOSYS
 }
 
+func (fs *rawBridge) Statx(cancel <-chan struct{}, input *fuse.StatxIn, out *fuse.StatxOut) fuse.Status {
+	return fuse.ENOSYS
+}
+
+func (fs *rawBridge) Tmpfile(cancel <-chan struct{}, input *fuse.CreateIn, out *fuse.CreateOut) fuse.Status {
+	return fuse.ENOSYS
+}
+
+func (fs *rawBridge) SyncFs(cancel <-chan struct{}, input *fuse.SyncFsIn) fuse.Status {
+	return fuse.ENOSYS
+}
+
 func (fs *rawBridge) Lseek(cancel <-chan struct{}, in *fuse.LseekIn, out *fuse.LseekOut) fuse.Status {
 	return fuse.ENOSYS
 }
@@ -507,3 +523,7 @@ func (fs *rawBridge) Lseek(cancel <-chan struct{}, in *fuse.LseekIn, out *fuse.L
 func (fs *rawBridge) Ioctl(cancel <-chan struct{}, in *fuse.IoctlIn, out *fuse.IoctlOut, bufIn, bufOut []byte) fuse.Status {
 	return fuse.ENOSYS
 }
+
+func (fs *rawBridge) Poll(cancel <-chan struct{}, in *fuse.PollIn, out *fuse.PollOut) fuse.Status {
+	return fuse.ENOSYS
+}
@@ -62,6 +62,9 @@ const (
 	_OP_RENAME2         = uint32(45) // protocol version 23.
 	_OP_LSEEK           = uint32(46) // protocol version 24
 	_OP_COPY_FILE_RANGE = uint32(47) // protocol version 28.
+	_OP_SYNCFS          = uint32(50) // protocol version 34.
+	_OP_TMPFILE         = uint32(51) // protocol version 37.
+	_OP_STATX           = uint32(52) // protocol version 39.
 
 	// The following entries don't have to be compatible across Go-FUSE versions.
 	_OP_NOTIFY_INVAL_ENTRY    = uint32(100)
@@ -69,8 +72,10 @@ const (
 	_OP_NOTIFY_STORE_CACHE    = uint32(102)
 	_OP_NOTIFY_RETRIEVE_CACHE = uint32(103)
 	_OP_NOTIFY_DELETE         = uint32(104) // protocol version 18
+	_OP_NOTIFY_POLL           = uint32(105) // protocol version 11
+	_OP_NOTIFY_RESEND         = uint32(106) // protocol version 40
 
-	_OPCODE_COUNT = uint32(105)
+	_OPCODE_COUNT = uint32(107)
 
 	// Constants from Linux kernel fs/fuse/fuse_i.h
 	// Default MaxPages value in all kernel versions
@@ -82,7 +87,7 @@ const (
 ////////////////////////////////////////////////////////////////
 
 func doInit(server *Server, req *request) {
-	input := (*InitIn)(req.inData)
+	input := *(*InitIn)(req.inData)
 	if input.Major != _FUSE_KERNEL_VERSION {
 		log.Printf("Major versions does not match. Given %d, want %d\n", input.Major, _FUSE_KERNEL_VERSION)
 		req.status = EIO
@@ -93,39 +98,69 @@ func doInit(server *Server, req *request) {
 		req.status = EIO
 		return
 	}
+	if input.Flags&CAP_INIT_EXT == 0 {
+		// The extended fields were not sent, so don't read
+		// whatever follows in the buffer.
+		input.Flags2 = 0
+		input.Unused = [11]uint32{}
+	}
 
-	server.reqMu.Lock()
-	server.kernelSettings = *input
-	server.kernelSettings.Flags = input.Flags & (CAP_ASYNC_READ | CAP_BIG_WRITES | CAP_FILE_OPS |
-		CAP_READDIRPLUS | CAP_NO_OPEN_SUPPORT | CAP_PARALLEL_DIROPS | CAP_EXPORT_SUPPORT | CAP_MAX_PAGES | server.opts.OtherCaps)
+	kernelFlags := input.InitFlags()
+	flags := kernelFlags & (CAP_ASYNC_READ | CAP_BIG_WRITES | CAP_FILE_OPS |
+		CAP_READDIRPLUS | CAP_NO_OPEN_SUPPORT | CAP_PARALLEL_DIROPS | CAP_EXPORT_SUPPORT | CAP_MAX_PAGES |
+		InitFlags(server.opts.OtherCaps) | server.opts.Capabilities.Optional | server.opts.Capabilities.Required)
 
 	if server.opts.DontUmask {
-		server.kernelSettings.Flags |= CAP_DONT_MASK
+		flags |= kernelFlags & CAP_DONT_MASK
 	}
 
 	if server.opts.EnableLocks {
-		server.kernelSettings.Flags |= CAP_FLOCK_LOCKS | CAP_POSIX_LOCKS
+		flags |= kernelFlags & (CAP_FLOCK_LOCKS | CAP_POSIX_LOCKS)
 	}
 
 	if server.opts.EnableAcl {
-		server.kernelSettings.Flags |= CAP_POSIX_ACL
+		flags |= kernelFlags & CAP_POSIX_ACL
 	}
 
 	if server.opts.EnableWriteback {
-		server.kernelSettings.Flags |= CAP_WRITEBACK_CACHE
+		flags |= kernelFlags & CAP_WRITEBACK_CACHE
+	}
+
+	if server.opts.EnablePassthrough {
+		flags |= kernelFlags & CAP_PASSTHROUGH
+	}
+
+	if server.opts.EnableSpliceRead {
+		flags |= kernelFlags & (CAP_SPLICE_READ | CAP_SPLICE_MOVE)
+	}
+
+	if server.opts.Transport == IOUring && server.opts.RecordTraffic == nil {
+		flags |= kernelFlags & CAP_OVER_IO_URING
 	}
 
-	dataCacheMode := input.Flags & CAP_AUTO_INVAL_DATA
+	// Remember if the kernel can resend requests, for a process
+	// that takes over the mount later.
+	flags |= kernelFlags & CAP_HAS_RESEND
+
+	dataCacheMode := kernelFlags & CAP_AUTO_INVAL_DATA
 	if server.opts.ExplicitDataCacheControl {
 		// we don't want CAP_AUTO_INVAL_DATA even if we cannot go into fully explicit mode
 		dataCacheMode = 0
 
-		explicit := input.Flags & CAP_EXPLICIT_INVAL_DATA
+		explicit := kernelFlags & CAP_EXPLICIT_INVAL_DATA
 		if explicit != 0 {
 			dataCacheMode = explicit
 		}
 	}
-	server.kernelSettings.Flags |= dataCacheMode
+	flags |= dataCacheMode
+
+	server.reqMu.Lock()
+	server.kernelSettings = input
+	server.kernelSettings.Flags = uint32(flags)
+	server.kernelSettings.Flags2 = uint32(flags >> 32)
+	if server.kernelSettings.Flags2 != 0 {
+		server.kernelSettings.Flags |= CAP_INIT_EXT
+	}
 
 	if input.Minor >= 13 {
 		server.setSplice()
@@ -137,17 +172,29 @@ func doInit(server *Server, req *request) {
 	maxPages := (server.opts.MaxWrite-1)/syscall.Getpagesize() + 1 // Round up
 	server.reqMu.Unlock()
 
+	if missing := server.opts.Capabilities.Required &^ flags; missing != 0 {
+		log.Printf("Kernel does not offer required capabilities %v", missing)
+		// An error reply makes the kernel refuse all further requests.
+		req.status = ENOTSUP
+		return
+	}
+
 	out := (*InitOut)(req.outData())
 	*out = InitOut{
 		Major:               _FUSE_KERNEL_VERSION,
 		Minor:               _OUR_MINOR_VERSION,
 		MaxReadAhead:        input.MaxReadAhead,
-		Flags:               server.kernelSettings.Flags,
 		MaxWrite:            uint32(server.opts.MaxWrite),
 		CongestionThreshold: uint16(server.opts.MaxBackground * 3 / 4),
 		MaxBackground:       uint16(server.opts.MaxBackground),
 		MaxPages:            uint16(maxPages),
 	}
+	out.setInitFlags(flags)
+	if flags&CAP_PASSTHROUGH != 0 {
+		// Backing files must not live on a stacked file
+		// system, such as overlayfs.
+		out.MaxStackDepth = 1
+	}
 
 	if server.opts.MaxReadAhead != 0 && uint32(server.opts.MaxReadAhead) < out.MaxReadAhead {
 		out.MaxReadAhead = uint32(server.opts.MaxReadAhead)
@@ -182,6 +229,16 @@ func doCreate(server *Server, req *request) {
 	req.status = status
 }
 
+func doTmpfile(server *Server, req *request) {
+	out := (*CreateOut)(req.outData())
+	req.status = server.fileSystem.Tmpfile(req.cancel, (*CreateIn)(req.inData), out)
+}
+
+func doStatx(server *Server, req *request) {
+	out := (*StatxOut)(req.outData())
+	req.status = server.fileSystem.Statx(req.cancel, (*StatxIn)(req.inData), out)
+}
+
 func doReadDir(server *Server, req *request) {
 	in := (*ReadIn)(req.inData)
 	buf := server.allocOut(req, in.Size)
@@ -214,7 +271,16 @@ func doSetattr(server *Server, req *request) {
 }
 
 func doWrite(server *Server, req *request) {
-	n, status := server.fileSystem.Write(req.cancel, (*WriteIn)(req.inData), req.arg)
+	var n uint32
+	var status Status
+	if req.pipeData != nil {
+		n, status = server.fileSystem.WritePipe(req.cancel, (*WriteIn)(req.inData), req.pipeData)
+		if status == ENOSYS {
+			n, status = server.writeFromPipe(req)
+		}
+	} else {
+		n, status = server.fileSystem.Write(req.cancel, (*WriteIn)(req.inData), req.arg)
+	}
 	o := (*WriteOut)(req.outData())
 	o.Size = n
 	req.status = status
@@ -399,6 +465,10 @@ func doRead(server *Server, req *request) {
 	if fd, ok := req.readResult.(*readResultFd); ok {
 		req.fdData = fd
 		req.flatData = nil
+	} else if fn, ok := req.readResult.(*readResultFunc); ok && req.status.Ok() {
+		// Filled by systemWrite.
+		req.funcData = fn
+		req.flatData = nil
 	} else if req.readResult != nil && req.status.Ok() {
 		var st int
 		if rs, ok := req.readResult.(withSlice); ok {
@@ -500,7 +570,13 @@ func doIoctl(server *Server, req *request) {
 }
 
 func doPoll(server *Server, req *request) {
-	req.status = ENOSYS
+	if !server.opts.EnablePoll {
+		req.status = ENOSYS
+		return
+	}
+	in := (*PollIn)(req.inData)
+	out := (*PollOut)(req.outData())
+	req.status = server.fileSystem.Poll(req.cancel, in, out)
 }
 
 func doDestroy(server *Server, req *request) {
@@ -523,6 +599,11 @@ func doSetLkw(server *Server, req *request) {
 	req.status = server.fileSystem.SetLkw(req.cancel, (*LkIn)(req.inData))
 }
 
+func doSyncFs(server *Server, req *request) {
+	in := (*SyncFsIn)(req.inData)
+	req.status = server.fileSystem.SyncFs(req.cancel, in)
+}
+
 func doLseek(server *Server, req *request) {
 	in := (*LseekIn)(req.inData)
 	out := (*LseekOut)(req.outData())
@@ -538,25 +619,41 @@ func doCopyFileRange(server *Server, req *request) {
 
 func doInterrupt(server *Server, req *request) {
 	input := (*InterruptIn)(req.inData)
+	// An INTERRUPT has no reply, unless it cannot be applied.
+	req.status = OK
 
 	// This is slow, but this operation is rare.
 	server.reqMu.Lock()
+	defer server.reqMu.Unlock()
 	for _, inflight := range server.reqInflight {
 		if input.Unique == inflight.inHeader.Unique {
 			if !inflight.interrupted {
 				close(inflight.cancel)
 				inflight.interrupted = true
 			}
-			server.reqMu.Unlock()
-			req.status = OK
 			return
 		}
 	}
-	server.reqMu.Unlock()
+	if server.recentlyCompleted(input.Unique) {
+		// Lost the race against the reply; nothing to do.
+		return
+	}
+	if server.pendingInterrupts[input.Unique] != nil {
+		return
+	}
 
-	// not found; wait for a bit
-	time.Sleep(10 * time.Microsecond)
-	req.status = EAGAIN
+	p := &pendingInterrupt{
+		header:  *req.inHeader,
+		channel: req.channel,
+	}
+	if server.pendingInterrupts == nil {
+		server.pendingInterrupts = map[uint64]*pendingInterrupt{}
+	}
+	server.pendingInterrupts[input.Unique] = p
+	target := input.Unique
+	p.timer = time.AfterFunc(interruptWait, func() {
+		server.expireInterrupt(target, p)
+	})
 }
 
 ////////////////////////////////////////////////////////////////
@@ -625,7 +722,7 @@ func init() {
 		_OP_GETXATTR:        unsafe.Sizeof(GetXAttrIn{}),
 		_OP_LISTXATTR:       unsafe.Sizeof(GetXAttrIn{}),
 		_OP_FLUSH:           unsafe.Sizeof(FlushIn{}),
-		_OP_INIT:            unsafe.Sizeof(InitIn{}),
+		_OP_INIT:            unsafe.Offsetof(InitIn{}.Flags2), // Flags2 and up are only sent from 7.36 on.
 		_OP_OPENDIR:         unsafe.Sizeof(OpenIn{}),
 		_OP_READDIR:         unsafe.Sizeof(ReadIn{}),
 		_OP_RELEASEDIR:      unsafe.Sizeof(ReleaseIn{}),
@@ -638,12 +735,15 @@ func init() {
 		_OP_INTERRUPT:       unsafe.Sizeof(InterruptIn{}),
 		_OP_BMAP:            unsafe.Sizeof(_BmapIn{}),
 		_OP_IOCTL:           unsafe.Sizeof(IoctlIn{}),
-		_OP_POLL:            unsafe.Sizeof(_PollIn{}),
+		_OP_POLL:            unsafe.Sizeof(PollIn{}),
 		_OP_NOTIFY_REPLY:    unsafe.Sizeof(NotifyRetrieveIn{}),
 		_OP_FALLOCATE:       unsafe.Sizeof(FallocateIn{}),
 		_OP_READDIRPLUS:     unsafe.Sizeof(ReadIn{}),
 		_OP_RENAME2:         unsafe.Sizeof(RenameIn{}),
 		_OP_LSEEK:           unsafe.Sizeof(LseekIn{}),
+		_OP_SYNCFS:          unsafe.Sizeof(SyncFsIn{}),
+		_OP_TMPFILE:         unsafe.Sizeof(CreateIn{}),
+		_OP_STATX:           unsafe.Sizeof(StatxIn{}),
 		_OP_COPY_FILE_RANGE: unsafe.Sizeof(CopyFileRangeIn{}),
 	} {
 		operationHandlers[op].InputSize = sz
@@ -669,14 +769,17 @@ func init() {
 		_OP_OPENDIR:               unsafe.Sizeof(OpenOut{}),
 		_OP_GETLK:                 unsafe.Sizeof(LkOut{}),
 		_OP_CREATE:                unsafe.Sizeof(CreateOut{}),
+		_OP_TMPFILE:               unsafe.Sizeof(CreateOut{}),
+		_OP_STATX:                 unsafe.Sizeof(StatxOut{}),
 		_OP_BMAP:                  unsafe.Sizeof(_BmapOut{}),
 		_OP_IOCTL:                 unsafe.Sizeof(IoctlOut{}),
-		_OP_POLL:                  unsafe.Sizeof(_PollOut{}),
+		_OP_POLL:                  unsafe.Sizeof(PollOut{}),
 		_OP_NOTIFY_INVAL_ENTRY:    unsafe.Sizeof(NotifyInvalEntryOut{}),
 		_OP_NOTIFY_INVAL_INODE:    unsafe.Sizeof(NotifyInvalInodeOut{}),
 		_OP_NOTIFY_STORE_CACHE:    unsafe.Sizeof(NotifyStoreOut{}),
 		_OP_NOTIFY_RETRIEVE_CACHE: unsafe.Sizeof(NotifyRetrieveOut{}),
 		_OP_NOTIFY_DELETE:         unsafe.Sizeof(NotifyInvalDeleteOut{}),
+		_OP_NOTIFY_POLL:           unsafe.Sizeof(NotifyPollWakeupOut{}),
 		_OP_LSEEK:                 unsafe.Sizeof(LseekOut{}),
 		_OP_COPY_FILE_RANGE:       unsafe.Sizeof(WriteOut{}),
 	} {
@@ -729,10 +832,15 @@ func init() {
 		_OP_NOTIFY_STORE_CACHE:    "NOTIFY_STORE",
 		_OP_NOTIFY_RETRIEVE_CACHE: "NOTIFY_RETRIEVE",
 		_OP_NOTIFY_DELETE:         "NOTIFY_DELETE",
+		_OP_NOTIFY_POLL:           "NOTIFY_POLL",
+		_OP_NOTIFY_RESEND:         "NOTIFY_RESEND",
 		_OP_FALLOCATE:             "FALLOCATE",
 		_OP_READDIRPLUS:           "READDIRPLUS",
 		_OP_RENAME2:               "RENAME2",
 		_OP_LSEEK:                 "LSEEK",
+		_OP_SYNCFS:                "SYNCFS",
+		_OP_TMPFILE:               "TMPFILE",
+		_OP_STATX:                 "STATX",
 		_OP_COPY_FILE_RANGE:       "COPY_FILE_RANGE",
 	} {
 		operationHandlers[op].Name = v
@@ -783,6 +891,9 @@ func init() {
 		_OP_INTERRUPT:       doInterrupt,
 		_OP_COPY_FILE_RANGE: doCopyFileRange,
 		_OP_LSEEK:           doLseek,
+		_OP_SYNCFS:          doSyncFs,
+		_OP_TMPFILE:         doTmpfile,
+		_OP_STATX:           doStatx,
 	} {
 		handler := v
 		operationHandlers[op].Func = func(s *Server, r *request) {
@@ -803,6 +914,8 @@ func init() {
 		_OP_OPENDIR:               func(ptr unsafe.Pointer) interface{} { return (*OpenOut)(ptr) },
 		_OP_GETATTR:               func(ptr unsafe.Pointer) interface{} { return (*AttrOut)(ptr) },
 		_OP_CREATE:                func(ptr unsafe.Pointer) interface{} { return (*CreateOut)(ptr) },
+		_OP_TMPFILE:               func(ptr unsafe.Pointer) interface{} { return (*CreateOut)(ptr) },
+		_OP_STATX:                 func(ptr unsafe.Pointer) interface{} { return (*StatxOut)(ptr) },
 		_OP_LINK:                  func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
 		_OP_SETATTR:               func(ptr unsafe.Pointer) interface{} { return (*AttrOut)(ptr) },
 		_OP_INIT:                  func(ptr unsafe.Pointer) interface{} { return (*InitOut)(ptr) },
@@ -812,6 +925,8 @@ func init() {
 		_OP_NOTIFY_STORE_CACHE:    func(ptr unsafe.Pointer) interface{} { return (*NotifyStoreOut)(ptr) },
 		_OP_NOTIFY_RETRIEVE_CACHE: func(ptr unsafe.Pointer) interface{} { return (*NotifyRetrieveOut)(ptr) },
 		_OP_NOTIFY_DELETE:         func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalDeleteOut)(ptr) },
+		_OP_NOTIFY_POLL:           func(ptr unsafe.Pointer) interface{} { return (*NotifyPollWakeupOut)(ptr) },
+		_OP_POLL:                  func(ptr unsafe.Pointer) interface{} { return (*PollOut)(ptr) },
 		_OP_STATFS:                func(ptr unsafe.Pointer) interface{} { return (*StatfsOut)(ptr) },
 		_OP_SYMLINK:               func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
 		_OP_GETLK:                 func(ptr unsafe.Pointer) interface{} { return (*LkOut)(ptr) },
@@ -831,7 +946,7 @@ func init() {
 		_OP_SETATTR:         func(ptr unsafe.Pointer) interface{} { return (*SetAttrIn)(ptr) },
 		_OP_INIT:            func(ptr unsafe.Pointer) interface{} { return (*InitIn)(ptr) },
 		_OP_IOCTL:           func(ptr unsafe.Pointer) interface{} { return (*IoctlIn)(ptr) },
-		_OP_POLL:            func(ptr unsafe.Pointer) interface{} { return (*_PollIn)(ptr) },
+		_OP_POLL:            func(ptr unsafe.Pointer) interface{} { return (*PollIn)(ptr) },
 		_OP_OPEN:            func(ptr unsafe.Pointer) interface{} { return (*OpenIn)(ptr) },
 		_OP_MKNOD:           func(ptr unsafe.Pointer) interface{} { return (*MknodIn)(ptr) },
 		_OP_CREATE:          func(ptr unsafe.Pointer) interface{} { return (*CreateIn)(ptr) },
@@ -855,6 +970,9 @@ func init() {
 		_OP_RENAME2:         func(ptr unsafe.Pointer) interface{} { return (*RenameIn)(ptr) },
 		_OP_INTERRUPT:       func(ptr unsafe.Pointer) interface{} { return (*InterruptIn)(ptr) },
 		_OP_LSEEK:           func(ptr unsafe.Pointer) interface{} { return (*LseekIn)(ptr) },
+		_OP_SYNCFS:          func(ptr unsafe.Pointer) interface{} { return (*SyncFsIn)(ptr) },
+		_OP_TMPFILE:         func(ptr unsafe.Pointer) interface{} { return (*CreateIn)(ptr) },
+		_OP_STATX:           func(ptr unsafe.Pointer) interface{} { return (*StatxIn)(ptr) },
 		_OP_COPY_FILE_RANGE: func(ptr unsafe.Pointer) interface{} { return (*CopyFileRangeIn)(ptr) },
 	} {
 		operationHandlers[op].DecodeIn = f
@@ -1,112 +1,51 @@
 package fuse
 
 import (
+	"fmt"
 	"net"
-	"os"
 	"syscall"
 )
 
-// Get receives file descriptors from a Unix domain socket.
-//
-// Num specifies the expected number of file descriptors in one message.
-// Internal files' names to be assigned are specified via optional filenames
-// argument.
-//
-// You need to close all files in the returned slice. The slice can be
-// non-empty even if this function returns an error.
-func getFd(via *net.UnixConn, num int) ([]byte, []int, error) {
-	if num < 1 {
-		return nil, nil, nil
-	}
+// putFd sends msg over a Unix domain socket, passing along the given
+// file descriptor.
+func putFd(via *net.UnixConn, msg []byte, fd int) error {
+	_, _, err := via.WriteMsgUnix(msg, syscall.UnixRights(fd), nil)
+	return err
+}
 
-	// get the underlying socket
-	viaf, err := via.File()
+// getFd receives a message of at most maxSize bytes from a Unix domain
+// socket. If a file descriptor was passed with it, it is returned,
+// otherwise fd is -1. The caller must close the file descriptor.
+func getFd(via *net.UnixConn, maxSize int) (msg []byte, fd int, err error) {
+	msg = make([]byte, maxSize)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := via.ReadMsgUnix(msg, oob)
 	if err != nil {
-		return nil, nil, err
+		return nil, -1, err
 	}
-	socket := int(viaf.Fd())
-	defer viaf.Close()
+	msg = msg[:n]
 
-	// recvmsg
-	msg := make([]byte, syscall.CmsgSpace(100))
-	buf := make([]byte, syscall.CmsgSpace(num*4))
-	_, _, _, _, err = syscall.Recvmsg(socket, msg, buf, 0)
+	cmsgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
 	if err != nil {
-		return nil, nil, err
+		return nil, -1, err
 	}
-
-	// parse control msgs
-	msgs, err := syscall.ParseSocketControlMessage(buf)
-
-	// convert fds to files
-	fds := make([]int, 0, len(msgs))
-	for _, msg := range msgs {
-		var rights []int
-		rights, err = syscall.ParseUnixRights(&msg)
-		fds = append(fds, rights...)
+	var fds []int
+	for i := range cmsgs {
+		rights, err := syscall.ParseUnixRights(&cmsgs[i])
 		if err != nil {
-			for i := range fds {
-				syscall.Close(fds[i])
-			}
-			fds = nil
-			break
+			continue
 		}
+		fds = append(fds, rights...)
 	}
-	return msg, fds, err
-}
-
-// putFd sends file descriptors to Unix domain socket.
-//
-// Please note that the number of descriptors in one message is limited
-// and is rather small.
-func putFd(via *net.UnixConn, msg []byte, fds ...int) error {
 	if len(fds) == 0 {
-		return nil
-	}
-	viaf, err := via.File()
-	if err != nil {
-		return err
-	}
-	socket := int(viaf.Fd())
-	defer viaf.Close()
-
-	rights := syscall.UnixRights(fds...)
-	return syscall.Sendmsg(socket, msg, rights, nil, 0)
-}
-
-func sendFuseFd(path string, msg []byte, fd int) error {
-	conn, err := net.Dial("unix", path)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	_, fds, err := getFd(conn.(*net.UnixConn), 2)
-	if err != nil {
-		return err
-	}
-	for _, fd := range fds {
-		_ = syscall.Close(fd)
+		return msg, -1, nil
 	}
-	return putFd(conn.(*net.UnixConn), msg, fd)
-}
-
-func closeFuseFd() error {
-	path := os.Getenv("_FUSE_FD_COMM")
-	if path == "" {
-		return nil
-	}
-	c, err := net.Dial("unix", path)
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-	via := c.(*net.UnixConn)
-	_, fds, err := getFd(via, 2)
-	if err != nil {
-		return err
+	for _, extra := range fds[1:] {
+		syscall.Close(extra)
 	}
-	for _, fd := range fds {
-		_ = syscall.Close(fd)
+	if len(fds) > 1 {
+		syscall.Close(fds[0])
+		return nil, -1, fmt.Errorf("got %d file descriptors, want 1", len(fds))
 	}
-	return nil
+	return msg, fds[0], nil
 }
@@ -0,0 +1,69 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"syscall"
+)
+
+// PipeData is the payload of a WRITE request that was left in a pipe
+// (see MountOptions.EnableSpliceRead). It can be moved into a file
+// with splice(2), without copying it through user space. The data
+// can be consumed only once.
+type PipeData struct {
+	// fd is the read end of the pipe.
+	fd   int
+	size int
+
+	// done returns the pipe to its pool.
+	done func()
+}
+
+// Size returns the number of bytes left in the pipe.
+func (d *PipeData) Size() int {
+	return d.size
+}
+
+// Bytes reads the data into buf, which should have room for Size()
+// bytes, and returns the part of buf that was filled.
+func (d *PipeData) Bytes(buf []byte) ([]byte, error) {
+	n := 0
+	for d.size > 0 && n < len(buf) {
+		want := len(buf) - n
+		if want > d.size {
+			want = d.size
+		}
+		m, err := syscall.Read(d.fd, buf[n:n+want])
+		if m > 0 {
+			n += m
+			d.size -= m
+		}
+		if err != nil {
+			return buf[:n], err
+		}
+		if m == 0 {
+			return buf[:n], syscall.EIO
+		}
+	}
+	return buf[:n], nil
+}
+
+// release returns the pipe to the pool, discarding data that was not
+// consumed.
+func (d *PipeData) release() {
+	d.done()
+}
+
+// writeFromPipe copies the data of a WRITE out of its pipe, for file
+// systems that do not implement WritePipe.
+func (ms *Server) writeFromPipe(req *request) (uint32, Status) {
+	buf := ms.buffers.AllocBuffer(uint32(req.pipeData.Size()))
+	defer ms.buffers.FreeBuffer(buf)
+	data, err := req.pipeData.Bytes(buf)
+	if err != nil {
+		return 0, ToStatus(err)
+	}
+	return ms.fileSystem.Write(req.cancel, (*WriteIn)(req.inData), data)
+}
@@ -0,0 +1,11 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import "syscall"
+
+func (d *PipeData) SpliceTo(fd uintptr, off int64) (int, error) {
+	return 0, syscall.ENOSYS
+}
@@ -0,0 +1,27 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import "syscall"
+
+// SpliceTo moves the data into fd at offset off. It returns the
+// number of bytes moved.
+func (d *PipeData) SpliceTo(fd uintptr, off int64) (int, error) {
+	total := 0
+	for d.size > 0 {
+		n, err := syscall.Splice(d.fd, nil, int(fd), &off, d.size, 0)
+		if n > 0 {
+			total += int(n)
+			d.size -= int(n)
+		}
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, syscall.EIO
+		}
+	}
+	return total, nil
+}
@@ -4,7 +4,8 @@ package fuse
 // the runtime's epoll to take up the last GOMAXPROCS slot, and if
 // that happens, we won't have any threads left to service FUSE's
 // _OP_POLL request. Prevent this by forcing _OP_POLL to happen, so we
-// can say ENOSYS and prevent further _OP_POLL requests.
+// can say ENOSYS and prevent further _OP_POLL requests. This is
+// skipped if MountOptions.EnablePoll is set.
 const pollHackName = ".go-fuse-epoll-hack"
 const pollHackInode = ^uint64(0)
 
@@ -71,6 +71,7 @@ var (
 		FOPEN_NONSEEKABLE: "NONSEEK",
 		FOPEN_CACHE_DIR:   "CACHE_DIR",
 		FOPEN_STREAM:      "STREAM",
+		FOPEN_PASSTHROUGH: "PASSTHROUGH",
 	}
 	accessFlagName = map[int64]string{
 		X_OK: "x",
@@ -156,20 +157,22 @@ func (in *OpenIn) string() string {
 }
 
 func (in *OpenOut) string() string {
+	if in.OpenFlags&FOPEN_PASSTHROUGH != 0 {
+		return fmt.Sprintf("{Fh %d %s backing %d}", in.Fh,
+			flagString(fuseOpenFlagNames, int64(in.OpenFlags), ""), in.BackingId)
+	}
 	return fmt.Sprintf("{Fh %d %s}", in.Fh,
 		flagString(fuseOpenFlagNames, int64(in.OpenFlags), ""))
 }
 
 func (in *InitIn) string() string {
 	return fmt.Sprintf("{%d.%d Ra 0x%x %s}",
-		in.Major, in.Minor, in.MaxReadAhead,
-		flagString(initFlagNames, int64(in.Flags), ""))
+		in.Major, in.Minor, in.MaxReadAhead, in.InitFlags())
 }
 
 func (o *InitOut) string() string {
 	return fmt.Sprintf("{%d.%d Ra 0x%x %s %d/%d Wr 0x%x Tg 0x%x}",
-		o.Major, o.Minor, o.MaxReadAhead,
-		flagString(initFlagNames, int64(o.Flags), ""),
+		o.Major, o.Minor, o.MaxReadAhead, o.InitFlags(),
 		o.CongestionThreshold, o.MaxBackground, o.MaxWrite,
 		o.TimeGran)
 }
@@ -207,6 +210,19 @@ func (o *AttrOut) string() string {
 		ft(o.AttrValid, o.AttrValidNsec), &o.Attr)
 }
 
+func (in *StatxIn) string() string {
+	return fmt.Sprintf("{Fh %d mask 0x%x flags 0x%x}", in.Fh, in.SxMask, in.SxFlags)
+}
+
+func (o *StatxOut) string() string {
+	return fmt.Sprintf(
+		"{tA=%gs mask 0x%x M0%o SZ=%d L=%d %d:%d B%d*%d i%d A %f M %f C %f B %f}",
+		ft(o.AttrValid, o.AttrValidNsec), o.Mask, o.Mode, o.Size,
+		o.Nlink, o.Uid, o.Gid, o.Blocks, o.Blksize, o.Ino,
+		ft(o.Atime.Sec, o.Atime.Nsec), ft(o.Mtime.Sec, o.Mtime.Nsec),
+		ft(o.Ctime.Sec, o.Ctime.Nsec), ft(o.Btime.Sec, o.Btime.Nsec))
+}
+
 // ft converts (seconds , nanoseconds) -> float(seconds)
 func ft(tsec uint64, tnsec uint32) float64 {
 	return float64(tsec) + float64(tnsec)*1e-9
@@ -284,6 +300,18 @@ var seekNames = map[uint32]string{
 	4: "HOLE",
 }
 
+func (in *PollIn) string() string {
+	return fmt.Sprintf("{Fh %d Kh %d Flags %x Events %x}", in.Fh, in.Kh, in.Flags, in.Events)
+}
+
+func (o *PollOut) string() string {
+	return fmt.Sprintf("{Revents %x}", o.Revents)
+}
+
+func (o *NotifyPollWakeupOut) string() string {
+	return fmt.Sprintf("{Kh %d}", o.Kh)
+}
+
 func (in *LseekIn) string() string {
 	return fmt.Sprintf("{Fh %d [%s +%d)}", in.Fh,
 		seekNames[in.Whence], in.Offset)
@@ -13,6 +13,24 @@ func init() {
 	openFlagNames[syscall.O_DIRECT] = "DIRECT"
 	openFlagNames[syscall.O_LARGEFILE] = "LARGEFILE"
 	openFlagNames[syscall_O_NOATIME] = "NOATIME"
+
+	initFlagNames[CAP_MAP_ALIGNMENT] = "MAP_ALIGNMENT"
+	initFlagNames[CAP_SUBMOUNTS] = "SUBMOUNTS"
+	initFlagNames[CAP_HANDLE_KILLPRIV_V2] = "HANDLE_KILLPRIV_V2"
+	initFlagNames[CAP_SETXATTR_EXT] = "SETXATTR_EXT"
+	initFlagNames[CAP_INIT_EXT] = "INIT_EXT"
+	initFlagNames[CAP_INIT_RESERVED] = "INIT_RESERVED"
+	initFlagNames[CAP_SECURITY_CTX] = "SECURITY_CTX"
+	initFlagNames[CAP_HAS_INODE_DAX] = "HAS_INODE_DAX"
+	initFlagNames[CAP_CREATE_SUPP_GROUP] = "CREATE_SUPP_GROUP"
+	initFlagNames[CAP_HAS_EXPIRE_ONLY] = "HAS_EXPIRE_ONLY"
+	initFlagNames[CAP_DIRECT_IO_ALLOW_MMAP] = "DIRECT_IO_ALLOW_MMAP"
+	initFlagNames[CAP_PASSTHROUGH] = "PASSTHROUGH"
+	initFlagNames[CAP_NO_EXPORT_SUPPORT] = "NO_EXPORT_SUPPORT"
+	initFlagNames[CAP_HAS_RESEND] = "HAS_RESEND"
+	initFlagNames[CAP_ALLOW_IDMAP] = "ALLOW_IDMAP"
+	initFlagNames[CAP_OVER_IO_URING] = "OVER_IO_URING"
+	initFlagNames[CAP_REQUEST_TIMEOUT] = "REQUEST_TIMEOUT"
 }
 
 func (a *Attr) string() string {
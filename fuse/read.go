@@ -6,6 +6,7 @@ package fuse
 
 import (
 	"io"
+	"log"
 	"syscall"
 )
 
@@ -73,3 +74,96 @@ func (r *readResultFd) Size() int {
 
 func (r *readResultFd) Done() {
 }
+
+// ReadResultVec returns the concatenation of bufs. The buffers are
+// passed to the kernel with writev(2), so they are not copied into a
+// single buffer first. They must not be changed until Done is called.
+func ReadResultVec(bufs [][]byte) ReadResult {
+	return &readResultVec{bufs}
+}
+
+// readResultVec is the read return for data held in several buffers.
+type readResultVec struct {
+	Data [][]byte
+}
+
+func (r *readResultVec) Size() int {
+	var total int
+	for _, b := range r.Data {
+		total += len(b)
+	}
+	return total
+}
+
+func (r *readResultVec) Done() {
+}
+
+// Bytes concatenates the buffers into buf, or into a new buffer if
+// buf is too small.
+func (r *readResultVec) Bytes(buf []byte) ([]byte, int) {
+	if sz := r.Size(); len(buf) < sz {
+		buf = make([]byte, sz)
+	}
+	n := 0
+	for _, b := range r.Data {
+		n += copy(buf[n:], b)
+	}
+	return buf[:n], 0
+}
+
+func (r *readResultVec) Slices() ([][]byte, int) {
+	return r.Data, 0
+}
+
+// ReadResultPages is like ReadResultVec, but maps the memory of bufs
+// into a pipe with vmsplice(2) and splices the pipe into the kernel,
+// so the data is copied only once, by the kernel. This pays off for
+// large buffers that are page-aligned, e.g. blocks of an mmap'd
+// cache. If splicing is not available, the buffers are written with
+// writev(2). They must not be changed until Done is called.
+func ReadResultPages(bufs [][]byte) ReadResult {
+	return &readResultPages{readResultVec{bufs}}
+}
+
+// readResultPages is the read return for page-aligned buffers.
+type readResultPages struct {
+	readResultVec
+}
+
+// ReadResultFunc returns a read result of at most size bytes that is
+// produced by fill only when the reply is sent, directly into the
+// output buffer of the transport. fill returns the number of bytes
+// it put into dest, or an error status.
+func ReadResultFunc(size int, fill func(dest []byte) (int, Status)) ReadResult {
+	return &readResultFunc{size, fill}
+}
+
+// readResultFunc is the read return for lazily produced data.
+type readResultFunc struct {
+	Sz   int
+	Fill func(dest []byte) (int, Status)
+}
+
+// Bytes fills buf, up to Size() bytes.
+func (r *readResultFunc) Bytes(buf []byte) ([]byte, int) {
+	sz := r.Sz
+	if len(buf) < sz {
+		sz = len(buf)
+	}
+	n, st := r.Fill(buf[:sz])
+	if !st.Ok() {
+		return nil, int(st)
+	}
+	if n < 0 || n > sz {
+		log.Printf("ReadResultFunc: fill returned %d bytes for a %d byte buffer", n, sz)
+		return nil, int(EIO)
+	}
+	return buf[:n], 0
+}
+
+func (r *readResultFunc) Size() int {
+	return r.Sz
+}
+
+func (r *readResultFunc) Done() {
+}
@@ -0,0 +1,210 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// A recording (see MountOptions.RecordTraffic) starts with
+// recordMagic, followed by records. Each record has a header of
+// recordHeaderSize bytes: the kind (recordRequest or recordReply),
+// the time in nanoseconds since the Unix epoch, and the length of the
+// data, all little-endian. The data is a request as read from the
+// FUSE device, or a reply as written to it.
+const (
+	recordMagic      = "GOFUSEREC1\n"
+	recordHeaderSize = 1 + 8 + 4
+
+	recordRequest = 1
+	recordReply   = 2
+)
+
+// ErrBadRecording is returned for recordings that cannot be parsed.
+var ErrBadRecording = errors.New("fuse: bad traffic recording")
+
+// TrafficRecord is a request or reply from a recording.
+type TrafficRecord struct {
+	Time time.Time
+
+	// Reply is set for replies (and notifications) written to the
+	// kernel, and unset for requests read from it.
+	Reply bool
+
+	// Data is the raw message, starting with InHeader or
+	// OutHeader.
+	Data []byte
+}
+
+// trafficRecorder writes records to MountOptions.RecordTraffic.
+type trafficRecorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	failed bool
+}
+
+func newTrafficRecorder(w io.Writer) *trafficRecorder {
+	r := &trafficRecorder{w: w}
+	if _, err := io.WriteString(w, recordMagic); err != nil {
+		log.Printf("recording traffic: %v", err)
+		r.failed = true
+	}
+	return r
+}
+
+func (r *trafficRecorder) record(kind byte, data ...[]byte) {
+	var hdr [recordHeaderSize]byte
+	hdr[0] = kind
+	binary.LittleEndian.PutUint64(hdr[1:], uint64(time.Now().UnixNano()))
+	n := 0
+	for _, d := range data {
+		n += len(d)
+	}
+	binary.LittleEndian.PutUint32(hdr[9:], uint32(n))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return
+	}
+	for _, d := range append([][]byte{hdr[:]}, data...) {
+		if _, err := r.w.Write(d); err != nil {
+			// Stop, rather than writing a corrupt log.
+			log.Printf("recording traffic: %v", err)
+			r.failed = true
+			return
+		}
+	}
+}
+
+// recordReply records the reply to req, with the given serialized
+// header.
+func (r *trafficRecorder) recordReply(header []byte, req *request) {
+	if req.slices != nil {
+		r.record(recordReply, append([][]byte{header}, req.slices...)...)
+	} else {
+		r.record(recordReply, header, req.flatData)
+	}
+}
+
+// ReadRecording parses a recording made with
+// MountOptions.RecordTraffic. A recording that was cut off in the
+// middle of a record returns the complete records, and
+// io.ErrUnexpectedEOF.
+func ReadRecording(r io.Reader) ([]TrafficRecord, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(recordMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != recordMagic {
+		return nil, ErrBadRecording
+	}
+
+	var recs []TrafficRecord
+	for {
+		var hdr [recordHeaderSize]byte
+		if _, err := io.ReadFull(br, hdr[:]); err == io.EOF {
+			return recs, nil
+		} else if err != nil {
+			return recs, err
+		}
+		kind := hdr[0]
+		if kind != recordRequest && kind != recordReply {
+			return recs, fmt.Errorf("%w: record kind %d", ErrBadRecording, kind)
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(hdr[9:]))
+		if _, err := io.ReadFull(br, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return recs, err
+		}
+		recs = append(recs, TrafficRecord{
+			Time:  time.Unix(0, int64(binary.LittleEndian.Uint64(hdr[1:]))),
+			Reply: kind == recordReply,
+			Data:  data,
+		})
+	}
+}
+
+// parseRecordedRequest parses the request in data.
+func parseRecordedRequest(data []byte) (*request, error) {
+	req := &request{cancel: make(chan struct{})}
+	req.setInput(append([]byte(nil), data...))
+	if !req.parseHeader().Ok() {
+		return nil, fmt.Errorf("%w: short request", ErrBadRecording)
+	}
+	req.parse()
+	return req, nil
+}
+
+// decodeReply loads the reply in data into req, which must be the
+// parsed request that it answers, for OutputDebug.
+func decodeReply(req *request, data []byte) error {
+	if len(data) < int(sizeOfOutHeader) {
+		return fmt.Errorf("%w: short reply", ErrBadRecording)
+	}
+	o := (*OutHeader)(unsafe.Pointer(&data[0]))
+	req.status = Status(-o.Status)
+	req.fdData = nil
+	req.funcData = nil
+	req.slices = nil
+
+	n := int(sizeOfOutHeader + req.outputSize())
+	if n > len(data) {
+		n = len(data)
+	}
+	copy(req.outBuf[:], data[:n])
+	req.flatData = data[n:]
+	return nil
+}
+
+// DumpRecording writes the records in recs to w, in the format of the
+// debug output (see MountOptions.Debug).
+func DumpRecording(w io.Writer, recs []TrafficRecord) error {
+	reqs := map[uint64]*request{}
+	for _, rec := range recs {
+		ts := rec.Time.Format("15:04:05.000000")
+		if !rec.Reply {
+			req, err := parseRecordedRequest(rec.Data)
+			if err != nil {
+				return err
+			}
+			reqs[req.inHeader.Unique] = req
+			if _, err := fmt.Fprintf(w, "%s %s\n", ts, req.InputDebug()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(rec.Data) < int(sizeOfOutHeader) {
+			return fmt.Errorf("%w: short reply", ErrBadRecording)
+		}
+		o := (*OutHeader)(unsafe.Pointer(&rec.Data[0]))
+		req := reqs[o.Unique]
+		var line string
+		if o.Unique == 0 {
+			line = fmt.Sprintf("tx notify %v: %db", Status(-o.Status), len(rec.Data))
+		} else if req == nil {
+			line = fmt.Sprintf("tx %d: reply to unknown request, %db", o.Unique, len(rec.Data))
+		} else {
+			if err := decodeReply(req, rec.Data); err != nil {
+				return err
+			}
+			line = req.OutputDebug()
+			delete(reqs, o.Unique)
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", ts, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
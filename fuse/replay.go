@@ -0,0 +1,133 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"unsafe"
+)
+
+// ReplayDiff is a request whose reply during Replay differs from the
+// recorded one.
+type ReplayDiff struct {
+	Unique uint64
+	Op     string
+
+	// Want is the recorded reply, or nil if the recording has no
+	// reply. Got is the reply of the replayed file system, or nil
+	// if it sends no reply.
+	Want, Got []byte
+
+	// Debug output for the request and both replies.
+	input, want, got string
+}
+
+func (d *ReplayDiff) String() string {
+	return fmt.Sprintf("%s\n  recorded %s\n  replayed %s", d.input, d.want, d.got)
+}
+
+// Replay feeds the requests of a recording (see ReadRecording) to fs,
+// as if they came from the kernel, but without mounting, and returns
+// the requests whose replies differ from the recorded ones. The
+// requests are processed one at a time, in the order they were read.
+// opts should be the options of the recorded session, as they affect
+// the reply to INIT.
+func Replay(recs []TrafficRecord, fs RawFileSystem, opts *MountOptions) ([]ReplayDiff, error) {
+	o := MountOptions{MaxBackground: _DEFAULT_BACKGROUND_TASKS}
+	if opts != nil {
+		o = *opts
+	}
+	o.RecordTraffic = nil
+	ms, err := newServer(fs, "/", &o)
+	if err != nil {
+		return nil, err
+	}
+	ms.mountFd = -1
+	// Negotiate INIT as the recording server did.
+	ms.opts.RecordTraffic = ioutil.Discard
+
+	want := map[uint64][]byte{}
+	for _, rec := range recs {
+		if !rec.Reply || len(rec.Data) < int(sizeOfOutHeader) {
+			continue
+		}
+		o := (*OutHeader)(unsafe.Pointer(&rec.Data[0]))
+		if o.Unique != 0 {
+			want[o.Unique] = rec.Data
+		}
+	}
+
+	var diffs []ReplayDiff
+	for _, rec := range recs {
+		if rec.Reply {
+			continue
+		}
+		req, err := parseRecordedRequest(rec.Data)
+		if err != nil {
+			return diffs, err
+		}
+		input := req.InputDebug()
+		unique := req.inHeader.Unique
+		ms.dispatch(req)
+		if req.inHeader.Opcode == _OP_INIT && req.status.Ok() {
+			ms.fileSystem.Init(ms)
+		}
+		got := ms.replyBytes(req)
+		gotStr := "no reply"
+		if got != nil {
+			gotStr = req.OutputDebug()
+		}
+
+		w := want[unique]
+		if bytes.Equal(w, got) {
+			continue
+		}
+		wantStr := "no reply"
+		if w != nil {
+			if wreq, err := parseRecordedRequest(rec.Data); err == nil && decodeReply(wreq, w) == nil {
+				wantStr = wreq.OutputDebug()
+			}
+		}
+		diffs = append(diffs, ReplayDiff{
+			Unique: unique,
+			Op:     operationName(req.inHeader.Opcode),
+			Want:   w,
+			Got:    got,
+			input:  input,
+			want:   wantStr,
+			got:    gotStr,
+		})
+	}
+	return diffs, nil
+}
+
+// replyBytes returns the reply to req as it would be written to the
+// FUSE device, or nil if the request has no reply.
+func (ms *Server) replyBytes(req *request) []byte {
+	switch req.inHeader.Opcode {
+	case _OP_FORGET, _OP_BATCH_FORGET, _OP_NOTIFY_REPLY:
+		return nil
+	case _OP_INTERRUPT:
+		if req.status.Ok() {
+			return nil
+		}
+	}
+
+	ms.fillData(req)
+	out := append([]byte(nil), req.serializeHeader(req.flatDataSize())...)
+	if req.slices != nil {
+		for _, s := range req.slices {
+			out = append(out, s...)
+		}
+	} else {
+		out = append(out, req.flatData...)
+	}
+	if req.readResult != nil {
+		req.readResult.Done()
+	}
+	return out
+}
@@ -17,12 +17,36 @@ var sizeOfOutHeader = unsafe.Sizeof(OutHeader{})
 var zeroOutBuf [outputHeaderSize]byte
 
 type request struct {
+	// goroutine is the ID of the goroutine serving the request,
+	// if MountOptions.StuckRequestThreshold is set. Accessed
+	// atomically; first for 64-bit alignment.
+	goroutine int64
+
 	inflightIndex int
 
 	cancel chan struct{}
 
 	// written under Server.reqMu
 	interrupted bool
+	stuckWarned bool
+
+	// timedOut is set if the request was answered because its
+	// timeout (see MountOptions.RequestTimeout) fired, and
+	// replying if the file system started answering it first.
+	// Written under Server.reqMu.
+	timedOut bool
+	replying bool
+
+	// timer fires the timeout of the request.
+	timer *time.Timer
+
+	// fromSelf is set if the request comes from the serving
+	// process (see MountOptions.SelfAccess).
+	fromSelf bool
+
+	// parsed is set atomically once filenames is valid, for
+	// Server.InflightRequests.
+	parsed uint32
 
 	inputBuf []byte
 
@@ -37,18 +61,34 @@ type request struct {
 	status   Status
 	flatData []byte
 	fdData   *readResultFd
+	funcData *readResultFunc
 	slices   [][]byte
 
 	// In case of read, keep read result here so we can call
 	// Done() on it.
 	readResult ReadResult
 
+	// replySize is the size of the reply that was sent.
+	replySize int
+
 	// Start timestamp for timing info.
 	startTime time.Time
 
 	// All information pertaining to opcode of this request.
 	handler *operationHandler
 
+	// channel the request was read from, and must be answered
+	// on. Nil for notifications, which use the mount's fd.
+	channel *channel
+
+	// uringEntry holds the request if it arrived over io_uring;
+	// the reply goes into the same entry.
+	uringEntry *uringEntry
+
+	// pipeData holds the data of a WRITE that was left in a pipe
+	// (see MountOptions.EnableSpliceRead).
+	pipeData *PipeData
+
 	// Request storage. For large inputs and outputs, use data
 	// obtained through bufferpool.
 	bufferPoolInputBuf  []byte
@@ -70,13 +110,24 @@ func (r *request) clear() {
 	r.inData = nil
 	r.arg = nil
 	r.filenames = nil
+	r.parsed = 0
+	r.goroutine = 0
+	r.stuckWarned = false
+	r.timedOut = false
+	r.replying = false
+	r.timer = nil
+	r.fromSelf = false
 	r.status = OK
 	r.flatData = nil
 	r.fdData = nil
+	r.funcData = nil
 	r.slices = nil
 	r.startTime = time.Time{}
 	r.handler = nil
 	r.readResult = nil
+	r.replySize = 0
+	r.channel = nil
+	r.uringEntry = nil
 }
 
 func (r *request) InputDebug() string {
@@ -104,6 +155,9 @@ func (r *request) InputDebug() string {
 
 		names += fmt.Sprintf("%s %db", data, len(r.arg))
 	}
+	if r.pipeData != nil {
+		names += fmt.Sprintf("%db in pipe", r.pipeData.Size())
+	}
 
 	return fmt.Sprintf("rx %d: %s n%d %s%s",
 		r.inHeader.Unique, operationName(r.inHeader.Opcode), r.inHeader.NodeId,
@@ -130,6 +184,8 @@ func (r *request) OutputDebug() string {
 			spl := ""
 			if r.fdData != nil {
 				spl = " (fd data)"
+			} else if r.funcData != nil {
+				spl = " (lazy data)"
 			} else if r.slices != nil {
 				spl = fmt.Sprintf(" (%d slices)", len(r.slices))
 			} else {
@@ -232,6 +288,19 @@ func (r *request) outData() unsafe.Pointer {
 // serializeHeader serializes the response header. The header points
 // to an internal buffer of the receiver.
 func (r *request) serializeHeader(flatDataSize int) (header []byte) {
+	dataLength := r.outputSize()
+	header = r.outBuf[:sizeOfOutHeader+dataLength]
+	o := (*OutHeader)(unsafe.Pointer(&header[0]))
+	o.Unique = r.inHeader.Unique
+	o.Status = int32(-r.status)
+	o.Length = uint32(
+		int(sizeOfOutHeader) + int(dataLength) + flatDataSize)
+	return header
+}
+
+// outputSize returns the size of the structured reply data for the
+// current status.
+func (r *request) outputSize() uintptr {
 	var dataLength uintptr
 
 	if r.handler != nil {
@@ -251,20 +320,16 @@ func (r *request) serializeHeader(flatDataSize int) (header []byte) {
 			dataLength = 0
 		}
 	}
-
-	header = r.outBuf[:sizeOfOutHeader+dataLength]
-	o := (*OutHeader)(unsafe.Pointer(&header[0]))
-	o.Unique = r.inHeader.Unique
-	o.Status = int32(-r.status)
-	o.Length = uint32(
-		int(sizeOfOutHeader) + int(dataLength) + flatDataSize)
-	return header
+	return dataLength
 }
 
 func (r *request) flatDataSize() int {
 	if r.fdData != nil {
 		return r.fdData.Size()
 	}
+	if r.funcData != nil {
+		return r.funcData.Size()
+	}
 	if r.slices != nil {
 		var total int
 		for _, s := range r.slices {
@@ -4,10 +4,10 @@
 
 package fuse
 
-const outputHeaderSize = 160
+const outputHeaderSize = 304
 
 const (
 	_FUSE_KERNEL_VERSION   = 7
 	_MINIMUM_MINOR_VERSION = 12
-	_OUR_MINOR_VERSION     = 28
+	_OUR_MINOR_VERSION     = 40
 )
@@ -0,0 +1,348 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OpClass groups FUSE operations for the request scheduler (see
+// SchedulerOptions). The classes are listed in order of priority.
+type OpClass int
+
+const (
+	// OpClassNotify has NOTIFY_REPLY, which answers
+	// Server.InodeRetrieveCache.
+	OpClassNotify OpClass = iota
+
+	// OpClassMetadata has operations on names and attributes, eg.
+	// LOOKUP, GETATTR, OPEN and RELEASE, and all operations that
+	// are not in other classes.
+	OpClassMetadata
+
+	// OpClassDirectory has directory listing: OPENDIR, READDIR,
+	// READDIRPLUS, RELEASEDIR and FSYNCDIR.
+	OpClassDirectory
+
+	// OpClassData has file I/O, eg. READ, WRITE, FSYNC and
+	// COPY_FILE_RANGE.
+	OpClassData
+
+	numOpClasses
+)
+
+func (c OpClass) String() string {
+	switch c {
+	case OpClassNotify:
+		return "notify"
+	case OpClassMetadata:
+		return "metadata"
+	case OpClassDirectory:
+		return "directory"
+	case OpClassData:
+		return "data"
+	}
+	return fmt.Sprintf("OpClass(%d)", int(c))
+}
+
+// opClass returns the class of an opcode. It returns false for
+// control messages, which are not queued.
+func opClass(op uint32) (OpClass, bool) {
+	switch op {
+	case _OP_INTERRUPT, _OP_FORGET, _OP_BATCH_FORGET,
+		// SETLKW waits for other processes, for as long as
+		// they like, so it must not hold a worker.
+		_OP_SETLKW:
+		return 0, false
+	case _OP_NOTIFY_REPLY:
+		return OpClassNotify, true
+	case _OP_OPENDIR, _OP_READDIR, _OP_READDIRPLUS, _OP_RELEASEDIR, _OP_FSYNCDIR:
+		return OpClassDirectory, true
+	case _OP_READ, _OP_WRITE, _OP_FSYNC, _OP_FLUSH, _OP_FALLOCATE, _OP_LSEEK,
+		_OP_COPY_FILE_RANGE, _OP_GETLK, _OP_SETLK, _OP_POLL, _OP_IOCTL, _OP_BMAP:
+		return OpClassData, true
+	}
+	return OpClassMetadata, true
+}
+
+// SchedulerOptions configures the request scheduler (see
+// MountOptions.Scheduler).
+type SchedulerOptions struct {
+	// Workers is the number of goroutines that serve requests.
+	// One of them is kept for OpClassNotify. The default is 16,
+	// and the minimum 2.
+	Workers int
+
+	// Limits caps the number of requests of each class that are
+	// served at the same time, so slow operations of one class
+	// cannot occupy all workers. Classes without a limit can use
+	// all workers, except that OpClassData defaults to half of
+	// them.
+	Limits map[OpClass]int
+
+	// MaxQueued caps the number of queued requests of each class,
+	// except OpClassNotify; each holds a read buffer. A reader that
+	// gets a request for a full queue waits for space, and no new
+	// readers are started meanwhile, so INTERRUPT, FORGET and
+	// NOTIFY_REPLY are not read either. If requests wait for
+	// Server.InodeRetrieveCache, make sure their class cannot fill
+	// up. The default is Workers.
+	MaxQueued int
+
+	// Priority makes idle workers take the queued request of the
+	// class that comes first in the OpClass list, rather than the
+	// request that was read first.
+	Priority bool
+}
+
+const defaultSchedulerWorkers = 16
+
+// SchedulerStats describes the queue of one class of operations.
+type SchedulerStats struct {
+	Class OpClass
+
+	// Limit is the maximum of Running.
+	Limit int
+
+	// Queued is the number of requests waiting for a worker, and
+	// Running the number of requests being served.
+	Queued  int
+	Running int
+
+	// Served is the number of requests that were taken from the
+	// queue, and Waited the total time they spent in it.
+	Served uint64
+	Waited time.Duration
+}
+
+// job is a queued request.
+type job struct {
+	queued time.Time
+	seq    uint64
+	run    func()
+}
+
+// scheduler runs requests on a pool of workers.
+type scheduler struct {
+	workers   int
+	limits    [numOpClasses]int
+	maxQueued int
+	priority  bool
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queues  [numOpClasses][]*job
+	running [numOpClasses]int
+	served  [numOpClasses]uint64
+	waited  [numOpClasses]time.Duration
+	seq     uint64
+	closed  bool
+
+	// busy is the number of workers serving requests of classes
+	// other than OpClassNotify.
+	busy int
+	wg   sync.WaitGroup
+}
+
+func newScheduler(o *SchedulerOptions) (*scheduler, error) {
+	s := &scheduler{
+		workers:   o.Workers,
+		maxQueued: o.MaxQueued,
+		priority:  o.Priority,
+	}
+	if s.workers == 0 {
+		s.workers = defaultSchedulerWorkers
+	}
+	if s.workers < 2 {
+		return nil, fmt.Errorf("Scheduler: need at least 2 workers, have %d", s.workers)
+	}
+	if s.maxQueued == 0 {
+		s.maxQueued = s.workers
+	}
+	if s.maxQueued < 0 {
+		return nil, fmt.Errorf("Scheduler: MaxQueued %d must be positive", s.maxQueued)
+	}
+	for c := range s.limits {
+		s.limits[c] = s.workers
+	}
+	s.limits[OpClassData] = s.workers / 2
+	for c, l := range o.Limits {
+		if c < 0 || c >= numOpClasses {
+			return nil, fmt.Errorf("Scheduler: unknown class %v", c)
+		}
+		if l <= 0 {
+			return nil, fmt.Errorf("Scheduler: limit %d for %v must be positive", l, c)
+		}
+		s.limits[c] = l
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s, nil
+}
+
+func (s *scheduler) start() {
+	s.wg.Add(s.workers)
+	for i := 0; i < s.workers; i++ {
+		go s.work()
+	}
+}
+
+// stop waits for the queued requests to be served, and stops the
+// workers.
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// submit queues run, which serves a request of the given class. It
+// waits while the queue of the class is full.
+func (s *scheduler) submit(class OpClass, run func()) {
+	s.mu.Lock()
+	for class != OpClassNotify && len(s.queues[class]) >= s.maxQueued && !s.closed {
+		s.cond.Wait()
+	}
+	s.seq++
+	s.queues[class] = append(s.queues[class], &job{
+		queued: time.Now(),
+		seq:    s.seq,
+		run:    run,
+	})
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// next returns the next job that may run, and its class. It must be
+// called under mu.
+func (s *scheduler) next() (*job, OpClass) {
+	best := OpClass(-1)
+	for c := OpClass(0); c < numOpClasses; c++ {
+		q := s.queues[c]
+		if len(q) == 0 || s.running[c] >= s.limits[c] {
+			continue
+		}
+		if c != OpClassNotify && s.busy >= s.workers-1 {
+			// Keep a worker for NOTIFY_REPLY, which
+			// requests in other classes may wait for.
+			continue
+		}
+		if best < 0 || !s.priority && q[0].seq < s.queues[best][0].seq {
+			best = c
+		}
+	}
+	if best < 0 {
+		return nil, 0
+	}
+	j := s.queues[best][0]
+	s.queues[best][0] = nil
+	s.queues[best] = s.queues[best][1:]
+	return j, best
+}
+
+func (s *scheduler) work() {
+	defer s.wg.Done()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		j, c := s.next()
+		if j == nil {
+			if s.closed && s.empty() {
+				return
+			}
+			s.cond.Wait()
+			continue
+		}
+
+		s.running[c]++
+		if c != OpClassNotify {
+			s.busy++
+		}
+		s.served[c]++
+		s.waited[c] += time.Since(j.queued)
+		// A reader may be waiting for space in the queue.
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		j.run()
+
+		s.mu.Lock()
+		s.running[c]--
+		if c != OpClassNotify {
+			s.busy--
+		}
+		// A worker may be waiting for this class' limit.
+		s.cond.Broadcast()
+	}
+}
+
+// full tells if a queue is full, so readers should not be added.
+func (s *scheduler) full() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, q := range s.queues {
+		if OpClass(c) != OpClassNotify && len(q) >= s.maxQueued {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scheduler) empty() bool {
+	for _, q := range s.queues {
+		if len(q) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *scheduler) stats() []SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := make([]SchedulerStats, 0, numOpClasses)
+	for c := OpClass(0); c < numOpClasses; c++ {
+		r = append(r, SchedulerStats{
+			Class:   c,
+			Limit:   s.limits[c],
+			Queued:  len(s.queues[c]),
+			Running: s.running[c],
+			Served:  s.served[c],
+			Waited:  s.waited[c],
+		})
+	}
+	return r
+}
+
+// SchedulerStats returns the state of the queues of the request
+// scheduler, or nil if MountOptions.Scheduler is not set.
+func (ms *Server) SchedulerStats() []SchedulerStats {
+	if ms.scheduler == nil {
+		return nil
+	}
+	return ms.scheduler.stats()
+}
+
+// schedule serves req through the scheduler, calling done afterwards.
+// It returns false if the request should be served directly.
+func (ms *Server) schedule(req *request, done func()) bool {
+	if ms.scheduler == nil {
+		return false
+	}
+	class, ok := opClass(req.inHeader.Opcode)
+	if !ok {
+		return false
+	}
+	ms.scheduler.submit(class, func() {
+		ms.handleRequest(req)
+		if done != nil {
+			done()
+		}
+	})
+	return true
+}
@@ -0,0 +1,160 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"bytes"
+	"log"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// SelfAccessPolicy says how the server handles requests that come
+// from its own process (see MountOptions.SelfAccess). Such requests
+// come from code that accesses the mount from the serving process,
+// which can deadlock if the server has no reader or worker left to
+// serve them, eg. because a file system method accesses the mount.
+type SelfAccessPolicy int
+
+const (
+	// SelfAccessIgnore serves requests from the serving process
+	// like all others. It is the default, and does not look at
+	// the caller of requests.
+	SelfAccessIgnore SelfAccessPolicy = iota
+
+	// SelfAccessServe serves requests from the serving process on
+	// goroutines that are reserved for them, each locked to its
+	// own OS thread. They do not hold up the readers, and bypass
+	// MountOptions.Scheduler.
+	SelfAccessServe
+
+	// SelfAccessFail fails requests from the serving process with
+	// EDEADLK, and logs the stacks of the goroutines that are in
+	// system calls, one of which made the request. Requests that
+	// release resources, eg. RELEASE, are still served as with
+	// SelfAccessServe.
+	SelfAccessFail
+)
+
+// selfAccessWorkers is the number of goroutines reserved for requests
+// from the serving process.
+const selfAccessWorkers = 4
+
+// selfAccessLogInterval limits the diagnostics of SelfAccessFail,
+// unless debugging is enabled.
+const selfAccessLogInterval = time.Second
+
+// selfJob is a request from the serving process, and the function to
+// call after serving it.
+type selfJob struct {
+	req  *request
+	done func()
+}
+
+// fromSelf tells if req comes from the serving process.
+func (ms *Server) fromSelf(req *request) bool {
+	pid := req.inHeader.Caller.Pid
+	if pid == 0 {
+		// The caller is not visible in our PID namespace.
+		return false
+	}
+	return int(pid) == ms.selfPid || ownThread(pid)
+}
+
+// startSelfAccess starts the goroutines for requests from the serving
+// process.
+func (ms *Server) startSelfAccess() {
+	ms.selfQueue = make(chan selfJob, selfAccessWorkers)
+	ms.selfWorkers.Add(selfAccessWorkers)
+	for i := 0; i < selfAccessWorkers; i++ {
+		go ms.selfAccessWorker()
+	}
+}
+
+// stopSelfAccess stops the goroutines for requests from the serving
+// process, once they have served the queued requests.
+func (ms *Server) stopSelfAccess() {
+	close(ms.selfQueue)
+	ms.selfWorkers.Wait()
+}
+
+func (ms *Server) selfAccessWorker() {
+	defer ms.selfWorkers.Done()
+	// Keep an OS thread for each worker, so serving does not
+	// depend on the runtime starting threads.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for j := range ms.selfQueue {
+		ms.handleRequest(j.req)
+		if j.done != nil {
+			j.done()
+		}
+	}
+}
+
+// serveSelfAccess serves req on the reserved goroutines if it comes
+// from the serving process, calling done afterwards. It returns false
+// if the request should be served as usual.
+func (ms *Server) serveSelfAccess(req *request, done func()) bool {
+	if ms.opts.SelfAccess == SelfAccessIgnore || !ms.fromSelf(req) {
+		return false
+	}
+	req.fromSelf = true
+	select {
+	case ms.selfQueue <- selfJob{req, done}:
+	default:
+		// All reserved goroutines are busy, possibly waiting
+		// for this request. Don't wait for them.
+		go func() {
+			ms.handleRequest(req)
+			if done != nil {
+				done()
+			}
+		}()
+	}
+	return true
+}
+
+// failSelfAccess fails req with EDEADLK, if MountOptions.SelfAccess
+// says so. It returns true if it did.
+func (ms *Server) failSelfAccess(req *request) bool {
+	if !req.fromSelf || ms.opts.SelfAccess != SelfAccessFail || !req.status.Ok() {
+		return false
+	}
+	switch req.inHeader.Opcode {
+	case _OP_FORGET, _OP_BATCH_FORGET, _OP_INTERRUPT, _OP_NOTIFY_REPLY,
+		_OP_RELEASE, _OP_RELEASEDIR, _OP_FLUSH, _OP_DESTROY:
+		// The kernel does not retry these, so failing them
+		// would leak resources.
+		return false
+	}
+	req.status = Status(syscall.EDEADLK)
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&ms.selfAccessLogged)
+	if !ms.opts.Debug && now-last < int64(selfAccessLogInterval) ||
+		!atomic.CompareAndSwapInt64(&ms.selfAccessLogged, last, now) {
+		return true
+	}
+	pid := req.inHeader.Caller.Pid
+	log.Printf("failing %s n%d %q from the serving process (thread %d, %s) with EDEADLK; goroutines in system calls:\n%s",
+		operationName(req.inHeader.Opcode), req.inHeader.NodeId, req.filenames,
+		pid, processName(pid), syscallStacks())
+	return true
+}
+
+// syscallStacks returns the stacks of the goroutines that are in
+// system calls.
+func syscallStacks() []byte {
+	var r [][]byte
+	for _, s := range bytes.Split(allStacks(), []byte("\n\n")) {
+		if bytes.Contains(s, []byte(" [syscall")) {
+			r = append(r, s)
+		}
+	}
+	return bytes.Join(r, []byte("\n\n"))
+}
@@ -0,0 +1,17 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// ownThread tells if tid, which the kernel reports as the caller of
+// requests, is a thread of the current process.
+func ownThread(tid uint32) bool {
+	var st syscall.Stat_t
+	return syscall.Stat(fmt.Sprintf("/proc/self/task/%d", tid), &st) == nil
+}
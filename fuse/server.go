@@ -8,12 +8,9 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -36,10 +33,18 @@ const (
 // Server contains the logic for reading from the FUSE device and
 // translating it to RawFileSystem interface calls.
 type Server struct {
-	// Empty if unmounted.
+	// Empty if unmounted. Protected by reqMu.
 	mountPoint string
 	fileSystem RawFileSystem
 
+	// autoUnmountComm is the socket to fusermount, which
+	// unmounts once it is closed (see MountOptions.AutoUnmount).
+	autoUnmountComm *os.File
+
+	// detachedMount is a copy of the mount of NewDetachedServer,
+	// for WaitMount.
+	detachedMount *os.File
+
 	// writeMu serializes close and notify writes
 	writeMu sync.RWMutex
 
@@ -47,12 +52,24 @@ type Server struct {
 	mountFd int
 
 	latencies LatencyMap
+	metrics   MetricsRecorder
+
+	// recorder writes MountOptions.RecordTraffic, if set.
+	recorder *trafficRecorder
 
 	opts *MountOptions
 
 	// maxReaders is the maximum number of goroutines reading requests
 	maxReaders int
 
+	// channels are the fds that readers use. Protected by reqMu.
+	channels    []*channel
+	cloneFailed bool
+
+	// uring is set if requests arrive over io_uring. Protected by
+	// reqMu.
+	uring *uringTransport
+
 	// Pools for []byte
 	buffers bufferPool
 
@@ -60,11 +77,34 @@ type Server struct {
 	reqPool sync.Pool
 
 	// Pool for raw requests data
-	readPool       sync.Pool
-	reqMu          sync.Mutex
-	reqReaders     int
-	reqInflight    []*request
-	recentUnique   []uint64
+	readPool    sync.Pool
+	reqMu       sync.Mutex
+	reqReaders  int
+	reqInflight []*request
+
+	// pendingInterrupts has the INTERRUPTs that were read before
+	// their request, by the unique ID of the request. completed
+	// has the unique IDs of the last answered requests, as a ring
+	// buffer. Protected by reqMu.
+	pendingInterrupts map[uint64]*pendingInterrupt
+	completed         [completedRingSize]uint64
+	completedNext     int
+
+	// scheduler serves requests if MountOptions.Scheduler is set.
+	scheduler *scheduler
+
+	// selfPid is our process ID, and selfQueue feeds the
+	// goroutines for requests that come from it (see
+	// MountOptions.SelfAccess). selfAccessLogged is the time of
+	// the last EDEADLK diagnostic, in Unix nanoseconds.
+	selfPid          int
+	selfQueue        chan selfJob
+	selfWorkers      sync.WaitGroup
+	selfAccessLogged int64
+
+	// timeouts has the timeout for each opcode, or is nil if no
+	// request times out (see MountOptions.RequestTimeout).
+	timeouts       []time.Duration
 	kernelSettings InitIn
 
 	// in-flight notify-retrieve queries
@@ -74,9 +114,21 @@ type Server struct {
 
 	singleReader bool
 	canSplice    bool
-	loops        sync.WaitGroup
-	writes       int64
-	shutdown     bool
+
+	// spliceRead is set if requests are read with splice(2); see
+	// MountOptions.EnableSpliceRead.
+	spliceRead bool
+	loops      sync.WaitGroup
+	writes     int64
+	shutdown   bool
+
+	// handedOver is set once another process took over the FUSE
+	// device (see TakeoverListener).
+	handedOver bool
+
+	// socket is set if mountFd is a socket rather than the FUSE
+	// device (see NewSocketServer).
+	socket bool
 
 	ready chan error
 
@@ -101,6 +153,22 @@ func (ms *Server) KernelSettings() *InitIn {
 	return &s
 }
 
+// NegotiatedCapabilities returns the capabilities that were agreed
+// on with the kernel in the INIT handshake. File systems can use this
+// to fall back if an optional capability (eg. CAP_WRITEBACK_CACHE)
+// was refused.
+func (ms *Server) NegotiatedCapabilities() InitFlags {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	return ms.kernelSettings.InitFlags()
+}
+
+// missingCapabilities returns the required capabilities that the
+// kernel did not grant.
+func (ms *Server) missingCapabilities() InitFlags {
+	return ms.opts.Capabilities.Required &^ ms.NegotiatedCapabilities()
+}
+
 const _MAX_NAME_LEN = 20
 
 // This type may be provided for recording latencies of each FUSE
@@ -115,16 +183,85 @@ func (ms *Server) RecordLatencies(l LatencyMap) {
 	ms.latencies = l
 }
 
+// RequestMetrics describes a request that was answered.
+type RequestMetrics struct {
+	// Op is the name of the operation, eg. "LOOKUP".
+	Op string
+
+	// Latency is the time between reading the request and
+	// finishing its reply.
+	Latency time.Duration
+
+	// Status is the result of the operation.
+	Status Status
+
+	// InBytes is the size of the request, including headers and
+	// WRITE data. OutBytes is the size of the reply, or 0 if the
+	// operation has no reply.
+	InBytes  int
+	OutBytes int
+}
+
+// MetricsRecorder receives a RequestMetrics for each request. It is
+// called concurrently from the goroutines serving requests.
+type MetricsRecorder interface {
+	RecordRequest(m *RequestMetrics)
+}
+
+// RecordMetrics switches on collection of per-request metrics (see
+// the fuse/metrics package). Passing nil switches it off. It should
+// be called before Serve.
+func (ms *Server) RecordMetrics(r MetricsRecorder) {
+	ms.metrics = r
+}
+
+// LoadStats is a snapshot of the requests a server is working on.
+type LoadStats struct {
+	// Readers is the number of goroutines waiting for a request
+	// from the kernel, and MaxReaders their limit.
+	Readers    int
+	MaxReaders int
+
+	// Inflight is the number of requests that were read but not
+	// answered yet.
+	Inflight int
+}
+
+// LoadStats returns the current load of the server.
+func (ms *Server) LoadStats() LoadStats {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	return LoadStats{
+		Readers:    ms.reqReaders,
+		MaxReaders: ms.maxReaders,
+		Inflight:   len(ms.reqInflight),
+	}
+}
+
 // Unmount calls fusermount -u on the mount. This has the effect of
 // shutting down the filesystem. After the Server is unmounted, it
 // should be discarded.
 func (ms *Server) Unmount() (err error) {
-	if ms.mountPoint == "" {
+	return ms.unmount(false)
+}
+
+// UnmountLazy detaches the mount (umount with MNT_DETACH, or
+// fusermount -z), rather than failing with EBUSY while files on it
+// are open. The server keeps serving the open files, and Serve
+// returns once they are closed; UnmountLazy does not wait for that.
+// Linux only.
+func (ms *Server) UnmountLazy() error {
+	return ms.unmount(true)
+}
+
+func (ms *Server) unmount(lazy bool) (err error) {
+	mountPoint := ms.getMountPoint()
+	if mountPoint == "" {
 		return nil
 	}
 	delay := time.Duration(0)
 	for try := 0; try < 5; try++ {
-		err = unmount(ms.mountPoint, ms.opts)
+		err = unmount(mountPoint, ms.opts, lazy)
 		if err == nil {
 			break
 		}
@@ -138,14 +275,45 @@ func (ms *Server) Unmount() (err error) {
 	if err != nil {
 		return
 	}
-	// Wait for event loops to exit.
-	ms.loops.Wait()
+	if !lazy {
+		// Wait for event loops to exit. After a lazy unmount,
+		// open files keep them going.
+		ms.loops.Wait()
+	}
+	ms.reqMu.Lock()
 	ms.mountPoint = ""
+	ms.reqMu.Unlock()
 	return err
 }
 
+// getMountPoint returns the mount point, or "" if the server was
+// unmounted or handed over.
+func (ms *Server) getMountPoint() string {
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	return ms.mountPoint
+}
+
 // NewServer creates a server and attaches it to the given directory.
 func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server, error) {
+	ms, err := newServer(fs, mountPoint, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ms.mount(ms.opts)
+	if err != nil {
+		log.Printf("mount: %s", err)
+		return nil, err
+	}
+	// This prepares for Serve being called somewhere, either
+	// synchronously or asynchronously.
+	ms.loops.Add(1)
+	return ms, nil
+}
+
+// newServer sets up a Server for mountPoint, without mounting.
+func newServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server, error) {
 	if opts == nil {
 		opts = &MountOptions{
 			MaxBackground: _DEFAULT_BACKGROUND_TASKS,
@@ -171,17 +339,23 @@ func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server
 		o.Name = strings.Replace(name[:l], ",", ";", -1)
 	}
 
-	for _, s := range o.optionsStrings() {
-		if strings.Contains(s, ",") {
-			return nil, fmt.Errorf("found ',' in option string %q", s)
+	// Options are joined with ',' for mounting, except by
+	// fsconfig(2) on Linux, which mount checks for.
+	if !o.DirectMount || runtime.GOOS != "linux" {
+		if err := checkOptionCommas(o.optionsStrings()); err != nil {
+			return nil, err
 		}
 	}
 
-	maxReaders := runtime.GOMAXPROCS(0)
+	maxReaders := o.MaxReaders
+	if maxReaders <= 0 {
+		maxReaders = runtime.GOMAXPROCS(0)
+		if maxReaders > maxMaxReaders {
+			maxReaders = maxMaxReaders
+		}
+	}
 	if maxReaders < minMaxReaders {
 		maxReaders = minMaxReaders
-	} else if maxReaders > maxMaxReaders {
-		maxReaders = maxMaxReaders
 	}
 
 	ms := &Server{
@@ -193,8 +367,22 @@ func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server
 		// FUSE device: on unmount, sometime some reads do not
 		// error-out, meaning that unmount will hang.
 		singleReader: runtime.GOOS == "darwin",
+		selfPid:      os.Getpid(),
 		ready:        make(chan error, 1),
 	}
+	if err := ms.setTimeouts(); err != nil {
+		return nil, err
+	}
+	if o.Scheduler != nil {
+		sched, err := newScheduler(o.Scheduler)
+		if err != nil {
+			return nil, err
+		}
+		ms.scheduler = sched
+	}
+	if o.RecordTraffic != nil {
+		ms.recorder = newTrafficRecorder(o.RecordTraffic)
+	}
 	ms.reqPool.New = func() interface{} {
 		return &request{
 			cancel: make(chan struct{}),
@@ -214,86 +402,81 @@ func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server
 		mountPoint = filepath.Clean(filepath.Join(cwd, mountPoint))
 	}
 	ms.mountPoint = mountPoint
-
-	err := ms.mount(&o)
-	if err != nil {
-		log.Printf("mount: %s", err)
-		return nil, err
-	}
-	// This prepares for Serve being called somewhere, either
-	// synchronously or asynchronously.
-	ms.loops.Add(1)
 	return ms, nil
 }
 
 func (ms *Server) mount(opt *MountOptions) error {
-	path := os.Getenv("_FUSE_FD_COMM")
-	if path != "" {
-		c, err := net.Dial("unix", path)
-		if err != nil {
-			return fmt.Errorf("dial %s: %s", path, err)
-		}
-		defer c.Close()
-
-		msg, fds, err := getFd(c.(*net.UnixConn), 2)
-		if err != nil {
-			return fmt.Errorf("get fd: %s", err)
-		}
-
-		if len(fds) > 0 {
-			// the first sone is not needed
-			syscall.Close(fds[0])
-		}
-		if len(fds) == 2 {
-			if len(msg) < int(unsafe.Sizeof(InitIn{})) {
-				return fmt.Errorf("short setting: %d < %d", len(msg), unsafe.Sizeof(InitIn{}))
-			}
-			close(ms.ready)
-			ms.kernelSettings = *(*InitIn)(unsafe.Pointer(&msg[0]))
-			if ms.kernelSettings.Minor >= 13 {
-				ms.setSplice()
-			}
-			// log.Println("setting %+v", ms.kernelSettings)
-			syscall.CloseOnExec(fds[1])
-			ms.mountFd = fds[1]
-			ms.fileSystem.Init(ms)
-			ms.recentUnique = make([]uint64, 0)
-			go ms.sendFd(path)
-			go ms.checkLostRequests()
-			return nil
-		}
-	}
-
-	fd, err := mount(ms.mountPoint, opt, ms.ready)
+	fd, comm, err := mount(ms.mountPoint, opt, ms.ready)
 	if err != nil {
 		return err
 	}
 	ms.mountFd = fd
+	ms.autoUnmountComm = comm
 
 	if code := ms.handleInit(); !code.Ok() {
 		syscall.Close(fd)
+		if comm != nil {
+			comm.Close()
+		}
+		if missing := ms.missingCapabilities(); missing != 0 {
+			unmount(ms.mountPoint, opt, false)
+			return fmt.Errorf("init: kernel does not offer required capabilities %v", missing)
+		}
 		// TODO - unmount as well?
 		return fmt.Errorf("init: %s", code)
 	}
+	return nil
+}
 
-	if path != "" {
-		go ms.sendFd(path)
+// adopt makes the server use the FUSE device fd of a mount that was
+// set up by another process (see Takeover).
+func (ms *Server) adopt(fd int, settings *InitIn, inflight []uint64) {
+	close(ms.ready)
+	ms.kernelSettings = *settings
+	if ms.kernelSettings.Minor >= 13 {
+		ms.setSplice()
 	}
-	return nil
+	syscall.CloseOnExec(fd)
+	ms.mountFd = fd
+	ms.fileSystem.Init(ms)
+	ms.recoverRequests(inflight)
+	ms.loops.Add(1)
 }
 
-func (ms *Server) sendFd(path string) {
-	buf := make([]byte, unsafe.Sizeof(InitIn{}))
-	*(*InitIn)(unsafe.Pointer(&buf[0])) = ms.kernelSettings
+// NewSocketServer creates a server for fs on fd, one end of a
+// SOCK_SEQPACKET socket pair, rather than on a mount. The process at
+// the other end plays the kernel: it must send INIT first, which
+// NewSocketServer answers, and closing its end makes Serve return.
+// This lets file systems be tested without privileges; see package
+// fuse/fusetest. As with NewServer, the caller must call Serve.
+func NewSocketServer(fs RawFileSystem, fd int, opts *MountOptions) (*Server, error) {
+	ms, err := newServer(fs, "/", opts)
+	if err != nil {
+		return nil, err
+	}
+	ms.mountPoint = ""
+	ms.socket = true
+	// Cloning and splicing need the FUSE device.
+	ms.cloneFailed = true
+	ms.mountFd = fd
+	close(ms.ready)
 
-	for {
-		err := sendFuseFd(path, buf, ms.mountFd)
-		if err == nil {
-			break
+	if code := ms.handleInit(); !code.Ok() {
+		return nil, fmt.Errorf("init: %s", code)
+	}
+	ms.loops.Add(1)
+	return ms, nil
+}
+
+// checkOptionCommas returns an error if an option contains ',', as
+// they can't be joined into a string for mounting.
+func checkOptionCommas(opts []string) error {
+	for _, s := range opts {
+		if strings.Contains(s, ",") {
+			return fmt.Errorf("found ',' in option string %q", s)
 		}
-		log.Println("send FUSE", err)
-		time.Sleep(time.Millisecond * 100)
 	}
+	return nil
 }
 
 func (o *MountOptions) optionsStrings() []string {
@@ -322,7 +505,16 @@ func (ms *Server) DebugData() string {
 	r = ms.reqReaders
 	ms.reqMu.Unlock()
 
-	return fmt.Sprintf("readers: %d", r)
+	s := fmt.Sprintf("readers: %d", r)
+	for i, st := range ms.ChannelStats() {
+		s += fmt.Sprintf("\nchannel %d (fd %d): %d readers, %d requests, %d bytes",
+			i, st.Fd, st.Readers, st.Requests, st.Bytes)
+	}
+	for _, st := range ms.SchedulerStats() {
+		s += fmt.Sprintf("\nqueue %v: %d queued, %d/%d running, %d served",
+			st.Class, st.Queued, st.Running, st.Limit, st.Served)
+	}
+	return s
 }
 
 // handleEINTR retries the given function until it doesn't return syscall.EINTR.
@@ -356,35 +548,56 @@ func (ms *Server) readRequest(exitIdle bool) (req *request, code Status) {
 	} else {
 		// main thread, don't exit for restart
 		for ms.shutdown {
+			if ms.handedOver {
+				ms.reqMu.Unlock()
+				return nil, ENODEV
+			}
 			ms.reqMu.Unlock()
 			time.Sleep(time.Millisecond)
 			ms.reqMu.Lock()
 		}
 	}
 	ms.reqReaders++
+	ch := ms.pickChannel()
+	ch.readers++
 	ms.reqMu.Unlock()
 
 	dest := ms.readPool.Get().([]byte)
 
 	var n int
+	var pipe *PipeData
 	err := handleEINTR(func() error {
 		var err error
-		n, err = syscall.Read(ms.mountFd, dest)
+		if ms.spliceRead {
+			n, pipe, err = ms.readSplice(ch.fd, dest)
+		} else {
+			n, err = syscall.Read(ch.fd, dest)
+		}
 		return err
 	})
+	if err == nil && n == 0 && ms.socket {
+		// The peer closed the socket.
+		err = syscall.ENODEV
+	}
 	if err != nil {
 		code = ToStatus(err)
 		ms.readPool.Put(dest)
 		ms.reqMu.Lock()
 		ms.reqReaders--
+		ch.readers--
 		ms.reqMu.Unlock()
 		return nil, code
 	}
+	atomic.AddUint64(&ch.requests, 1)
+	atomic.AddUint64(&ch.bytes, uint64(n))
+	if ms.recorder != nil {
+		ms.recorder.record(recordRequest, dest[:n])
+	}
 
 	req = ms.reqPool.Get().(*request)
-	if ms.latencies != nil {
-		req.startTime = time.Now()
-	}
+	req.channel = ch
+	req.pipeData = pipe
+	req.startTime = time.Now()
 	gobbled := req.setInput(dest[:n])
 	if !gobbled {
 		ms.readPool.Put(dest)
@@ -393,17 +606,15 @@ func (ms *Server) readRequest(exitIdle bool) (req *request, code Status) {
 	ms.reqMu.Lock()
 	defer ms.reqMu.Unlock()
 	ms.reqReaders--
+	ch.readers--
 	// Must parse request.Unique under lock
 	if status := req.parseHeader(); !status.Ok() {
 		return nil, status
 	}
-	if ms.recentUnique != nil {
-		ms.recentUnique = append(ms.recentUnique, req.inHeader.Unique)
-	}
-	req.inflightIndex = len(ms.reqInflight)
-	ms.reqInflight = append(ms.reqInflight, req)
+	ms.addInflight(req)
 
-	if !ms.singleReader && ms.reqReaders < 2 && ms.reqReaders < ms.maxReaders && !ms.shutdown {
+	if !ms.singleReader && ms.reqReaders < 2 && ms.reqReaders < ms.maxReaders && !ms.shutdown &&
+		(ms.scheduler == nil || !ms.scheduler.full()) {
 		ms.loops.Add(1)
 		go ms.loop(true)
 	}
@@ -411,44 +622,43 @@ func (ms *Server) readRequest(exitIdle bool) (req *request, code Status) {
 	return req, OK
 }
 
-func (ms *Server) checkLostRequests() {
-	go func() {
-		// issue a few requests to interrupt lost ones
-		for i := 0; i < 30; i++ {
-			ms.wakeupReader()
-			time.Sleep(time.Millisecond * 100)
-		}
-	}()
-	var recentUnique []uint64
-	time.Sleep(time.Second * 3)
-	for {
-		if len(ms.recentUnique) > 10 {
-			ms.reqMu.Lock()
-			recentUnique = ms.recentUnique
-			ms.recentUnique = nil
-			ms.reqMu.Unlock()
-			break
+// recoverRequests makes sure that requests which the previous
+// process read but did not answer do not hang forever. If the kernel
+// supports NOTIFY_RESEND, it queues all of them again, so they are
+// served by this process. Otherwise, the given requests are failed
+// with EINTR.
+func (ms *Server) recoverRequests(inflight []uint64) {
+	if ms.kernelSettings.SupportsNotify(NOTIFY_RESEND) {
+		code := ms.notifyResend()
+		if code.Ok() {
+			return
 		}
-		time.Sleep(time.Second)
+		log.Printf("NOTIFY_RESEND: %v", code)
+	}
+	for _, unique := range inflight {
+		ms.returnInterrupted(unique)
 	}
+}
 
-	sort.Slice(recentUnique, func(i, j int) bool { return recentUnique[i] < recentUnique[j] })
-	var last = recentUnique[0]
-	for _, u := range recentUnique[:len(recentUnique)/2] {
-		for u > last+1 {
-			last++
-			// interrupt lost one
-			ms.returnInterrupted(last)
-		}
+// notifyResend asks the kernel to queue all requests that were read
+// from the device but not answered again.
+func (ms *Server) notifyResend() Status {
+	req := request{
+		inHeader: &InHeader{
+			Opcode: _OP_NOTIFY_RESEND,
+		},
+		handler: operationHandlers[_OP_NOTIFY_RESEND],
+		status:  NOTIFY_RESEND,
 	}
-	// interrupt historic ones
-	last = recentUnique[0] - 1
-	var c int
-	for last > 0 && c < 3e6 {
-		ms.returnInterrupted(last)
-		last--
-		c++
+
+	ms.writeMu.RLock()
+	result := ms.write(&req)
+	ms.writeMu.RUnlock()
+
+	if ms.opts.Debug {
+		log.Printf("Response: NOTIFY_RESEND: %v", result)
 	}
+	return result
 }
 
 func (ms *Server) returnInterrupted(unique uint64) {
@@ -457,12 +667,26 @@ func (ms *Server) returnInterrupted(unique uint64) {
 	o.Unique = unique
 	o.Status = -int32(syscall.EINTR)
 	o.Length = uint32(sizeOfOutHeader)
-	err := handleEINTR(func() error {
-		_, err := syscall.Write(ms.mountFd, header)
-		return err
-	})
-	if err == nil {
-		log.Printf("FUSE: interrupt request %d", unique)
+
+	// The reply must go to the channel that read the request;
+	// the kernel does not know it on the others.
+	fds := []int{ms.mountFd}
+	ms.reqMu.Lock()
+	for _, ch := range ms.channels {
+		if ch.fd != ms.mountFd {
+			fds = append(fds, ch.fd)
+		}
+	}
+	ms.reqMu.Unlock()
+	for _, fd := range fds {
+		err := handleEINTR(func() error {
+			_, err := syscall.Write(fd, header)
+			return err
+		})
+		if err == nil {
+			log.Printf("FUSE: interrupt request %d", unique)
+			return
+		}
 	}
 }
 
@@ -478,9 +702,14 @@ func (ms *Server) returnRequest(req *request) {
 	}
 	ms.reqInflight = ms.reqInflight[:last]
 	interrupted := req.interrupted
+	ms.recordCompleted(req.inHeader.Unique)
 	ms.reqMu.Unlock()
 
 	ms.recordStats(req)
+	if req.pipeData != nil {
+		req.pipeData.release()
+		req.pipeData = nil
+	}
 	if interrupted {
 		// Don't reposses data, because someone might still
 		// be looking at it
@@ -509,11 +738,28 @@ func (ms *Server) returnRequest(req *request) {
 }
 
 func (ms *Server) recordStats(req *request) {
+	if ms.latencies == nil && ms.metrics == nil && ms.opts.Tracer == nil {
+		return
+	}
+	dt := time.Now().Sub(req.startTime)
+	if t := ms.opts.Tracer; t != nil {
+		info := req.info()
+		info.OutSize = req.replySize
+		t.OnRequestEnd(info, req.status, dt)
+	}
+	opname := operationName(req.inHeader.Opcode)
 	if ms.latencies != nil {
-		dt := time.Now().Sub(req.startTime)
-		opname := operationName(req.inHeader.Opcode)
 		ms.latencies.Add(opname, dt)
 	}
+	if ms.metrics != nil {
+		ms.metrics.RecordRequest(&RequestMetrics{
+			Op:       opname,
+			Latency:  dt,
+			Status:   req.status,
+			InBytes:  int(req.inHeader.Length),
+			OutBytes: req.replySize,
+		})
+	}
 }
 
 // Serve initiates the FUSE loop. Normally, callers should run Serve()
@@ -522,9 +768,39 @@ func (ms *Server) recordStats(req *request) {
 //
 // Each filesystem operation executes in a separate goroutine.
 func (ms *Server) Serve() {
+	if ms.NegotiatedCapabilities()&CAP_OVER_IO_URING != 0 {
+		if err := ms.startURing(); err != nil {
+			log.Printf("io_uring transport: %v; using the FUSE device", err)
+		}
+	}
+	if ms.opts.StuckRequestThreshold > 0 {
+		stop := make(chan struct{})
+		go ms.watchStuck(stop)
+		defer close(stop)
+	}
+	if ms.scheduler != nil {
+		ms.scheduler.start()
+	}
+	if ms.opts.SelfAccess != SelfAccessIgnore {
+		ms.startSelfAccess()
+	}
 	ms.loop(false)
 	ms.loops.Wait()
 
+	ms.reqMu.Lock()
+	uring := ms.uring
+	ms.uring = nil
+	ms.reqMu.Unlock()
+	if uring != nil {
+		uring.stop()
+	}
+	if ms.scheduler != nil {
+		ms.scheduler.stop()
+	}
+	if ms.opts.SelfAccess != SelfAccessIgnore {
+		ms.stopSelfAccess()
+	}
+
 	// shutdown in-flight cache retrieves.
 	//
 	// It is possible that umount comes in the middle - after retrieve
@@ -542,11 +818,14 @@ func (ms *Server) Serve() {
 		close(reading.ready)
 	}
 
-	_ = closeFuseFd()
-
+	ms.closeChannels()
 	ms.writeMu.Lock()
 	syscall.Close(ms.mountFd)
 	ms.writeMu.Unlock()
+	if ms.autoUnmountComm != nil {
+		// Tell fusermount to unmount, if nobody did.
+		ms.autoUnmountComm.Close()
+	}
 }
 
 // Wait waits for the serve loop to exit. This should only be called
@@ -555,13 +834,38 @@ func (ms *Server) Wait() {
 	ms.loops.Wait()
 }
 
+// wakeupReader issues a request on the mount, so readers that are
+// blocked in read(2) return.
 func (ms *Server) wakeupReader() {
-	cmd := exec.Command("df", ms.mountPoint)
-	_ = cmd.Run()
+	var st syscall.Statfs_t
+	_ = syscall.Statfs(ms.getMountPoint(), &st)
 }
 
+// Shutdown stops reading new requests from the kernel and waits for
+// the requests in flight to finish. Requests that the kernel still
+// considers unanswered are interrupted. It returns false if the
+// session stays busy, in which case the server resumes serving.
 func (ms *Server) Shutdown() bool {
 	log.Printf("try to restart gracefully")
+	inflight, ok := ms.quiesce()
+	if !ok {
+		return false
+	}
+	if len(inflight) > 0 {
+		log.Printf("there are %d requests in flight, interrupt them", len(inflight))
+	}
+	for _, unique := range inflight {
+		ms.returnInterrupted(unique)
+	}
+	return true
+}
+
+// quiesce stops reading requests and waits until all readers, request
+// handlers and writes have finished. On success, the server stays
+// stopped, and the unique IDs of requests that were read but not
+// answered are returned. If the session stays busy, the server
+// resumes serving and ok is false.
+func (ms *Server) quiesce() (inflight []uint64, ok bool) {
 	start := time.Now()
 	ms.reqMu.Lock()
 	ms.shutdown = true
@@ -578,15 +882,19 @@ func (ms *Server) Shutdown() bool {
 			// double check
 			if n := atomic.LoadInt64(&ms.writes); n > 0 {
 				log.Printf("restore process for %d writes", n)
-				ms.reqMu.Lock()
-				ms.shutdown = false
-				ms.reqMu.Unlock()
+				ms.resume()
 				time.Sleep(time.Millisecond * 100)
 				ms.reqMu.Lock()
 				ms.shutdown = true
 				ms.reqMu.Unlock()
 			}
 		}
+		if time.Since(start) > time.Second*4 && readers == 0 && atomic.LoadInt64(&ms.writes) == 0 {
+			// Nothing is read anymore, and the requests
+			// in flight ignored the interrupt below; stop
+			// waiting for them.
+			break
+		}
 		if time.Since(start) > time.Second*3 {
 			ms.reqMu.Lock()
 			log.Printf("interrupt %d inflight requests", len(ms.reqInflight))
@@ -601,10 +909,8 @@ func (ms *Server) Shutdown() bool {
 		if time.Since(start) > time.Second*10 {
 			log.Printf("FUSE session is still busy (%d readers, %d requests, %d writers) after 10 seconds, give up",
 				readers, reqs, atomic.LoadInt64(&ms.writes))
-			ms.reqMu.Lock()
-			ms.shutdown = false
-			ms.reqMu.Unlock()
-			return false
+			ms.resume()
+			return nil, false
 		}
 		time.Sleep(time.Millisecond * 10)
 		ms.reqMu.Lock()
@@ -613,16 +919,32 @@ func (ms *Server) Shutdown() bool {
 		ms.reqMu.Unlock()
 	}
 
-	// double check
+	// The requests still in flight are stuck in the file system.
 	ms.reqMu.Lock()
-	if len(ms.reqInflight) > 0 {
-		log.Printf("there are %d requests in flight, interrupt them", len(ms.reqInflight))
-		for _, req := range ms.reqInflight {
-			ms.returnInterrupted(req.inHeader.Unique)
+	for _, req := range ms.reqInflight {
+		if !req.timedOut {
+			inflight = append(inflight, req.inHeader.Unique)
 		}
 	}
 	ms.reqMu.Unlock()
-	return true
+	return inflight, true
+}
+
+// resume undoes quiesce.
+func (ms *Server) resume() {
+	ms.reqMu.Lock()
+	ms.shutdown = false
+	ms.reqMu.Unlock()
+}
+
+// handOver makes the serve loop exit after the FUSE device was passed
+// to another process. The mount stays in place, so Unmount becomes a
+// no-op.
+func (ms *Server) handOver() {
+	ms.reqMu.Lock()
+	ms.handedOver = true
+	ms.mountPoint = ""
+	ms.reqMu.Unlock()
 }
 
 func (ms *Server) handleInit() Status {
@@ -639,6 +961,9 @@ func (ms *Server) handleInit() Status {
 	if code := ms.handleRequest(req); !code.Ok() {
 		return code
 	}
+	if ms.missingCapabilities() != 0 {
+		return ENOTSUP
+	}
 
 	// INIT is handled. Init the file system, but don't accept
 	// incoming requests, so the file system can setup itself.
@@ -669,7 +994,15 @@ exit:
 			break exit
 		}
 
-		if ms.singleReader {
+		if ms.serveSelfAccess(req, nil) || ms.schedule(req, nil) {
+			continue
+		}
+		// With poll enabled, the main reader never serves
+		// requests itself: a poll(2) on the mount blocks on a
+		// synchronous FUSE_POLL, and if all readers were busy
+		// serving requests that wait for that poll, nobody would
+		// pick it up. Keep one reader waiting in read(2).
+		if ms.singleReader || (ms.opts.EnablePoll && !exitIdle) {
 			go ms.handleRequest(req)
 		} else {
 			ms.handleRequest(req)
@@ -687,22 +1020,32 @@ func (ms *Server) handleRequest(req *request) Status {
 	if req.handler == nil {
 		req.status = ENOSYS
 	}
+	atomic.StoreUint32(&req.parsed, 1)
+	if ms.opts.StuckRequestThreshold > 0 {
+		atomic.StoreInt64(&req.goroutine, goroutineID())
+	}
 
 	if req.status.Ok() && ms.opts.Debug {
 		log.Println(req.InputDebug())
 	}
-
-	if req.inHeader.NodeId == pollHackInode ||
-		req.inHeader.NodeId == FUSE_ROOT_ID && len(req.filenames) > 0 && req.filenames[0] == pollHackName {
-		doPollHackLookup(ms, req)
-	} else if req.status.Ok() && req.handler.Func == nil {
-		log.Printf("Unimplemented opcode %v", operationName(req.inHeader.Opcode))
-		req.status = ENOSYS
-	} else if req.status.Ok() {
-		req.handler.Func(ms, req)
+	if t := ms.opts.Tracer; t != nil {
+		t.OnRequestStart(req.info())
 	}
 
-	errNo := ms.write(req)
+	setProfileLabel(req.inHeader.Opcode)
+	ms.startTimeout(req)
+	ms.dispatch(req)
+
+	var errNo Status
+	if ms.stopTimeout(req) {
+		errNo = ms.write(req)
+	} else {
+		if ms.opts.Debug {
+			log.Printf("Discarding late reply to timed out request %d", req.inHeader.Unique)
+		}
+		ms.discardReply(req)
+	}
+	clearProfileLabel()
 	if errNo != 0 {
 		// Unless debugging is enabled, ignore ENOENT for INTERRUPT responses
 		// which indicates that the referred request is no longer known by the
@@ -718,6 +1061,21 @@ func (ms *Server) handleRequest(req *request) Status {
 	return Status(errNo)
 }
 
+// dispatch runs the operation of a parsed request.
+func (ms *Server) dispatch(req *request) {
+	if !ms.opts.EnablePoll && (req.inHeader.NodeId == pollHackInode ||
+		req.inHeader.NodeId == FUSE_ROOT_ID && len(req.filenames) > 0 && req.filenames[0] == pollHackName) {
+		doPollHackLookup(ms, req)
+	} else if ms.failSelfAccess(req) {
+		return
+	} else if req.status.Ok() && req.handler.Func == nil {
+		log.Printf("Unimplemented opcode %v", operationName(req.inHeader.Opcode))
+		req.status = ENOSYS
+	} else if req.status.Ok() {
+		req.handler.Func(ms, req)
+	}
+}
+
 // alignSlice ensures that the byte at alignedByte is aligned with the
 // given logical block size.  The input slice should be at least (size
 // + blockSize)
@@ -753,6 +1111,10 @@ func (ms *Server) write(req *request) Status {
 		}
 	}
 
+	if ms.recorder != nil {
+		// Record the data as it is sent.
+		ms.fillData(req)
+	}
 	header := req.serializeHeader(req.flatDataSize())
 	if ms.opts.Debug {
 		log.Println(req.OutputDebug())
@@ -761,15 +1123,37 @@ func (ms *Server) write(req *request) Status {
 	if header == nil {
 		return OK
 	}
+	if ms.recorder != nil {
+		ms.recorder.recordReply(header, req)
+	}
 
 	atomic.AddInt64(&ms.writes, 1)
 	defer func() {
 		atomic.AddInt64(&ms.writes, -1)
 	}()
 	s := ms.systemWrite(req, header)
+	if s.Ok() {
+		// systemWrite serializes the header again if the
+		// data turns out shorter.
+		req.replySize = int((*OutHeader)(unsafe.Pointer(&req.outBuf[0])).Length)
+	}
 	return s
 }
 
+// fillData reads data that a READ returned as ReadResultFd or
+// ReadResultFunc into a buffer.
+func (ms *Server) fillData(req *request) {
+	if req.fdData == nil && req.funcData == nil {
+		return
+	}
+	buf := ms.allocOut(req, uint32(req.flatDataSize()))
+	var st int
+	req.flatData, st = req.readResult.Bytes(buf)
+	req.status = Status(st)
+	req.fdData = nil
+	req.funcData = nil
+}
+
 func (ms *Server) isShutdown() bool {
 	ms.reqMu.Lock()
 	defer ms.reqMu.Unlock()
@@ -1004,6 +1388,40 @@ type retrieveCacheRequest struct {
 	ready chan struct{}
 }
 
+// PollNotify wakes up processes waiting in poll(2), select(2) or
+// epoll_wait(2) on the poll handle kh. The handle is passed to
+// RawFileSystem.Poll in PollIn.Kh, if the kernel asked to be
+// notified.
+func (ms *Server) PollNotify(kh uint64) Status {
+	if !ms.kernelSettings.SupportsNotify(NOTIFY_POLL) {
+		return ENOSYS
+	}
+	if ms.isShutdown() {
+		return EINTR
+	}
+
+	req := request{
+		inHeader: &InHeader{
+			Opcode: _OP_NOTIFY_POLL,
+		},
+		handler: operationHandlers[_OP_NOTIFY_POLL],
+		status:  NOTIFY_POLL,
+	}
+
+	out := (*NotifyPollWakeupOut)(req.outData())
+	out.Kh = kh
+
+	// Protect against concurrent close.
+	ms.writeMu.RLock()
+	result := ms.write(&req)
+	ms.writeMu.RUnlock()
+
+	if ms.opts.Debug {
+		log.Printf("Response: POLL_NOTIFY: %v", result)
+	}
+	return result
+}
+
 // DeleteNotify notifies the kernel that an entry is removed from a
 // directory.  In many cases, this is equivalent to EntryNotify,
 // except when the directory is in use, eg. as working directory of
@@ -1097,6 +1515,8 @@ func (in *InitIn) SupportsVersion(maj, min uint32) bool {
 // supported. Pass any of the NOTIFY_* types as argument.
 func (in *InitIn) SupportsNotify(notifyType int) bool {
 	switch notifyType {
+	case NOTIFY_POLL:
+		return in.SupportsVersion(7, 11)
 	case NOTIFY_INVAL_ENTRY:
 		return in.SupportsVersion(7, 12)
 	case NOTIFY_INVAL_INODE:
@@ -1105,6 +1525,8 @@ func (in *InitIn) SupportsNotify(notifyType int) bool {
 		return in.SupportsVersion(7, 15)
 	case NOTIFY_DELETE:
 		return in.SupportsVersion(7, 18)
+	case NOTIFY_RESEND:
+		return in.InitFlags()&CAP_HAS_RESEND != 0
 	}
 	return false
 }
@@ -1114,8 +1536,18 @@ func (in *InitIn) SupportsNotify(notifyType int) bool {
 // mountpoint, and the OS trying to setup the user-space mount.
 func (ms *Server) WaitMount() error {
 	err := <-ms.ready
-	if err != nil {
+	if mnt := ms.detachedMount; mnt != nil {
+		// A detached mount (see NewDetachedServer) has no path
+		// yet, but can be reached through its file.
+		ms.detachedMount = nil
+		defer mnt.Close()
+		if err == nil && !ms.opts.EnablePoll {
+			err = pollHack(fmt.Sprintf("/proc/self/fd/%d", mnt.Fd()))
+		}
+		return err
+	}
+	if err != nil || ms.opts.EnablePoll || ms.socket {
 		return err
 	}
-	return pollHack(ms.mountPoint)
+	return pollHack(ms.getMountPoint())
 }
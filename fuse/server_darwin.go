@@ -17,12 +17,8 @@ func (ms *Server) systemWrite(req *request, header []byte) Status {
 		return ToStatus(err)
 	}
 
-	if req.fdData != nil {
-		sz := req.flatDataSize()
-		buf := ms.allocOut(req, uint32(sz))
-		var st int
-		req.flatData, st = req.fdData.Bytes(buf)
-		req.status = Status(st)
+	if req.fdData != nil || req.funcData != nil {
+		ms.fillData(req)
 		header = req.serializeHeader(len(req.flatData))
 	}
 
@@ -38,3 +34,15 @@ func (ms *Server) systemWrite(req *request, header []byte) Status {
 	}
 	return ToStatus(err)
 }
+
+func (ms *Server) RegisterBackingFd(fd int) (int32, error) {
+	return 0, syscall.ENOSYS
+}
+
+func (ms *Server) CloseBackingFd(id int32) error {
+	return syscall.ENOSYS
+}
+
+func (ms *Server) cloneFd() (int, error) {
+	return -1, syscall.ENOSYS
+}
@@ -7,44 +7,115 @@ package fuse
 import (
 	"log"
 	"syscall"
+	"unsafe"
 )
 
 func (ms *Server) systemWrite(req *request, header []byte) Status {
+	if req.uringEntry != nil {
+		return ms.uringWrite(req, header)
+	}
+	fd := ms.mountFd
+	if req.channel != nil {
+		fd = req.channel.fd
+	}
 	if req.flatDataSize() == 0 {
 		err := handleEINTR(func() error {
-			_, err := syscall.Write(ms.mountFd, header)
+			_, err := syscall.Write(fd, header)
 			return err
 		})
 		return ToStatus(err)
 	}
 
-	if req.fdData != nil {
-		if ms.canSplice {
-			err := ms.trySplice(header, req, req.fdData)
-			if err == nil {
-				req.readResult.Done()
-				return OK
-			}
-			log.Println("trySplice:", err)
+	if req.fdData != nil && ms.canSplice {
+		err := ms.trySplice(fd, header, req, req.fdData)
+		if err == nil {
+			req.readResult.Done()
+			return OK
 		}
-
-		sz := req.flatDataSize()
-		buf := ms.allocOut(req, uint32(sz))
-		var st int
-		req.flatData, st = req.fdData.Bytes(buf)
-		req.status = Status(st)
+		log.Println("trySplice:", err)
+	}
+	if req.fdData != nil || req.funcData != nil {
+		ms.fillData(req)
 		header = req.serializeHeader(len(req.flatData))
 	}
 
+	if _, ok := req.readResult.(*readResultPages); ok && req.slices != nil && ms.canSplice {
+		err := ms.tryVmsplice(fd, header, req.slices)
+		if err == nil {
+			req.readResult.Done()
+			return OK
+		}
+		log.Println("tryVmsplice:", err)
+	}
+
 	bufs := [][]byte{header}
 	if req.slices != nil {
 		bufs = append(bufs, req.slices...)
 	} else {
 		bufs = append(bufs, req.flatData)
 	}
-	_, err := writev(ms.mountFd, bufs)
+	_, err := writev(fd, bufs)
 	if req.readResult != nil {
 		req.readResult.Done()
 	}
 	return ToStatus(err)
 }
+
+// backingMap is struct fuse_backing_map, the argument of
+// FUSE_DEV_IOC_BACKING_OPEN.
+type backingMap struct {
+	Fd      int32
+	Flags   uint32
+	Padding uint64
+}
+
+const (
+	_DEV_IOC_CLONE         = 0x8004e500 // _IOR(229, 0, uint32_t)
+	_DEV_IOC_BACKING_OPEN  = 0x4010e501 // _IOW(229, 1, struct fuse_backing_map)
+	_DEV_IOC_BACKING_CLOSE = 0x4004e502 // _IOW(229, 2, uint32_t)
+)
+
+// cloneFd opens a new fd for the FUSE connection of the mount.
+func (ms *Server) cloneFd() (int, error) {
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	session := uint32(ms.mountFd)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		_DEV_IOC_CLONE, uintptr(unsafe.Pointer(&session)))
+	if errno != 0 {
+		syscall.Close(fd)
+		return -1, errno
+	}
+	return fd, nil
+}
+
+// RegisterBackingFd hands fd to the kernel for passthrough I/O, and
+// returns an ID for it. Passing the ID in OpenOut.BackingId together
+// with FOPEN_PASSTHROUGH makes the kernel read and write fd directly.
+// The kernel keeps its own reference to the file, so fd may be closed
+// afterwards. This requires MountOptions.EnablePassthrough.
+func (ms *Server) RegisterBackingFd(fd int) (int32, error) {
+	if ms.NegotiatedCapabilities()&CAP_PASSTHROUGH == 0 {
+		return 0, syscall.ENOTSUP
+	}
+	m := backingMap{Fd: int32(fd)}
+	id, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(ms.mountFd),
+		_DEV_IOC_BACKING_OPEN, uintptr(unsafe.Pointer(&m)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int32(id), nil
+}
+
+// CloseBackingFd releases an ID returned by RegisterBackingFd. Files
+// that were opened with it continue to work.
+func (ms *Server) CloseBackingFd(id int32) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(ms.mountFd),
+		_DEV_IOC_BACKING_CLOSE, uintptr(unsafe.Pointer(&id)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -6,12 +6,17 @@ package fuse
 
 import (
 	"fmt"
+	"syscall"
 )
 
 func (s *Server) setSplice() {
 	s.canSplice = false
 }
 
-func (ms *Server) trySplice(header []byte, req *request, fdData *readResultFd) error {
+func (ms *Server) readSplice(fd int, dest []byte) (int, *PipeData, error) {
+	return 0, nil, syscall.ENOSYS
+}
+
+func (ms *Server) trySplice(fd int, header []byte, req *request, fdData *readResultFd) error {
 	return fmt.Errorf("unimplemented")
 }
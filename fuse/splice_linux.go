@@ -6,13 +6,85 @@ package fuse
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"syscall"
+	"unsafe"
 
 	"github.com/hanwen/go-fuse/v2/splice"
 )
 
 func (s *Server) setSplice() {
-	s.canSplice = splice.Resizable()
+	// Spliced data cannot be recorded, and sockets do not keep
+	// message boundaries for spliced data.
+	s.canSplice = splice.Resizable() && s.opts.RecordTraffic == nil && !s.socket
+	s.spliceRead = s.canSplice && s.opts.EnableSpliceRead &&
+		s.kernelSettings.InitFlags()&CAP_SPLICE_READ != 0
+}
+
+// readSplice reads a request from fd through a pipe. If it is a WRITE
+// with at least a page of data, only the headers are copied to dest,
+// and the data is returned in the pipe. Otherwise, the whole request
+// is copied to dest.
+func (ms *Server) readSplice(fd int, dest []byte) (int, *PipeData, error) {
+	pair, err := splice.Get()
+	if err == nil {
+		// The whole request must fit in the pipe.
+		if err = pair.Grow(len(dest) + os.Getpagesize()); err != nil {
+			splice.Done(pair)
+		}
+	}
+	if err != nil {
+		log.Printf("splice read: %v", err)
+		n, err := syscall.Read(fd, dest)
+		return n, nil, err
+	}
+
+	n, err := syscall.Splice(fd, nil, int(pair.WriteFd()), nil, len(dest), 0)
+	if err != nil {
+		splice.Done(pair)
+		return 0, nil, err
+	}
+
+	// WriteIn starts with the InHeader.
+	headerSize := int(unsafe.Sizeof(WriteIn{}))
+	total := int(n)
+	if total < headerSize+os.Getpagesize() {
+		headerSize = total
+	}
+	if err := readPipe(pair, dest[:headerSize]); err != nil {
+		splice.Done(pair)
+		return 0, nil, err
+	}
+	if headerSize == total {
+		splice.Done(pair)
+		return total, nil, nil
+	}
+	if (*InHeader)(unsafe.Pointer(&dest[0])).Opcode != _OP_WRITE {
+		err := readPipe(pair, dest[headerSize:total])
+		splice.Done(pair)
+		return total, nil, err
+	}
+	return headerSize, &PipeData{
+		fd:   int(pair.ReadFd()),
+		size: total - headerSize,
+		done: func() { splice.Done(pair) },
+	}, nil
+}
+
+// readPipe fills buf from the pipe.
+func readPipe(pair *splice.Pair, buf []byte) error {
+	for len(buf) > 0 {
+		n, err := pair.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return syscall.EIO
+		}
+		buf = buf[n:]
+	}
+	return nil
 }
 
 // trySplice:  Zero-copy read from fdData.Fd into /dev/fuse
@@ -28,7 +100,7 @@ func (s *Server) setSplice() {
 //
 // This dance is neccessary because header and payload cannot be split across
 // two splices and we cannot seek in a pipe buffer.
-func (ms *Server) trySplice(header []byte, req *request, fdData *readResultFd) error {
+func (ms *Server) trySplice(fd int, header []byte, req *request, fdData *readResultFd) error {
 	var err error
 
 	// Get a pair of connected pipes
@@ -88,10 +160,71 @@ func (ms *Server) trySplice(header []byte, req *request, fdData *readResultFd) e
 	}
 
 	// Write header + data to /dev/fuse
-	_, err = pair2.WriteTo(uintptr(ms.mountFd), total)
+	_, err = pair2.WriteTo(uintptr(fd), total)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// tryVmsplice writes header and data to /dev/fuse through a pipe. The
+// header is copied into the pipe, and the pages of data are mapped
+// into it with vmsplice(2), so the kernel copies the data only once,
+// when splicing the pipe into fd.
+func (ms *Server) tryVmsplice(fd int, header []byte, data [][]byte) error {
+	pair, err := splice.Get()
+	if err != nil {
+		return err
+	}
+	defer splice.Done(pair)
+
+	total := len(header)
+	iovs := make([]syscall.Iovec, 0, len(data))
+	for _, d := range data {
+		if len(d) == 0 {
+			continue
+		}
+		iov := syscall.Iovec{Base: &d[0]}
+		iov.SetLen(len(d))
+		iovs = append(iovs, iov)
+		total += len(d)
+	}
+
+	// Without the extra page the kernel will block once the pipe
+	// is almost full.
+	if err := pair.Grow(total + os.Getpagesize()); err != nil {
+		return err
+	}
+	n, err := pair.Write(header)
+	if err != nil {
+		return err
+	}
+	if n != len(header) {
+		return fmt.Errorf("Short write into splice: wrote %d, want %d", n, len(header))
+	}
+
+	for len(iovs) > 0 {
+		n, _, errno := syscall.Syscall6(syscall.SYS_VMSPLICE, pair.WriteFd(),
+			uintptr(unsafe.Pointer(&iovs[0])), uintptr(len(iovs)), 0, 0, 0)
+		if errno != 0 {
+			return os.NewSyscallError("vmsplice", errno)
+		}
+		if n == 0 {
+			return fmt.Errorf("Short vmsplice: %d iovecs left", len(iovs))
+		}
+		for n > 0 {
+			if l := uintptr(iovs[0].Len); n < l {
+				iovs[0].Base = (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(iovs[0].Base)) + n))
+				iovs[0].SetLen(int(l - n))
+				break
+			} else {
+				n -= l
+				iovs = iovs[1:]
+			}
+		}
+	}
+
+	_, err = pair.WriteTo(uintptr(fd), total)
+	return err
+}
@@ -0,0 +1,34 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// IsStaleMount tells if mountPoint is a FUSE mount whose server is
+// gone, eg. because it crashed. Accessing such a mount fails with
+// ENOTCONN ("Transport endpoint is not connected"), or ECONNABORTED
+// if the connection was aborted.
+func IsStaleMount(mountPoint string) bool {
+	var st syscall.Stat_t
+	err := syscall.Stat(mountPoint, &st)
+	return err == syscall.ENOTCONN || err == syscall.ECONNABORTED
+}
+
+// CleanStaleMount unmounts mountPoint if it is a stale FUSE mount (see
+// IsStaleMount), so it can be mounted again. It returns whether it
+// unmounted anything. Call it before mounting, if the previous server
+// for mountPoint may have died without unmounting.
+func CleanStaleMount(mountPoint string) (bool, error) {
+	if !IsStaleMount(mountPoint) {
+		return false, nil
+	}
+	if err := unmountStale(mountPoint); err != nil {
+		return false, fmt.Errorf("unmount stale %s: %w", mountPoint, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,552 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Live upgrade
+//
+// A running server can pass its FUSE connection to a new process,
+// so the file system can be upgraded without unmounting it. The old
+// process calls ListenForTakeover and then TakeoverListener.Accept,
+// and the new process calls Takeover with the same socket path:
+//
+//  1. The new process connects and sends a hello message.
+//  2. The old process checks the credentials of the peer, stops
+//     reading requests and waits for the requests in flight.
+//  3. The old process sends the FUSE device, the kernel settings, the
+//     mount point, the requests it could not answer, and the state of
+//     the file system if it implements TakeoverStater.
+//  4. The new process acknowledges. The old process confirms, and its
+//     Serve call returns, leaving the mount in place.
+//  5. The new process starts serving once it has the confirmation.
+//
+// The two processes never serve at the same time, as they would
+// answer requests from different file system state. If the takeover
+// fails before the confirmation is sent, the old process resumes
+// serving. If the new process goes away after that, neither serves,
+// and the mount hangs until it is unmounted.
+//
+// This replaces the handover through the socket named in the
+// _FUSE_FD_COMM environment variable, which is no longer supported:
+// it did not check the peer, and both processes could end up serving.
+
+var (
+	// ErrTakeoverPeer means the other process is not allowed to
+	// take over the mount, or hand it over.
+	ErrTakeoverPeer = errors.New("takeover peer not permitted")
+
+	// ErrTakeoverVersion means the two processes speak
+	// different versions of the takeover protocol.
+	ErrTakeoverVersion = errors.New("takeover protocol version mismatch")
+
+	// ErrTakeoverBusy means the serving process did not become
+	// idle in time and continues serving.
+	ErrTakeoverBusy = errors.New("takeover: server busy")
+
+	// ErrTakeoverProtocol means a malformed message was received.
+	ErrTakeoverProtocol = errors.New("takeover protocol error")
+)
+
+// TakeoverStater is implemented by file systems that keep state
+// about the node IDs and file handles the kernel holds, such as the
+// one from fs.NewNodeFS. The state is passed to the file system of
+// the process that takes over the mount.
+type TakeoverStater interface {
+	// SaveTakeoverState is called on the old process's file
+	// system, while no requests are processed.
+	SaveTakeoverState() ([]byte, error)
+
+	// RestoreTakeoverState is called on the new process's file
+	// system, before Init.
+	RestoreTakeoverState(state []byte) error
+}
+
+// TakeoverError records an error from a takeover, and the step and
+// socket path that caused it.
+type TakeoverError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *TakeoverError) Error() string {
+	return "takeover " + e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *TakeoverError) Unwrap() error { return e.Err }
+
+const (
+	takeoverMagic = 0x75666f67 // "gofu"
+
+	// takeoverVersion is 2 since the header has StateLen.
+	takeoverVersion = 2
+
+	// maxTakeoverPath bounds the mount point in the handoff.
+	maxTakeoverPath = 4096
+
+	// maxHandoverRequests is the maximum number of unanswered
+	// requests that can be passed to the next process.
+	maxHandoverRequests = 1024
+
+	// takeoverChunkSize is the size of the messages that carry
+	// the file system state after the handoff.
+	takeoverChunkSize = 64 * 1024
+
+	// maxTakeoverState bounds the file system state in the
+	// handoff.
+	maxTakeoverState = 1 << 30
+)
+
+// takeoverHeader starts every takeover message. The handoff message
+// is followed by SettingsLen bytes of InitIn, Count request IDs and
+// PathLen bytes of mount point. StateLen bytes of file system state
+// follow in separate messages of at most takeoverChunkSize.
+type takeoverHeader struct {
+	Magic       uint32
+	Version     uint32
+	Status      int32
+	SettingsLen uint32
+	Count       uint32
+	PathLen     uint32
+	StateLen    uint64
+}
+
+const takeoverHeaderSize = int(unsafe.Sizeof(takeoverHeader{}))
+
+var maxTakeoverSize = takeoverHeaderSize + int(unsafe.Sizeof(InitIn{})) + 8*maxHandoverRequests + maxTakeoverPath
+
+func (h *takeoverHeader) bytes() []byte {
+	buf := make([]byte, takeoverHeaderSize)
+	copy(buf, (*[unsafe.Sizeof(takeoverHeader{})]byte)(unsafe.Pointer(h))[:])
+	return buf
+}
+
+// encodeTakeoverStatus returns a message without payload, as used for
+// the hello, the acknowledgement, the confirmation and refusals.
+func encodeTakeoverStatus(status syscall.Errno) []byte {
+	h := takeoverHeader{
+		Magic:   takeoverMagic,
+		Version: takeoverVersion,
+		Status:  int32(status),
+	}
+	return h.bytes()
+}
+
+// parseTakeoverHeader checks and decodes the start of msg.
+func parseTakeoverHeader(msg []byte) (h takeoverHeader, err error) {
+	// Check magic and version first: the header of other
+	// versions may have a different size.
+	if len(msg) < 8 {
+		return h, fmt.Errorf("%w: short message (%d bytes)", ErrTakeoverProtocol, len(msg))
+	}
+	copy((*[unsafe.Sizeof(takeoverHeader{})]byte)(unsafe.Pointer(&h))[:], msg)
+	if h.Magic != takeoverMagic {
+		return h, fmt.Errorf("%w: bad magic %x", ErrTakeoverProtocol, h.Magic)
+	}
+	if h.Version != takeoverVersion {
+		return h, fmt.Errorf("%w: got %d, want %d", ErrTakeoverVersion, h.Version, takeoverVersion)
+	}
+	if len(msg) < takeoverHeaderSize {
+		return h, fmt.Errorf("%w: short message (%d bytes)", ErrTakeoverProtocol, len(msg))
+	}
+	return h, nil
+}
+
+func encodeHandoff(settings *InitIn, inflight []uint64, mountPoint string, stateLen int) []byte {
+	settingsLen := int(unsafe.Sizeof(*settings))
+	h := takeoverHeader{
+		Magic:       takeoverMagic,
+		Version:     takeoverVersion,
+		SettingsLen: uint32(settingsLen),
+		Count:       uint32(len(inflight)),
+		PathLen:     uint32(len(mountPoint)),
+		StateLen:    uint64(stateLen),
+	}
+	buf := make([]byte, 0, takeoverHeaderSize+settingsLen+8*len(inflight)+len(mountPoint))
+	buf = append(buf, h.bytes()...)
+	buf = append(buf, (*[unsafe.Sizeof(InitIn{})]byte)(unsafe.Pointer(settings))[:]...)
+	var n [8]byte
+	for _, unique := range inflight {
+		binary.LittleEndian.PutUint64(n[:], unique)
+		buf = append(buf, n[:]...)
+	}
+	return append(buf, mountPoint...)
+}
+
+type handoff struct {
+	settings   InitIn
+	inflight   []uint64
+	mountPoint string
+	stateLen   uint64
+}
+
+func parseHandoff(msg []byte) (*handoff, error) {
+	h, err := parseTakeoverHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	if h.Status != 0 {
+		return nil, takeoverStatusError(syscall.Errno(h.Status))
+	}
+	rest := msg[takeoverHeaderSize:]
+	if uint64(h.SettingsLen)+8*uint64(h.Count)+uint64(h.PathLen) != uint64(len(rest)) ||
+		h.PathLen == 0 {
+		return nil, fmt.Errorf("%w: bad handoff size %d", ErrTakeoverProtocol, len(msg))
+	}
+	ho := &handoff{stateLen: h.StateLen}
+
+	// A peer with a different InitIn layout may send more or
+	// fewer bytes; the struct only ever grows at the end.
+	copy((*[unsafe.Sizeof(InitIn{})]byte)(unsafe.Pointer(&ho.settings))[:], rest[:h.SettingsLen])
+	rest = rest[h.SettingsLen:]
+	for i := 0; i < int(h.Count); i++ {
+		ho.inflight = append(ho.inflight, binary.LittleEndian.Uint64(rest))
+		rest = rest[8:]
+	}
+	ho.mountPoint = string(rest)
+	return ho, nil
+}
+
+func takeoverStatusError(status syscall.Errno) error {
+	switch status {
+	case syscall.EBUSY:
+		return ErrTakeoverBusy
+	case syscall.EPERM:
+		return ErrTakeoverPeer
+	case syscall.EPROTONOSUPPORT:
+		return ErrTakeoverVersion
+	}
+	return status
+}
+
+// watchContext makes I/O on c fail once ctx is done. The returned
+// function must be called when the I/O is over.
+func watchContext(ctx context.Context, c interface{ SetDeadline(time.Time) error }) (stop func()) {
+	if d, ok := ctx.Deadline(); ok {
+		c.SetDeadline(d)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		c.SetDeadline(time.Time{})
+	}
+}
+
+// contextErr prefers the context's error over the I/O error it caused.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// The I/O deadline may expire before the context's timer
+	// fires.
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// TakeoverListener waits for another process to take over the mount
+// of a Server.
+type TakeoverListener struct {
+	path     string
+	server   *Server
+	listener *net.UnixListener
+}
+
+// ListenForTakeover creates a Unix socket at path, over which another
+// process can take over the mount of server by calling Takeover. A
+// stale socket at path is removed. Servers mounted with AutoUnmount
+// cannot be taken over.
+func ListenForTakeover(path string, server *Server) (*TakeoverListener, error) {
+	if server.autoUnmountComm != nil {
+		// fusermount would unmount once this process stops
+		// serving.
+		return nil, &TakeoverError{Op: "listen", Path: path, Err: syscall.ENOTSUP}
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return nil, &TakeoverError{Op: "listen", Path: path, Err: err}
+	}
+	return &TakeoverListener{
+		path:     path,
+		server:   server,
+		listener: l,
+	}, nil
+}
+
+// Close removes the socket. It does not affect a takeover that
+// already started.
+func (l *TakeoverListener) Close() error {
+	return l.listener.Close()
+}
+
+// Accept waits for one takeover attempt and serves it. It returns nil
+// if the other process took over the mount; the Server's Serve call
+// then returns without unmounting, and the process can exit.
+//
+// If the attempt fails, the server continues serving, and Accept can
+// be called again. The errors are of type *TakeoverError, or the
+// context's error if ctx was done first. Once the FUSE device was
+// sent, cancelling ctx no longer aborts the takeover. Servers that
+// use the IOUring transport cannot be taken over.
+func (l *TakeoverListener) Accept(ctx context.Context) error {
+	stop := watchContext(ctx, l.listener)
+	conn, err := l.listener.AcceptUnix()
+	stop()
+	if err != nil {
+		return l.fail("accept", contextErr(ctx, err))
+	}
+	defer conn.Close()
+
+	if err := checkPeer(conn); err != nil {
+		conn.Write(encodeTakeoverStatus(syscall.EPERM))
+		return l.fail("peer", err)
+	}
+
+	stop = watchContext(ctx, conn)
+	msg, err := readTakeoverMessage(conn, takeoverHeaderSize)
+	stop()
+	if err != nil {
+		return l.fail("hello", contextErr(ctx, err))
+	}
+	if _, err := parseTakeoverHeader(msg); err != nil {
+		if errors.Is(err, ErrTakeoverVersion) {
+			conn.Write(encodeTakeoverStatus(syscall.EPROTONOSUPPORT))
+		}
+		return l.fail("hello", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return l.fail("hello", err)
+	}
+
+	ms := l.server
+	ms.reqMu.Lock()
+	uring := ms.uring != nil
+	ms.reqMu.Unlock()
+	if uring {
+		// The io_uring queues cannot be passed on.
+		conn.Write(encodeTakeoverStatus(syscall.ENOTSUP))
+		return l.fail("transport", syscall.ENOTSUP)
+	}
+
+	inflight, ok := ms.quiesce()
+	if !ok {
+		conn.Write(encodeTakeoverStatus(syscall.EBUSY))
+		return l.fail("quiesce", ErrTakeoverBusy)
+	}
+	if len(inflight) > maxHandoverRequests {
+		log.Printf("there are %d requests in flight, interrupt them", len(inflight))
+		for _, unique := range inflight {
+			ms.returnInterrupted(unique)
+		}
+		inflight = nil
+	}
+
+	var state []byte
+	if ts, ok := ms.fileSystem.(TakeoverStater); ok {
+		state, err = ts.SaveTakeoverState()
+		if err == nil && len(state) > maxTakeoverState {
+			err = fmt.Errorf("state has %d bytes, more than %d", len(state), maxTakeoverState)
+		}
+		if err != nil {
+			ms.resume()
+			return l.fail("state", err)
+		}
+	}
+
+	msg = encodeHandoff(ms.KernelSettings(), inflight, ms.getMountPoint(), len(state))
+	if err := putFd(conn, msg, ms.mountFd); err != nil {
+		ms.resume()
+		return l.fail("send", err)
+	}
+	for len(state) > 0 {
+		chunk := state
+		if len(chunk) > takeoverChunkSize {
+			chunk = chunk[:takeoverChunkSize]
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			ms.resume()
+			return l.fail("send", err)
+		}
+		state = state[len(chunk):]
+	}
+
+	// The other process does not serve before it has our
+	// confirmation, so we can resume until it is sent.
+	msg, err = readTakeoverMessage(conn, takeoverHeaderSize)
+	if err == nil {
+		var h takeoverHeader
+		h, err = parseTakeoverHeader(msg)
+		if err == nil && h.Status != 0 {
+			err = takeoverStatusError(syscall.Errno(h.Status))
+		}
+	}
+	if err != nil {
+		ms.resume()
+		return l.fail("ack", err)
+	}
+	if _, err := conn.Write(encodeTakeoverStatus(0)); err != nil {
+		// A failed write on a SOCK_SEQPACKET socket delivers
+		// nothing, so the other process will not serve.
+		ms.resume()
+		return l.fail("confirm", err)
+	}
+
+	ms.handOver()
+	return nil
+}
+
+func (l *TakeoverListener) fail(op string, err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	return &TakeoverError{Op: op, Path: l.path, Err: err}
+}
+
+func readTakeoverMessage(conn *net.UnixConn, maxSize int) ([]byte, error) {
+	buf := make([]byte, maxSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: connection closed", ErrTakeoverProtocol)
+	}
+	return buf[:n], nil
+}
+
+func readTakeoverState(conn *net.UnixConn, size uint64) ([]byte, error) {
+	if size > maxTakeoverState {
+		return nil, fmt.Errorf("%w: state of %d bytes exceeds %d", ErrTakeoverProtocol, size, maxTakeoverState)
+	}
+	// Grow as the chunks arrive, rather than trusting size.
+	var state []byte
+	for uint64(len(state)) < size {
+		chunk, err := readTakeoverMessage(conn, takeoverChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(state)+len(chunk)) > size {
+			return nil, fmt.Errorf("%w: state exceeds %d bytes", ErrTakeoverProtocol, size)
+		}
+		state = append(state, chunk...)
+	}
+	return state, nil
+}
+
+// Takeover connects to the socket that the serving process set up
+// with ListenForTakeover, and takes over its mount. The returned
+// Server serves fs on the same mount point; as with NewServer, the
+// caller must call Serve. The mount point in opts is ignored.
+//
+// Requests that the old process could not answer are resent by the
+// kernel if it supports NOTIFY_RESEND, and interrupted otherwise.
+// Errors are of type *TakeoverError, or the context's error if ctx
+// was done first.
+func Takeover(ctx context.Context, path string, fs RawFileSystem, opts *MountOptions) (*Server, error) {
+	fail := func(op string, err error) (*Server, error) {
+		err = contextErr(ctx, err)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil, err
+		}
+		return nil, &TakeoverError{Op: op, Path: path, Err: err}
+	}
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "unixpacket", path)
+	if err != nil {
+		return fail("dial", err)
+	}
+	conn := c.(*net.UnixConn)
+	defer conn.Close()
+
+	if err := checkPeer(conn); err != nil {
+		return fail("peer", err)
+	}
+
+	stop := watchContext(ctx, conn)
+	if _, err := conn.Write(encodeTakeoverStatus(0)); err != nil {
+		stop()
+		return fail("hello", err)
+	}
+	msg, fd, err := getFd(conn, maxTakeoverSize)
+	if err != nil {
+		stop()
+		return fail("receive", err)
+	}
+	ho, err := parseHandoff(msg)
+	if err == nil && fd < 0 {
+		err = fmt.Errorf("%w: no file descriptor", ErrTakeoverProtocol)
+	}
+	var state []byte
+	if err == nil {
+		state, err = readTakeoverState(conn, ho.stateLen)
+	}
+	stop()
+	if err != nil {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+		return fail("receive", err)
+	}
+
+	if ts, ok := fs.(TakeoverStater); ok && len(state) > 0 {
+		err = ts.RestoreTakeoverState(state)
+	} else if len(state) > 0 {
+		log.Printf("takeover: %T cannot restore file system state, dropping it", fs)
+	}
+	var ms *Server
+	if err == nil {
+		ms, err = newServer(fs, ho.mountPoint, opts)
+	}
+	if err != nil {
+		syscall.Close(fd)
+		return fail("init", err)
+	}
+
+	// Don't serve before the old process confirmed that it
+	// stopped.
+	stop = watchContext(ctx, conn)
+	_, err = conn.Write(encodeTakeoverStatus(0))
+	if err == nil {
+		msg, err = readTakeoverMessage(conn, takeoverHeaderSize)
+	}
+	if err == nil {
+		var h takeoverHeader
+		h, err = parseTakeoverHeader(msg)
+		if err == nil && h.Status != 0 {
+			err = takeoverStatusError(syscall.Errno(h.Status))
+		}
+	}
+	stop()
+	if err != nil {
+		syscall.Close(fd)
+		return fail("confirm", err)
+	}
+	ms.adopt(fd, &ho.settings, ho.inflight)
+	return ms, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// fuseSuperMagic is the f_type that statfs(2) reports for FUSE mounts.
+const fuseSuperMagic = 0x65735546
+
+func TestInitFlags2(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	opts := &fuse.MountOptions{
+		Capabilities: fuse.Capabilities{
+			Optional: fuse.CAP_HAS_EXPIRE_ONLY | fuse.CAP_HAS_INODE_DAX,
+		},
+		Debug: testutil.VerboseTest(),
+	}
+	srv, err := fuse.NewServer(fuse.NewDefaultRawFileSystem(), dir, opts)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	settings := srv.KernelSettings()
+	if settings.Minor < 38 {
+		t.Skipf("kernel protocol 7.%d does not offer CAP_HAS_EXPIRE_ONLY", settings.Minor)
+	}
+	flags := srv.NegotiatedCapabilities()
+	if !flags.Has(fuse.CAP_HAS_EXPIRE_ONLY) {
+		t.Errorf("got flags %v, want HAS_EXPIRE_ONLY", flags)
+	}
+	if flags.Has(fuse.CAP_SECURITY_CTX) {
+		t.Errorf("got flags %v, SECURITY_CTX was not requested", flags)
+	}
+	// DAX is only offered for virtiofs.
+	if flags.Has(fuse.CAP_HAS_INODE_DAX) {
+		t.Errorf("got flags %v, HAS_INODE_DAX was not offered", flags)
+	}
+}
+
+func TestRequiredCapabilities(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	opts := &fuse.MountOptions{
+		Capabilities: fuse.Capabilities{
+			// DAX is only offered for virtiofs.
+			Required: fuse.CAP_ASYNC_READ | fuse.CAP_HAS_INODE_DAX,
+		},
+		Debug: testutil.VerboseTest(),
+	}
+	srv, err := fuse.NewServer(fuse.NewDefaultRawFileSystem(), dir, opts)
+	if err == nil {
+		srv.Unmount()
+		t.Fatal("NewServer succeeded without HAS_INODE_DAX")
+	}
+	if !strings.Contains(err.Error(), "HAS_INODE_DAX") {
+		t.Errorf("error %q does not mention the missing capability", err)
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		t.Fatalf("Statfs: %v", err)
+	}
+	if st.Type == fuseSuperMagic {
+		t.Errorf("%s is still mounted", dir)
+	}
+}
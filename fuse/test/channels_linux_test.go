@@ -0,0 +1,87 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/nodefs"
+	"github.com/hanwen/go-fuse/v2/fuse/pathfs"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// slowAttrFS takes a while for each GetAttr, so several readers are
+// busy at the same time.
+type slowAttrFS struct {
+	pathfs.FileSystem
+}
+
+func (fs *slowAttrFS) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if name == "" {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755}, fuse.OK
+	}
+	time.Sleep(20 * time.Millisecond)
+	return &fuse.Attr{Mode: fuse.S_IFREG | 0644}, fuse.OK
+}
+
+func TestClonedChannels(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	nfs := pathfs.NewPathNodeFs(&slowAttrFS{pathfs.NewDefaultFileSystem()}, nil)
+	conn := nodefs.NewFileSystemConnector(nfs.Root(), nodefs.NewOptions())
+	srv, err := fuse.NewServer(conn.RawFS(), dir, &fuse.MountOptions{
+		MaxReaders: 4,
+		Debug:      testutil.VerboseTest(),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	const n = 16
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			_, err := os.Lstat(fmt.Sprintf("%s/f%d", dir, i))
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Errorf("Lstat: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			// A reply written to the wrong channel is
+			// never seen by the kernel.
+			t.Fatal("timed out waiting for Lstat")
+		}
+	}
+
+	stats := srv.ChannelStats()
+	if len(stats) < 2 {
+		t.Fatalf("got %d channels, want several: %v", len(stats), stats)
+	}
+	if len(stats) > 4 {
+		t.Errorf("got %d channels, more than MaxReaders", len(stats))
+	}
+	var total uint64
+	for _, st := range stats {
+		total += st.Requests
+	}
+	if total < n {
+		t.Errorf("got %d requests over all channels, want at least %d", total, n)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// mountSource returns the source of the mount at dir, from
+// /proc/self/mountinfo.
+func mountSource(t *testing.T, dir string) string {
+	info, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range strings.Split(string(info), "\n") {
+		// ID parent major:minor root mountpoint opts ... - type source superopts
+		f := strings.Fields(l)
+		if len(f) < 5 || f[4] != dir {
+			continue
+		}
+		for i, s := range f {
+			if s == "-" && i+2 < len(f) {
+				return f[i+2]
+			}
+		}
+	}
+	return ""
+}
+
+func TestDirectMountComma(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to mount")
+	}
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	rawFS, orig := loopbackRawFS(t, "hello")
+	defer os.RemoveAll(orig)
+
+	srv, err := fuse.NewServer(rawFS, mnt, &fuse.MountOptions{
+		DirectMount: true,
+		FsName:      "a,b",
+		Debug:       testutil.VerboseTest(),
+	})
+	if errors.Is(err, syscall.ENOSYS) {
+		t.Skip("no fsopen(2)")
+	} else if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	if got := mountSource(t, mnt); got != "a,b" {
+		t.Errorf("got source %q, want %q", got, "a,b")
+	}
+	if _, err := os.Stat(mnt + "/file"); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+
+	// Without DirectMount, fusermount gets the options joined.
+	if _, err := fuse.NewServer(rawFS, mnt, &fuse.MountOptions{
+		FsName: "a,b",
+	}); err == nil {
+		t.Errorf("',' in FsName accepted for fusermount")
+	}
+}
+
+func TestDetachedServer(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to mount")
+	}
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	rawFS, orig := loopbackRawFS(t, "hello")
+	defer os.RemoveAll(orig)
+
+	srv, mntFile, err := fuse.NewDetachedServer(rawFS, &fuse.MountOptions{
+		Debug: testutil.VerboseTest(),
+	})
+	if errors.Is(err, syscall.ENOSYS) {
+		t.Skip("no fsopen(2)")
+	} else if err != nil {
+		t.Fatalf("NewDetachedServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+
+	if _, err := os.Stat(mnt + "/file"); !os.IsNotExist(err) {
+		t.Errorf("mount is attached before MoveMount: %v", err)
+	}
+	err = fuse.MoveMount(mntFile, mnt)
+	mntFile.Close()
+	if err != nil {
+		t.Fatalf("MoveMount: %v", err)
+	}
+	if content, err := ioutil.ReadFile(mnt + "/file"); err != nil || string(content) != "hello" {
+		t.Errorf("ReadFile: %q, %v", content, err)
+	}
+
+	if err := syscall.Unmount(mnt, 0); err != nil {
+		t.Fatalf("Unmount: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Serve did not return after unmount")
+	}
+}
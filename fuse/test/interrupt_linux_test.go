@@ -0,0 +1,117 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/fusetest"
+)
+
+// interruptFS blocks LOOKUP of "slow" until it is interrupted.
+type interruptFS struct {
+	fuse.RawFileSystem
+
+	started chan struct{}
+}
+
+func (fs *interruptFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	if name != "slow" {
+		return fuse.ENOENT
+	}
+	fs.started <- struct{}{}
+	select {
+	case <-cancel:
+		return fuse.EINTR
+	case <-time.After(5 * time.Second):
+		return fuse.OK
+	}
+}
+
+func newInterruptKernel(t *testing.T) (*fusetest.Kernel, *interruptFS) {
+	fs := &interruptFS{
+		RawFileSystem: fuse.NewDefaultRawFileSystem(),
+		started:       make(chan struct{}, 10),
+	}
+	k, err := fusetest.New(fs, &fuse.MountOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, fs
+}
+
+func TestInterruptInflight(t *testing.T) {
+	k, fs := newInterruptKernel(t)
+	defer k.Close()
+
+	unique := k.NextUnique()
+	done := make(chan error, 1)
+	go func() {
+		_, err := k.Lookup(fuse.FUSE_ROOT_ID, "slow")
+		done <- err
+	}()
+	<-fs.started
+	if err := k.Interrupt(unique, 50*time.Millisecond); err != nil {
+		t.Errorf("Interrupt: got reply %v", err)
+	}
+	if err := <-done; err != syscall.EINTR {
+		t.Errorf("Lookup: got %v, want EINTR", err)
+	}
+}
+
+// TestInterruptBeforeRequest sends the INTERRUPT before the request
+// it targets, as happens when another reader picks it up first.
+func TestInterruptBeforeRequest(t *testing.T) {
+	k, fs := newInterruptKernel(t)
+	defer k.Close()
+
+	// The INTERRUPT takes the next unique ID.
+	unique := k.NextUnique() + 2
+	if err := k.Interrupt(unique, 0); err != nil {
+		t.Fatalf("Interrupt: %v", err)
+	}
+	start := time.Now()
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "slow"); err != syscall.EINTR {
+		t.Errorf("Lookup: got %v, want EINTR", err)
+	}
+	<-fs.started
+	if dt := time.Since(start); dt > time.Second {
+		t.Errorf("Lookup took %v", dt)
+	}
+}
+
+// TestInterruptUnknown checks that an INTERRUPT for a request that
+// never comes is answered with EAGAIN, so the kernel can send it
+// again.
+func TestInterruptUnknown(t *testing.T) {
+	k, _ := newInterruptKernel(t)
+	defer k.Close()
+
+	start := time.Now()
+	if err := k.Interrupt(k.NextUnique()+1000, 5*time.Second); err != syscall.EAGAIN {
+		t.Errorf("Interrupt: got %v, want EAGAIN", err)
+	}
+	if dt := time.Since(start); dt < 5*time.Millisecond {
+		t.Errorf("EAGAIN after %v; the server should wait for the request", dt)
+	}
+}
+
+// TestInterruptCompleted checks that an INTERRUPT that lost the race
+// against the reply is dropped without a reply.
+func TestInterruptCompleted(t *testing.T) {
+	k, _ := newInterruptKernel(t)
+	defer k.Close()
+
+	unique := k.NextUnique()
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "fast"); err != syscall.ENOENT {
+		t.Fatalf("Lookup: got %v, want ENOENT", err)
+	}
+	if err := k.Interrupt(unique, 100*time.Millisecond); err != nil {
+		t.Errorf("Interrupt: got reply %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/metrics"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	rawFS, orig := loopbackRawFS(t, "hello")
+	defer os.RemoveAll(orig)
+
+	srv, err := fuse.NewServer(rawFS, mnt, &fuse.MountOptions{
+		Debug: testutil.VerboseTest(),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	m := metrics.New(nil)
+	m.Attach(srv)
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	if _, err := ioutil.ReadFile(mnt + "/file"); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if _, err := os.Stat(mnt + "/missing"); !os.IsNotExist(err) {
+		t.Fatalf("Stat: got %v, want ENOENT", err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	got := rec.Body.String()
+	for _, want := range []string{
+		`fuse_request_duration_seconds_count{op="LOOKUP"}`,
+		`fuse_request_errors_total{op="LOOKUP",errno="2"} `,
+		`fuse_reply_bytes_total{op="READ"} `,
+		"fuse_requests_inflight ",
+		"fuse_readers ",
+		`fuse_channel_requests_total{channel="0"}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in output:\n%s", want, got)
+		}
+	}
+}
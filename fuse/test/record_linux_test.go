@@ -0,0 +1,137 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// fileFS has one file, with fixed attributes.
+type fileFS struct {
+	fuse.RawFileSystem
+
+	content string
+}
+
+func (fs *fileFS) attr(node uint64, out *fuse.Attr) fuse.Status {
+	switch node {
+	case fuse.FUSE_ROOT_ID:
+		out.Mode = syscall.S_IFDIR | 0755
+	case 2:
+		out.Mode = syscall.S_IFREG | 0644
+		out.Size = uint64(len(fs.content))
+	default:
+		return fuse.ENOENT
+	}
+	out.Ino = node
+	out.Nlink = 1
+	return fuse.OK
+}
+
+func (fs *fileFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	if header.NodeId != fuse.FUSE_ROOT_ID || name != "file" {
+		return fuse.ENOENT
+	}
+	out.NodeId = 2
+	return fs.attr(2, &out.Attr)
+}
+
+func (fs *fileFS) GetAttr(cancel <-chan struct{}, input *fuse.GetAttrIn, out *fuse.AttrOut) fuse.Status {
+	return fs.attr(input.NodeId, &out.Attr)
+}
+
+func (fs *fileFS) Open(cancel <-chan struct{}, input *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	return fuse.OK
+}
+
+func (fs *fileFS) Read(cancel <-chan struct{}, input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
+	c := fs.content
+	if int(input.Offset) >= len(c) {
+		return fuse.ReadResultData(nil), fuse.OK
+	}
+	return fuse.ReadResultData([]byte(c[input.Offset:])), fuse.OK
+}
+
+func TestRecordReplay(t *testing.T) {
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+
+	var buf bytes.Buffer
+	opts := &fuse.MountOptions{
+		Debug:         testutil.VerboseTest(),
+		RecordTraffic: &buf,
+	}
+	srv, err := fuse.NewServer(&fileFS{fuse.NewDefaultRawFileSystem(), "hello"}, mnt, opts)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	content, err := ioutil.ReadFile(mnt + "/file")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("got %q, want %q", content, "hello")
+	}
+	if err := srv.Unmount(); err != nil {
+		t.Fatalf("Unmount: %v", err)
+	}
+	// Stop recording.
+	srv.Wait()
+
+	recs, err := fuse.ReadRecording(&buf)
+	if err != nil {
+		t.Fatalf("ReadRecording: %v", err)
+	}
+
+	var dump bytes.Buffer
+	if err := fuse.DumpRecording(&dump, recs); err != nil {
+		t.Fatalf("DumpRecording: %v", err)
+	}
+	for _, want := range []string{"INIT n0", `LOOKUP n1 ["file"]`, "READ n2", `5b data "hello"`} {
+		if !strings.Contains(dump.String(), want) {
+			t.Errorf("dump does not contain %q:\n%s", want, dump.String())
+		}
+	}
+
+	// The same file system gives the same replies.
+	diffs, err := fuse.Replay(recs, &fileFS{fuse.NewDefaultRawFileSystem(), "hello"}, opts)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	for _, d := range diffs {
+		t.Errorf("unexpected diff: %v", &d)
+	}
+
+	// Different content shows up in GETATTR/LOOKUP (the size)
+	// and READ.
+	diffs, err = fuse.Replay(recs, &fileFS{fuse.NewDefaultRawFileSystem(), "HELLO!"}, opts)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	var read bool
+	for _, d := range diffs {
+		if d.Op == "READ" {
+			read = true
+			if !strings.Contains(d.String(), `"HELLO!"`) {
+				t.Errorf("diff does not show the replayed data: %v", &d)
+			}
+		}
+	}
+	if !read {
+		t.Errorf("no READ in diffs %v", diffs)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/fusetest"
+)
+
+// schedFS blocks READ until it gets a value from release, or release
+// is closed.
+type schedFS struct {
+	fuse.RawFileSystem
+
+	started chan struct{}
+	release chan struct{}
+
+	mu      sync.Mutex
+	reads   int
+	maxRead int
+}
+
+func (fs *schedFS) Read(cancel <-chan struct{}, input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
+	fs.mu.Lock()
+	fs.reads++
+	if fs.reads > fs.maxRead {
+		fs.maxRead = fs.reads
+	}
+	fs.mu.Unlock()
+
+	fs.started <- struct{}{}
+	select {
+	case <-fs.release:
+	case <-cancel:
+	}
+
+	fs.mu.Lock()
+	fs.reads--
+	fs.mu.Unlock()
+	return fuse.ReadResultData(nil), fuse.OK
+}
+
+func (fs *schedFS) GetAttr(cancel <-chan struct{}, input *fuse.GetAttrIn, out *fuse.AttrOut) fuse.Status {
+	out.Mode = fuse.S_IFDIR | 0755
+	return fuse.OK
+}
+
+func (fs *schedFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	return fuse.ENOENT
+}
+
+func newSchedKernel(t *testing.T, opts *fuse.SchedulerOptions) (*fusetest.Kernel, *schedFS) {
+	fs := &schedFS{
+		RawFileSystem: fuse.NewDefaultRawFileSystem(),
+		started:       make(chan struct{}, 100),
+		release:       make(chan struct{}),
+	}
+	k, err := fusetest.New(fs, &fuse.MountOptions{Scheduler: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, fs
+}
+
+// startReads issues n READs in the background. The returned channel
+// gets their errors.
+func startReads(k *fusetest.Kernel, n int) chan error {
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := k.Read(fuse.FUSE_ROOT_ID, 0, 0, 10)
+			errs <- err
+		}()
+	}
+	return errs
+}
+
+// waitQueued waits until n requests of class c are queued.
+func waitQueued(t *testing.T, srv *fuse.Server, c fuse.OpClass, n int) {
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		if st := srv.SchedulerStats()[c]; st.Queued >= n {
+			return
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("got %v, want %d queued %v requests", srv.SchedulerStats(), n, c)
+		}
+	}
+}
+
+func TestSchedulerLimit(t *testing.T) {
+	k, fs := newSchedKernel(t, &fuse.SchedulerOptions{
+		Workers: 8,
+		Limits:  map[fuse.OpClass]int{fuse.OpClassData: 2},
+	})
+	defer k.Close()
+
+	errs := startReads(k, 5)
+	<-fs.started
+	<-fs.started
+	waitQueued(t, k.Server, fuse.OpClassData, 3)
+
+	// Metadata operations still get served.
+	if _, err := k.GetAttr(fuse.FUSE_ROOT_ID); err != nil {
+		t.Errorf("GetAttr: %v", err)
+	}
+	st := k.Server.SchedulerStats()[fuse.OpClassData]
+	if st.Running != 2 || st.Limit != 2 {
+		t.Errorf("got %+v, want 2 running READs", st)
+	}
+
+	close(fs.release)
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	}
+	if fs.maxRead != 2 {
+		t.Errorf("got %d concurrent READs, want 2", fs.maxRead)
+	}
+	if st := k.Server.SchedulerStats()[fuse.OpClassData]; st.Served != 5 || st.Queued != 0 {
+		t.Errorf("got %+v, want 5 served", st)
+	}
+}
+
+// TestSchedulerMaxQueued checks that the server stops reading
+// requests when the queue of a class is full.
+func TestSchedulerMaxQueued(t *testing.T) {
+	k, fs := newSchedKernel(t, &fuse.SchedulerOptions{
+		Workers:   2,
+		Limits:    map[fuse.OpClass]int{fuse.OpClassData: 1},
+		MaxQueued: 2,
+	})
+	defer k.Close()
+
+	const n = 10
+	errs := startReads(k, n)
+	<-fs.started
+	waitQueued(t, k.Server, fuse.OpClassData, 2)
+
+	// Give the readers time to pick up more requests.
+	time.Sleep(50 * time.Millisecond)
+	if st := k.Server.SchedulerStats()[fuse.OpClassData]; st.Queued != 2 || st.Running != 1 {
+		t.Errorf("got %+v, want 1 running and 2 queued READs", st)
+	}
+	if got := len(k.Server.InflightRequests()); got >= n {
+		t.Errorf("got %d requests in flight, want fewer than %d", got, n)
+	}
+
+	close(fs.release)
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	}
+}
+
+// TestSchedulerInterrupt checks that an INTERRUPT gets through while
+// all workers are busy.
+func TestSchedulerInterrupt(t *testing.T) {
+	k, fs := newSchedKernel(t, &fuse.SchedulerOptions{
+		Workers: 2,
+		Limits:  map[fuse.OpClass]int{fuse.OpClassData: 1},
+	})
+	defer k.Close()
+
+	unique := k.NextUnique()
+	errs := startReads(k, 1)
+	<-fs.started
+	if err := k.Interrupt(unique, 0); err != nil {
+		t.Fatalf("Interrupt: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("READ was not interrupted")
+	}
+	close(fs.release)
+}
+
+// TestSchedulerFIFO queues a LOOKUP behind a READ, while the only
+// worker for non-notify classes is busy, and checks that the READ is
+// served first.
+func TestSchedulerFIFO(t *testing.T) {
+	k, fs := newSchedKernel(t, &fuse.SchedulerOptions{
+		Workers: 2,
+	})
+	defer k.Close()
+
+	errs := startReads(k, 2)
+	<-fs.started
+	waitQueued(t, k.Server, fuse.OpClassData, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := k.Lookup(fuse.FUSE_ROOT_ID, "file")
+		done <- err
+	}()
+	waitQueued(t, k.Server, fuse.OpClassMetadata, 1)
+
+	// Finish the first READ; the worker must take the second one.
+	fs.release <- struct{}{}
+	<-fs.started
+	select {
+	case err := <-done:
+		t.Errorf("LOOKUP served before READ: %v", err)
+	default:
+	}
+	close(fs.release)
+	if err := <-done; err != syscall.ENOENT {
+		t.Errorf("Lookup: got %v, want ENOENT", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	}
+}
+
+// TestSchedulerPriority queues a READ and then a LOOKUP, and checks
+// that the LOOKUP is still served first, even if the READ came
+// earlier.
+func TestSchedulerPriority(t *testing.T) {
+	k, fs := newSchedKernel(t, &fuse.SchedulerOptions{
+		Workers:  2,
+		Priority: true,
+	})
+	defer k.Close()
+
+	errs := startReads(k, 2)
+	<-fs.started
+	waitQueued(t, k.Server, fuse.OpClassData, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := k.Lookup(fuse.FUSE_ROOT_ID, "file")
+		done <- err
+	}()
+	waitQueued(t, k.Server, fuse.OpClassMetadata, 1)
+
+	// Finish the first READ; the worker must take the LOOKUP.
+	fs.release <- struct{}{}
+	select {
+	case err := <-done:
+		if err != syscall.ENOENT {
+			t.Errorf("Lookup: got %v, want ENOENT", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LOOKUP was not served")
+	}
+	close(fs.release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/fusetest"
+)
+
+// notSelf is a process ID that is not ours. It is above the kernel's
+// limit for PIDs.
+const notSelf = 1 << 30
+
+// TestSelfAccessServe checks that requests from the serving process
+// get served while all scheduler workers are busy.
+func TestSelfAccessServe(t *testing.T) {
+	fs := &schedFS{
+		RawFileSystem: fuse.NewDefaultRawFileSystem(),
+		started:       make(chan struct{}, 10),
+		release:       make(chan struct{}),
+	}
+	k, err := fusetest.New(fs, &fuse.MountOptions{
+		Scheduler:  &fuse.SchedulerOptions{Workers: 2},
+		SelfAccess: fuse.SelfAccessServe,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	self := k.Caller
+	k.Caller.Pid = notSelf
+	errs := startReads(k, 1)
+	<-fs.started
+
+	// The READ holds the only worker for metadata requests.
+	k.Caller = self
+	if _, err := k.GetAttr(fuse.FUSE_ROOT_ID); err != nil {
+		t.Errorf("GetAttr: %v", err)
+	}
+	if st := k.Server.SchedulerStats()[fuse.OpClassMetadata]; st.Served != 0 {
+		t.Errorf("got %+v, want GETATTR to bypass the scheduler", st)
+	}
+
+	close(fs.release)
+	if err := <-errs; err != nil {
+		t.Errorf("Read: %v", err)
+	}
+}
+
+func TestSelfAccessFail(t *testing.T) {
+	k, err := fusetest.New(fuse.NewDefaultRawFileSystem(), &fuse.MountOptions{
+		SelfAccess: fuse.SelfAccessFail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	// fusetest sends our PID as the caller.
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "file"); err != syscall.EDEADLK {
+		t.Errorf("Lookup: got %v, want EDEADLK", err)
+	}
+
+	// The kernel reports thread IDs, not process IDs.
+	tid := make(chan int)
+	go func() {
+		tid <- syscall.Gettid()
+	}()
+	k.Caller.Pid = uint32(<-tid)
+	if _, err := k.GetAttr(fuse.FUSE_ROOT_ID); err != syscall.EDEADLK {
+		t.Errorf("GetAttr: got %v, want EDEADLK", err)
+	}
+
+	// FLUSH is served.
+	if err := k.Flush(fuse.FUSE_ROOT_ID, 0); err != nil {
+		t.Errorf("Flush: %v", err)
+	}
+
+	k.Caller.Pid = notSelf
+	if _, err := k.Lookup(fuse.FUSE_ROOT_ID, "file"); err != syscall.ENOSYS {
+		t.Errorf("Lookup: got %v, want ENOSYS", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+// stuckFS hangs in LOOKUP until release is closed, even if the
+// request is interrupted.
+type stuckFS struct {
+	fuse.RawFileSystem
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (fs *stuckFS) Lookup(cancel <-chan struct{}, header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	if name != "stuck" {
+		return fuse.ENOENT
+	}
+	fs.started <- struct{}{}
+	<-fs.release
+	return fuse.ENOENT
+}
+
+// TestShutdownStuckRequest checks that Shutdown fails a request that
+// the file system does not answer, rather than waiting for it.
+func TestShutdownStuckRequest(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to unmount after the server stopped")
+	}
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	fs := &stuckFS{
+		RawFileSystem: fuse.NewDefaultRawFileSystem(),
+		started:       make(chan struct{}, 1),
+		release:       make(chan struct{}),
+	}
+	srv, err := fuse.NewServer(fs, dir, &fuse.MountOptions{
+		Debug: testutil.VerboseTest(),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	// Once shut down, the server does not answer the unmount.
+	defer syscall.Unmount(dir, syscall.MNT_DETACH)
+	defer close(fs.release)
+
+	errs := make(chan error, 1)
+	go func() {
+		// os.Lstat would retry on EINTR.
+		var st syscall.Stat_t
+		errs <- syscall.Lstat(dir+"/stuck", &st)
+	}()
+	<-fs.started
+
+	if !srv.Shutdown() {
+		t.Fatal("Shutdown gave up")
+	}
+	select {
+	case err := <-errs:
+		if err != syscall.EINTR {
+			t.Errorf("got %v, want EINTR", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LOOKUP was not answered")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/fuse/nodefs"
+	"github.com/hanwen/go-fuse/v2/fuse/pathfs"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+func loopbackRawFS(t *testing.T, content string) (fuse.RawFileSystem, string) {
+	dir := testutil.TempDir()
+	if err := ioutil.WriteFile(dir+"/file", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nfs := pathfs.NewPathNodeFs(pathfs.NewLoopbackFileSystem(dir), nil)
+	conn := nodefs.NewFileSystemConnector(nfs.Root(), nodefs.NewOptions())
+	return conn.RawFS(), dir
+}
+
+func TestTakeover(t *testing.T) {
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	oldFS, oldDir := loopbackRawFS(t, "old")
+	defer os.RemoveAll(oldDir)
+	newFS, newDir := loopbackRawFS(t, "new")
+	defer os.RemoveAll(newDir)
+
+	opts := &fuse.MountOptions{Debug: testutil.VerboseTest()}
+	oldSrv, err := fuse.NewServer(oldFS, mnt, opts)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	oldDone := make(chan struct{})
+	go func() {
+		oldSrv.Serve()
+		close(oldDone)
+	}()
+	if err := oldSrv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+
+	sock := filepath.Join(oldDir, "takeover.sock")
+	l, err := fuse.ListenForTakeover(sock, oldSrv)
+	if err != nil {
+		t.Fatalf("ListenForTakeover: %v", err)
+	}
+	defer l.Close()
+
+	// Nobody connects: the old server must keep serving.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	err = l.Accept(ctx)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Accept: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	// Only look at the root, whose node ID is the same in both
+	// file systems.
+	if _, err := os.Lstat(mnt); err != nil {
+		t.Fatalf("Lstat after cancelled Accept: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	acceptErr := make(chan error, 1)
+	go func() {
+		acceptErr <- l.Accept(ctx)
+	}()
+
+	// The new process fails after getting the device, but before
+	// acknowledging: the old server must resume.
+	badOpts := &fuse.MountOptions{Options: []string{"a,b"}}
+	if _, err := fuse.Takeover(ctx, sock, newFS, badOpts); err == nil {
+		t.Fatal("Takeover with bad options succeeded")
+	}
+	if err := <-acceptErr; err == nil {
+		t.Fatal("Accept succeeded without acknowledgement")
+	}
+	select {
+	case <-oldDone:
+		t.Fatal("old server stopped after failed takeover")
+	default:
+	}
+	if _, err := os.Lstat(mnt); err != nil {
+		t.Fatalf("Lstat after failed takeover: %v", err)
+	}
+
+	go func() {
+		acceptErr <- l.Accept(ctx)
+	}()
+
+	newSrv, err := fuse.Takeover(ctx, sock, newFS, opts)
+	if err != nil {
+		oldSrv.Unmount()
+		t.Fatalf("Takeover: %v", err)
+	}
+	go newSrv.Serve()
+	defer newSrv.Unmount()
+
+	if err := <-acceptErr; err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	select {
+	case <-oldDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("old server still serving after takeover")
+	}
+	if err := oldSrv.Unmount(); err != nil {
+		t.Errorf("Unmount after handover: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(mnt + "/file")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "new" {
+		t.Errorf("got %q, want %q", content, "new")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+type traceEvent struct {
+	info   fuse.RequestInfo
+	end    bool
+	status fuse.Status
+}
+
+type recordingTracer struct {
+	mu     sync.Mutex
+	events []traceEvent
+}
+
+func (t *recordingTracer) OnRequestStart(info fuse.RequestInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, traceEvent{info: info})
+}
+
+func (t *recordingTracer) OnRequestEnd(info fuse.RequestInfo, status fuse.Status, dt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, traceEvent{info: info, end: true, status: status})
+}
+
+func TestTracer(t *testing.T) {
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	rawFS, orig := loopbackRawFS(t, "hello")
+	defer os.RemoveAll(orig)
+
+	rec := &recordingTracer{}
+	filter, err := fuse.ParseTraceFilter("op=LOOKUP,READ", rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := fuse.NewServer(rawFS, mnt, &fuse.MountOptions{
+		Debug:  testutil.VerboseTest(),
+		Tracer: filter,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	if _, err := ioutil.ReadFile(mnt + "/file"); err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	started := map[uint64]bool{}
+	var lookup, read bool
+	for _, ev := range rec.events {
+		if ev.info.Op != "LOOKUP" && ev.info.Op != "READ" {
+			t.Errorf("filtered op %s was traced", ev.info.Op)
+		}
+		if !ev.end {
+			started[ev.info.Unique] = true
+			continue
+		}
+		if !started[ev.info.Unique] {
+			t.Errorf("end of %d without start", ev.info.Unique)
+		}
+		if ev.info.Op == "LOOKUP" && len(ev.info.Names) == 1 && ev.info.Names[0] == "file" {
+			lookup = true
+		}
+		if ev.info.Op == "READ" && ev.status.Ok() {
+			read = true
+			if want := 16 + len("hello"); ev.info.OutSize != want {
+				t.Errorf("READ reply has %d bytes, want %d", ev.info.OutSize, want)
+			}
+		}
+	}
+	if !lookup || !read {
+		t.Errorf("missing LOOKUP (%v) or READ (%v) in %v", lookup, read, rec.events)
+	}
+}
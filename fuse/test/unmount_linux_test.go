@@ -0,0 +1,133 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+func TestCleanStaleMount(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to mount")
+	}
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	// Closing the FUSE device without unmounting is what a
+	// crashing server does.
+	fd, err := syscall.Open("/dev/fuse", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("open /dev/fuse: %v", err)
+	}
+	err = syscall.Mount("stale", dir, "fuse.stale", syscall.MS_NOSUID|syscall.MS_NODEV,
+		fmt.Sprintf("fd=%d,rootmode=40000,user_id=0,group_id=0", fd))
+	syscall.Close(fd)
+	if err != nil {
+		t.Skipf("mount: %v", err)
+	}
+	defer syscall.Unmount(dir, syscall.MNT_DETACH)
+
+	if !fuse.IsStaleMount(dir) {
+		t.Fatalf("%s is not stale", dir)
+	}
+	if ok, err := fuse.CleanStaleMount(dir); !ok || err != nil {
+		t.Fatalf("CleanStaleMount: %v, %v", ok, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+	if ok, err := fuse.CleanStaleMount(dir); ok || err != nil {
+		t.Errorf("CleanStaleMount on a directory: %v, %v", ok, err)
+	}
+}
+
+func TestLazyUnmount(t *testing.T) {
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	rawFS, orig := loopbackRawFS(t, "hello")
+	defer os.RemoveAll(orig)
+
+	srv, err := fuse.NewServer(rawFS, mnt, &fuse.MountOptions{
+		Debug: testutil.VerboseTest(),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+
+	f, err := os.Open(mnt + "/file")
+	if err != nil {
+		srv.Unmount()
+		t.Fatalf("Open: %v", err)
+	}
+	if err := srv.UnmountLazy(); err != nil {
+		f.Close()
+		t.Fatalf("UnmountLazy: %v", err)
+	}
+	if _, err := os.Stat(mnt + "/file"); !os.IsNotExist(err) {
+		t.Errorf("mount is still there: %v", err)
+	}
+
+	// The open file is still served.
+	buf := make([]byte, 5)
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("Read: %q, %v", buf[:n], err)
+	}
+	f.Close()
+
+	done := make(chan struct{})
+	go func() {
+		srv.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Serve did not return after the last file was closed")
+	}
+}
+
+// TestAutoUnmountTakeover checks that a server mounted with
+// AutoUnmount cannot be handed over, as fusermount would unmount it
+// once the old process stops serving.
+func TestAutoUnmountTakeover(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+	mnt := dir + "/mnt"
+	os.Mkdir(mnt, 0755)
+
+	srv, err := fuse.NewServer(fuse.NewDefaultRawFileSystem(), mnt, &fuse.MountOptions{
+		AutoUnmount: true,
+		Debug:       testutil.VerboseTest(),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	l, err := fuse.ListenForTakeover(dir+"/takeover.sock", srv)
+	if err == nil {
+		l.Close()
+		t.Fatal("ListenForTakeover succeeded with AutoUnmount")
+	}
+	if !errors.Is(err, syscall.ENOTSUP) {
+		t.Errorf("got %v, want ENOTSUP", err)
+	}
+}
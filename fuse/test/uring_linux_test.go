@@ -0,0 +1,91 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hanwen/go-fuse/v2/internal/testutil"
+)
+
+func TestIOUringTransport(t *testing.T) {
+	mnt := testutil.TempDir()
+	defer os.RemoveAll(mnt)
+	rawFS, orig := loopbackRawFS(t, "hello")
+	defer os.RemoveAll(orig)
+
+	srv, err := fuse.NewServer(rawFS, mnt, &fuse.MountOptions{
+		Transport: fuse.IOUring,
+		Debug:     testutil.VerboseTest(),
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	if err := srv.WaitMount(); err != nil {
+		t.Fatalf("WaitMount: %v", err)
+	}
+	defer srv.Unmount()
+
+	uring := srv.NegotiatedCapabilities()&fuse.CAP_OVER_IO_URING != 0
+	if !uring {
+		t.Log("kernel does not support FUSE over io_uring; testing the fallback")
+	}
+
+	content, err := ioutil.ReadFile(mnt + "/file")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("got %q, want %q", content, "hello")
+	}
+
+	f, err := os.Create(mnt + "/new")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	const n = 100
+	for i := 0; i < n; i++ {
+		if _, err := f.WriteAt([]byte{byte(i)}, int64(i)); err != nil {
+			t.Fatalf("WriteAt: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	want := make([]byte, n)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	got, err := ioutil.ReadFile(orig + "/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	entries, err := ioutil.ReadDir(mnt)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(entries))
+	}
+
+	if uring {
+		var total uint64
+		for _, st := range srv.ChannelStats() {
+			total += st.Requests
+		}
+		if total >= n {
+			t.Errorf("read %d requests from the FUSE device, want most over io_uring", total)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// requestDeadlines maps the cancel channel of requests with a timeout
+// to their deadline. File systems build a Context from the cancel
+// channel passed to RawFileSystem, so this is how Context.Deadline
+// finds it.
+var requestDeadlines sync.Map
+
+// deadlineOf returns the deadline of the request with the given cancel
+// channel.
+func deadlineOf(cancel <-chan struct{}) (time.Time, bool) {
+	if cancel == nil {
+		return time.Time{}, false
+	}
+	d, ok := requestDeadlines.Load(cancel)
+	if !ok {
+		return time.Time{}, false
+	}
+	return d.(time.Time), true
+}
+
+// opcodeByName returns the opcode for an operation name, eg. "LOOKUP".
+func opcodeByName(name string) (uint32, bool) {
+	for op, h := range operationHandlers {
+		if h != nil && h.Name == name {
+			return uint32(op), true
+		}
+	}
+	return 0, false
+}
+
+// canTimeout tells if requests with opcode op can time out.
+func canTimeout(op uint32) bool {
+	switch op {
+	case _OP_FORGET, _OP_BATCH_FORGET, _OP_NOTIFY_REPLY, _OP_INTERRUPT,
+		_OP_INIT, _OP_DESTROY:
+		// No reply, or not for the file system to answer.
+		return false
+	}
+	return true
+}
+
+// setTimeouts fills ms.timeouts from MountOptions.RequestTimeout and
+// OpTimeouts.
+func (ms *Server) setTimeouts() error {
+	o := ms.opts
+	if o.RequestTimeout <= 0 && len(o.OpTimeouts) == 0 {
+		return nil
+	}
+	ms.timeouts = make([]time.Duration, _OPCODE_COUNT)
+	for op := range ms.timeouts {
+		// SETLKW waits for other processes to release the
+		// lock, for as long as it takes.
+		if canTimeout(uint32(op)) && uint32(op) != _OP_SETLKW {
+			ms.timeouts[op] = o.RequestTimeout
+		}
+	}
+	for name, d := range o.OpTimeouts {
+		op, ok := opcodeByName(strings.ToUpper(name))
+		if !ok {
+			return fmt.Errorf("OpTimeouts: unknown operation %q", name)
+		}
+		if !canTimeout(op) {
+			return fmt.Errorf("OpTimeouts: operation %s cannot time out", name)
+		}
+		ms.timeouts[op] = d
+	}
+	if o.TimeoutStatus == OK {
+		o.TimeoutStatus = EIO
+	}
+	return nil
+}
+
+// startTimeout arms the timeout of req, if its operation has one.
+func (ms *Server) startTimeout(req *request) {
+	if ms.timeouts == nil || req.inHeader.Opcode >= _OPCODE_COUNT {
+		return
+	}
+	d := ms.timeouts[req.inHeader.Opcode]
+	if d <= 0 {
+		return
+	}
+	requestDeadlines.Store((<-chan struct{})(req.cancel), req.startTime.Add(d))
+	unique := req.inHeader.Unique
+	req.timer = time.AfterFunc(d-time.Since(req.startTime), func() {
+		ms.requestTimedOut(req, unique)
+	})
+}
+
+// stopTimeout disarms the timeout of req before its reply is written.
+// It returns false if the request timed out, and its reply was sent
+// already.
+func (ms *Server) stopTimeout(req *request) bool {
+	if req.timer == nil {
+		return true
+	}
+	req.timer.Stop()
+	requestDeadlines.Delete((<-chan struct{})(req.cancel))
+
+	ms.reqMu.Lock()
+	defer ms.reqMu.Unlock()
+	if req.timedOut {
+		return false
+	}
+	req.replying = true
+	return true
+}
+
+// requestTimedOut answers req, which was read with the given unique
+// ID, with MountOptions.TimeoutStatus, unless the file system is
+// replying already. The handler is canceled like an interrupted
+// request, and its result is discarded.
+func (ms *Server) requestTimedOut(req *request, unique uint64) {
+	ms.reqMu.Lock()
+	// The request may have been answered and recycled meanwhile;
+	// only look at it if it is still in flight.
+	i := req.inflightIndex
+	if i >= len(ms.reqInflight) || ms.reqInflight[i] != req ||
+		req.inHeader.Unique != unique || req.replying || req.timedOut {
+		ms.reqMu.Unlock()
+		return
+	}
+	req.timedOut = true
+	if !req.interrupted {
+		close(req.cancel)
+		req.interrupted = true
+	}
+	// An interrupted request is not recycled, so its input stays
+	// valid.
+	header := *req.inHeader
+	reply := request{
+		inHeader:   &header,
+		inData:     req.inData,
+		handler:    req.handler,
+		status:     ms.opts.TimeoutStatus,
+		channel:    req.channel,
+		uringEntry: req.uringEntry,
+	}
+	ms.reqMu.Unlock()
+
+	log.Printf("request %d %s n%d timed out after %v, replying %v",
+		unique, operationName(header.Opcode), header.NodeId,
+		time.Since(req.startTime).Round(time.Millisecond), reply.status)
+	ms.writeMu.RLock()
+	if code := ms.write(&reply); !code.Ok() && ms.opts.Debug {
+		log.Printf("timeout reply for %d: %v", unique, code)
+	}
+	ms.writeMu.RUnlock()
+}
+
+// discardReply undoes the effects of a successful reply that is not
+// sent, because the request timed out: the kernel will not FORGET node
+// IDs or RELEASE file handles that it never saw.
+func (ms *Server) discardReply(req *request) {
+	if !req.status.Ok() {
+		return
+	}
+	fs := ms.fileSystem
+	release := func(node, fh uint64, flags uint32, dir bool) {
+		in := ReleaseIn{InHeader: *req.inHeader, Fh: fh, Flags: flags}
+		in.NodeId = node
+		if dir {
+			fs.ReleaseDir(&in)
+		} else {
+			fs.Release(nil, &in)
+		}
+	}
+	forget := func(out *EntryOut) {
+		if out.NodeId != 0 {
+			fs.Forget(out.NodeId, 1)
+		}
+	}
+
+	switch req.inHeader.Opcode {
+	case _OP_LOOKUP, _OP_MKDIR, _OP_MKNOD, _OP_SYMLINK, _OP_LINK:
+		forget((*EntryOut)(req.outData()))
+	case _OP_CREATE, _OP_TMPFILE:
+		out := (*CreateOut)(req.outData())
+		release(out.NodeId, out.Fh, (*CreateIn)(req.inData).Flags, false)
+		forget(&out.EntryOut)
+	case _OP_OPEN, _OP_OPENDIR:
+		out := (*OpenOut)(req.outData())
+		release(req.inHeader.NodeId, out.Fh, (*OpenIn)(req.inData).Flags,
+			req.inHeader.Opcode == _OP_OPENDIR)
+	case _OP_READDIRPLUS:
+		// See DirEntryList.AddDirLookupEntry for the layout.
+		const entryOutSize = int(unsafe.Sizeof(EntryOut{}))
+		buf := req.flatData
+		for len(buf) >= entryOutSize+direntSize {
+			d := (*_Dirent)(unsafe.Pointer(&buf[entryOutSize]))
+			n := entryOutSize + direntSize + int(d.NameLen)
+			if n > len(buf) {
+				break
+			}
+			// Like the kernel, ignore "." and "..".
+			if name := string(buf[n-int(d.NameLen) : n]); name != "." && name != ".." {
+				forget((*EntryOut)(unsafe.Pointer(&buf[0])))
+			}
+			n += (8 - n&7) & 7
+			if n > len(buf) {
+				break
+			}
+			buf = buf[n:]
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes a request for a Tracer.
+type RequestInfo struct {
+	Unique uint64
+	Opcode uint32
+
+	// Op is the name of the opcode, eg. "LOOKUP".
+	Op     string
+	NodeId uint64
+	Caller Caller
+
+	// Names has the file name arguments, eg. for LOOKUP and
+	// RENAME.
+	Names []string
+
+	// InSize is the size of the request, including WRITE data.
+	// OutSize is the size of the reply; it is only known in
+	// OnRequestEnd, and 0 for requests without a reply.
+	InSize  int
+	OutSize int
+}
+
+// Tracer is notified when the server starts and finishes processing
+// a request (see MountOptions.Tracer). It is called concurrently from
+// the goroutines serving requests, so it should be fast. Use
+// TraceFilter to select requests.
+type Tracer interface {
+	OnRequestStart(info RequestInfo)
+	OnRequestEnd(info RequestInfo, status Status, dt time.Duration)
+}
+
+func (r *request) info() RequestInfo {
+	return RequestInfo{
+		Unique: r.inHeader.Unique,
+		Opcode: r.inHeader.Opcode,
+		Op:     operationName(r.inHeader.Opcode),
+		NodeId: r.inHeader.NodeId,
+		Caller: r.inHeader.Caller,
+		Names:  r.filenames,
+		InSize: int(r.inHeader.Length),
+	}
+}
+
+// LogTracer logs a line for each finished request.
+type LogTracer struct {
+	// Logger is used for output. If nil, the standard logger is
+	// used.
+	Logger *log.Logger
+}
+
+func (t *LogTracer) OnRequestStart(info RequestInfo) {
+}
+
+func (t *LogTracer) OnRequestEnd(info RequestInfo, status Status, dt time.Duration) {
+	names := ""
+	if len(info.Names) > 0 {
+		names = fmt.Sprintf(" %q", info.Names)
+	}
+	msg := fmt.Sprintf("%d: %s n%d%s pid %d: %v, %db in, %db out, %v",
+		info.Unique, info.Op, info.NodeId, names, info.Caller.Pid,
+		status, info.InSize, info.OutSize, dt)
+	if t.Logger != nil {
+		t.Logger.Println(msg)
+	} else {
+		log.Println(msg)
+	}
+}
+
+// TraceFilter passes the requests that match all of its non-empty
+// criteria on to Tracer.
+type TraceFilter struct {
+	Tracer Tracer
+
+	// Ops has operation names, eg. "LOOKUP".
+	Ops     []string
+	NodeIds []uint64
+	Pids    []uint32
+}
+
+// ParseTraceFilter returns a filter for t from a specification like
+// "op=LOOKUP,GETATTR node=1 pid=123,456", so the selection can come
+// from a flag or the environment. Operation names are case
+// insensitive. An empty spec selects all requests.
+func ParseTraceFilter(spec string, t Tracer) (*TraceFilter, error) {
+	f := &TraceFilter{Tracer: t}
+	for _, field := range strings.Fields(spec) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("trace filter %q: want key=value", field)
+		}
+		for _, v := range strings.Split(kv[1], ",") {
+			switch kv[0] {
+			case "op":
+				f.Ops = append(f.Ops, strings.ToUpper(v))
+			case "node":
+				id, err := strconv.ParseUint(v, 0, 64)
+				if err != nil {
+					return nil, fmt.Errorf("trace filter %q: %v", field, err)
+				}
+				f.NodeIds = append(f.NodeIds, id)
+			case "pid":
+				pid, err := strconv.ParseUint(v, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("trace filter %q: %v", field, err)
+				}
+				f.Pids = append(f.Pids, uint32(pid))
+			default:
+				return nil, fmt.Errorf("trace filter %q: unknown key %q", field, kv[0])
+			}
+		}
+	}
+	return f, nil
+}
+
+// Match tells if info passes the filter.
+func (f *TraceFilter) Match(info *RequestInfo) bool {
+	if len(f.Ops) > 0 {
+		found := false
+		for _, op := range f.Ops {
+			if op == info.Op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.NodeIds) > 0 {
+		found := false
+		for _, id := range f.NodeIds {
+			if id == info.NodeId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Pids) > 0 {
+		found := false
+		for _, pid := range f.Pids {
+			if pid == info.Caller.Pid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *TraceFilter) OnRequestStart(info RequestInfo) {
+	if f.Match(&info) {
+		f.Tracer.OnRequestStart(info)
+	}
+}
+
+func (f *TraceFilter) OnRequestEnd(info RequestInfo, status Status, dt time.Duration) {
+	if f.Match(&info) {
+		f.Tracer.OnRequestEnd(info, status, dt)
+	}
+}
+
+// opLabels has a context with the pprof label "fuse_op" for each
+// opcode, so handleRequest can label goroutines without allocating.
+var opLabels [_OPCODE_COUNT]context.Context
+
+func init() {
+	for op := range opLabels {
+		opLabels[op] = pprof.WithLabels(context.Background(),
+			pprof.Labels("fuse_op", operationName(uint32(op))))
+	}
+}
+
+// setProfileLabel labels the current goroutine with the operation of
+// opcode in CPU profiles, until clearProfileLabel is called.
+func setProfileLabel(opcode uint32) {
+	if opcode < _OPCODE_COUNT {
+		pprof.SetGoroutineLabels(opLabels[opcode])
+	}
+}
+
+func clearProfileLabel() {
+	pprof.SetGoroutineLabels(context.Background())
+}
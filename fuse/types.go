@@ -256,12 +256,17 @@ const (
 	FOPEN_NONSEEKABLE = (1 << 2)
 	FOPEN_CACHE_DIR   = (1 << 3)
 	FOPEN_STREAM      = (1 << 4)
+
+	// FOPEN_PASSTHROUGH makes the kernel do reads and writes
+	// directly on the backing file OpenOut.BackingId. See
+	// Server.RegisterBackingFd.
+	FOPEN_PASSTHROUGH = (1 << 7)
 )
 
 type OpenOut struct {
 	Fh        uint64
 	OpenFlags uint32
-	Padding   uint32
+	BackingId int32
 }
 
 // To be set in InitIn/InitOut.Flags.
@@ -308,6 +313,34 @@ type InitIn struct {
 	Minor        uint32
 	MaxReadAhead uint32
 	Flags        uint32
+
+	// The fields below are only sent by kernels that set
+	// CAP_INIT_EXT in Flags (protocol 7.36 and later).
+	Flags2 uint32
+	Unused [11]uint32
+}
+
+// InitFlags is the full set of capability flags exchanged in the
+// INIT handshake. The lower 32 bits are carried in the Flags field of
+// InitIn/InitOut, and the upper 32 bits in Flags2.
+type InitFlags uint64
+
+// Has returns true if all of the flags in caps are set.
+func (f InitFlags) Has(caps InitFlags) bool {
+	return f&caps == caps
+}
+
+func (f InitFlags) String() string {
+	return flagString(initFlagNames, int64(f), "")
+}
+
+// InitFlags returns the combined Flags and Flags2 words.
+func (in *InitIn) InitFlags() InitFlags {
+	f := InitFlags(in.Flags)
+	if in.Flags&CAP_INIT_EXT != 0 {
+		f |= InitFlags(in.Flags2) << 32
+	}
+	return f
 }
 
 type InitOut struct {
@@ -321,7 +354,29 @@ type InitOut struct {
 	TimeGran            uint32
 	MaxPages            uint16
 	Padding             uint16
-	Unused              [8]uint32
+	Flags2              uint32
+	MaxStackDepth       uint32
+	Unused              [6]uint32
+}
+
+// InitFlags returns the combined Flags and Flags2 words.
+func (o *InitOut) InitFlags() InitFlags {
+	f := InitFlags(o.Flags)
+	if o.Flags&CAP_INIT_EXT != 0 {
+		f |= InitFlags(o.Flags2) << 32
+	}
+	return f
+}
+
+// setInitFlags splits f into the Flags and Flags2 words. The
+// kernel only reads Flags2 if CAP_INIT_EXT is set, so that bit is
+// added if needed.
+func (o *InitOut) setInitFlags(f InitFlags) {
+	o.Flags = uint32(f)
+	o.Flags2 = uint32(f >> 32)
+	if o.Flags2 != 0 {
+		o.Flags |= CAP_INIT_EXT
+	}
 }
 
 type _CuseInitIn struct {
@@ -383,20 +438,37 @@ type IoctlOut struct {
 	OutIovs uint32
 }
 
-type _PollIn struct {
+// Poll events, as used in PollIn.Events and PollOut.Revents. The
+// FUSE protocol uses the Linux values.
+const (
+	POLLIN     = 0x1
+	POLLPRI    = 0x2
+	POLLOUT    = 0x4
+	POLLERR    = 0x8
+	POLLHUP    = 0x10
+	POLLNVAL   = 0x20
+	POLLRDNORM = 0x40
+	POLLWRNORM = 0x100
+)
+
+type PollIn struct {
 	InHeader
-	Fh      uint64
-	Kh      uint64
-	Flags   uint32
-	Padding uint32
+	Fh uint64
+
+	// Kh is the poll handle. Pass it to Server.PollNotify to
+	// wake up the waiting process, if Flags has
+	// FUSE_POLL_SCHEDULE_NOTIFY set.
+	Kh     uint64
+	Flags  uint32
+	Events uint32
 }
 
-type _PollOut struct {
+type PollOut struct {
 	Revents uint32
 	Padding uint32
 }
 
-type _NotifyPollWakeupOut struct {
+type NotifyPollWakeupOut struct {
 	Kh uint64
 }
 
@@ -502,14 +574,15 @@ type NotifyRetrieveIn struct {
 }
 
 const (
-	//	NOTIFY_POLL         = -1 // notify kernel that a poll waiting for IO on a file handle should wake up
+	NOTIFY_POLL           = -1 // notify kernel that a poll waiting for IO on a file handle should wake up
 	NOTIFY_INVAL_INODE    = -2 // notify kernel that an inode should be invalidated
 	NOTIFY_INVAL_ENTRY    = -3 // notify kernel that a directory entry should be invalidated
 	NOTIFY_STORE_CACHE    = -4 // store data into kernel cache of an inode
 	NOTIFY_RETRIEVE_CACHE = -5 // retrieve data from kernel cache of an inode
 	NOTIFY_DELETE         = -6 // notify kernel that a directory entry has been deleted
+	NOTIFY_RESEND         = -7 // ask the kernel to queue all unanswered requests again
 
-//	NOTIFY_CODE_MAX     = -6
+//	NOTIFY_CODE_MAX     = -7
 )
 
 type FlushIn struct {
@@ -520,6 +593,11 @@ type FlushIn struct {
 	LockOwner uint64
 }
 
+type SyncFsIn struct {
+	InHeader
+	Padding uint64
+}
+
 type LseekIn struct {
 	InHeader
 	Fh      uint64
@@ -595,6 +673,71 @@ func (o *AttrOut) SetTimeout(dt time.Duration) {
 	o.AttrValid = uint64(ns / 1e9)
 }
 
+// SxTime is a timestamp in Statx.
+type SxTime struct {
+	Sec     uint64
+	Nsec    uint32
+	Padding uint32
+}
+
+// Statx holds extended file attributes, as in struct statx from
+// statx(2). Mask says which fields are filled in.
+type Statx struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	Padding        uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          SxTime
+	Btime          SxTime
+	Ctime          SxTime
+	Mtime          SxTime
+	RdevMajor      uint32
+	RdevMinor      uint32
+	DevMajor       uint32
+	DevMinor       uint32
+	Spare          [14]uint64
+}
+
+type StatxIn struct {
+	InHeader
+
+	// GetattrFlags has FUSE_GETATTR_FH if Fh is set.
+	GetattrFlags uint32
+	Reserved     uint32
+	Fh           uint64
+
+	// SxFlags has the AT_STATX_* sync flags, and SxMask the
+	// STATX_* fields the caller asked for.
+	SxFlags uint32
+	SxMask  uint32
+}
+
+type StatxOut struct {
+	AttrValid     uint64
+	AttrValidNsec uint32
+	Flags         uint32
+	Spare         [2]uint64
+	Statx
+}
+
+func (o *StatxOut) Timeout() time.Duration {
+	return time.Duration(uint64(o.AttrValidNsec) + o.AttrValid*1e9)
+}
+
+func (o *StatxOut) SetTimeout(dt time.Duration) {
+	ns := int64(dt)
+	o.AttrValidNsec = uint32(ns % 1e9)
+	o.AttrValid = uint64(ns / 1e9)
+}
+
 type CreateOut struct {
 	EntryOut
 	OpenOut
@@ -129,6 +129,14 @@ const (
 	CAP_CASE_INSENSITIVE = (1 << 29)
 	CAP_VOL_RENAME       = (1 << 30)
 	CAP_XTIMES           = (1 << 31)
+
+	// OSXFUSE uses bit 30 for CAP_VOL_RENAME, and has no
+	// extended init flags.
+	CAP_INIT_EXT    = 0
+	CAP_PASSTHROUGH = 0
+	CAP_HAS_RESEND  = 0
+
+	CAP_OVER_IO_URING = 0
 )
 
 type GetxtimesOut struct {
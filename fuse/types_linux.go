@@ -15,6 +15,30 @@ const (
 	EREMOTEIO = Status(syscall.EREMOTEIO)
 )
 
+// Capability flags that only exist on Linux. The ones from
+// CAP_SECURITY_CTX upwards do not fit in InitIn.Flags, and must be
+// used with InitFlags.
+const (
+	CAP_MAP_ALIGNMENT      = (1 << 26)
+	CAP_SUBMOUNTS          = (1 << 27)
+	CAP_HANDLE_KILLPRIV_V2 = (1 << 28)
+	CAP_SETXATTR_EXT       = (1 << 29)
+	CAP_INIT_EXT           = (1 << 30)
+	CAP_INIT_RESERVED      = (1 << 31)
+
+	CAP_SECURITY_CTX         = (1 << 32)
+	CAP_HAS_INODE_DAX        = (1 << 33)
+	CAP_CREATE_SUPP_GROUP    = (1 << 34)
+	CAP_HAS_EXPIRE_ONLY      = (1 << 35)
+	CAP_DIRECT_IO_ALLOW_MMAP = (1 << 36)
+	CAP_PASSTHROUGH          = (1 << 37)
+	CAP_NO_EXPORT_SUPPORT    = (1 << 38)
+	CAP_HAS_RESEND           = (1 << 39)
+	CAP_ALLOW_IDMAP          = (1 << 40)
+	CAP_OVER_IO_URING        = (1 << 41)
+	CAP_REQUEST_TIMEOUT      = (1 << 42)
+)
+
 type Attr struct {
 	Ino  uint64
 	Size uint64
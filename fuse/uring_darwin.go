@@ -0,0 +1,17 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import "syscall"
+
+type uringTransport struct{}
+
+type uringEntry struct{}
+
+func (ms *Server) startURing() error {
+	return syscall.ENOSYS
+}
+
+func (t *uringTransport) stop() {}
@@ -0,0 +1,695 @@
+// Copyright 2026 the Go-FUSE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// This file implements the FUSE-over-io_uring transport (see
+// Documentation/filesystems/fuse-io-uring.rst in the kernel). Each
+// CPU has a queue of entries; an entry is a pair of buffers that the
+// kernel fills with a request. The reply is written into the same
+// buffers, and committed together with the fetch of the next request.
+
+const (
+	_SYS_IO_URING_SETUP = 425
+	_SYS_IO_URING_ENTER = 426
+
+	_IORING_SETUP_SQE128    = 1 << 10
+	_IORING_ENTER_GETEVENTS = 1
+
+	_IORING_OFF_SQ_RING = 0
+	_IORING_OFF_CQ_RING = 0x8000000
+	_IORING_OFF_SQES    = 0x10000000
+
+	_IORING_OP_READ      = 22
+	_IORING_OP_URING_CMD = 46
+
+	_FUSE_IO_URING_CMD_REGISTER         = 1
+	_FUSE_IO_URING_CMD_COMMIT_AND_FETCH = 2
+
+	// Layout of struct fuse_uring_req_header.
+	uringInOutSize  = 128
+	uringOpInSize   = 128
+	uringHeaderSize = uringInOutSize + uringOpInSize + 32
+
+	// uringQueueDepth is the number of requests that can be in
+	// flight on a queue.
+	uringQueueDepth = 8
+
+	// uringWakeup is the user data of the read on the eventfd
+	// that wakes up a queue.
+	uringWakeup = ^uint64(0)
+)
+
+// ioURingParams is struct io_uring_params.
+type ioURingParams struct {
+	SqEntries    uint32
+	CqEntries    uint32
+	Flags        uint32
+	SqThreadCPU  uint32
+	SqThreadIdle uint32
+	Features     uint32
+	WqFd         uint32
+	Resv         [3]uint32
+	SqOff        ioSqringOffsets
+	CqOff        ioCqringOffsets
+}
+
+type ioSqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Flags       uint32
+	Dropped     uint32
+	Array       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+type ioCqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Overflow    uint32
+	Cqes        uint32
+	Flags       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+// ioURingSQE is a 128-byte struct io_uring_sqe, as used with
+// IORING_SETUP_SQE128. Only the fields for READ and URING_CMD are
+// named.
+type ioURingSQE struct {
+	Opcode      uint8
+	Flags       uint8
+	Ioprio      uint16
+	Fd          int32
+	CmdOp       uint32
+	Pad1        uint32
+	Addr        uint64
+	Len         uint32
+	OpFlags     uint32
+	UserData    uint64
+	BufIndex    uint16
+	Personality uint16
+	SpliceFdIn  int32
+	Cmd         [80]byte
+}
+
+// ioURingCQE is struct io_uring_cqe.
+type ioURingCQE struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// uringEntInOut is struct fuse_uring_ent_in_out.
+type uringEntInOut struct {
+	Flags     uint64
+	CommitID  uint64
+	PayloadSz uint32
+	Padding   uint32
+	Reserved  uint64
+}
+
+// uringCmdReq is struct fuse_uring_cmd_req, which goes in the
+// command area of the SQE.
+type uringCmdReq struct {
+	Flags    uint64
+	CommitID uint64
+	Qid      uint16
+	Padding  [6]uint8
+}
+
+// ioURing is an io_uring instance. It is used from a single thread.
+type ioURing struct {
+	fd int
+
+	sqRing, cqRing, sqeMem []byte
+
+	sqHead, sqTail *uint32
+	sqMask         uint32
+	sqEntries      uint32
+	sqArray        []uint32
+	sqes           []ioURingSQE
+
+	cqHead, cqTail *uint32
+	cqMask         uint32
+	cqes           []ioURingCQE
+}
+
+func newIOURing(entries uint32) (*ioURing, error) {
+	var p ioURingParams
+	p.Flags = _IORING_SETUP_SQE128
+	fd, _, errno := syscall.Syscall(_SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	r := &ioURing{fd: int(fd)}
+	mmap := func(off int64, size int) ([]byte, error) {
+		return syscall.Mmap(r.fd, off, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	}
+
+	var err error
+	if r.sqRing, err = mmap(_IORING_OFF_SQ_RING, int(p.SqOff.Array+p.SqEntries*4)); err != nil {
+		r.close()
+		return nil, err
+	}
+	cqeSize := uint32(unsafe.Sizeof(ioURingCQE{}))
+	if r.cqRing, err = mmap(_IORING_OFF_CQ_RING, int(p.CqOff.Cqes+p.CqEntries*cqeSize)); err != nil {
+		r.close()
+		return nil, err
+	}
+	sqeSize := int(unsafe.Sizeof(ioURingSQE{}))
+	if r.sqeMem, err = mmap(_IORING_OFF_SQES, int(p.SqEntries)*sqeSize); err != nil {
+		r.close()
+		return nil, err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[p.SqOff.Head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.SqOff.Tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.SqOff.RingMask]))
+	r.sqEntries = p.SqEntries
+	r.sqArray = (*[1 << 16]uint32)(unsafe.Pointer(&r.sqRing[p.SqOff.Array]))[:p.SqEntries:p.SqEntries]
+	r.sqes = (*[1 << 16]ioURingSQE)(unsafe.Pointer(&r.sqeMem[0]))[:p.SqEntries:p.SqEntries]
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.CqOff.Head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.CqOff.Tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.CqOff.RingMask]))
+	r.cqes = (*[1 << 16]ioURingCQE)(unsafe.Pointer(&r.cqRing[p.CqOff.Cqes]))[:p.CqEntries:p.CqEntries]
+	return r, nil
+}
+
+func (r *ioURing) close() {
+	for _, m := range [][]byte{r.sqeMem, r.cqRing, r.sqRing} {
+		if m != nil {
+			syscall.Munmap(m)
+		}
+	}
+	syscall.Close(r.fd)
+}
+
+// push queues an SQE, filled in by fill, for the next call to enter.
+func (r *ioURing) push(fill func(sqe *ioURingSQE)) error {
+	tail := *r.sqTail
+	if tail-atomic.LoadUint32(r.sqHead) >= r.sqEntries {
+		return syscall.EBUSY
+	}
+	idx := tail & r.sqMask
+	sqe := &r.sqes[idx]
+	*sqe = ioURingSQE{}
+	fill(sqe)
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	return nil
+}
+
+// enter submits the queued SQEs, and waits for at least minComplete
+// completions.
+func (r *ioURing) enter(minComplete uint32) error {
+	return handleEINTR(func() error {
+		toSubmit := *r.sqTail - atomic.LoadUint32(r.sqHead)
+		_, _, errno := syscall.Syscall6(_SYS_IO_URING_ENTER, uintptr(r.fd),
+			uintptr(toSubmit), uintptr(minComplete), _IORING_ENTER_GETEVENTS, 0, 0)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+// reap appends the available completions to dst.
+func (r *ioURing) reap(dst []ioURingCQE) []ioURingCQE {
+	head := *r.cqHead
+	for tail := atomic.LoadUint32(r.cqTail); head != tail; head++ {
+		dst = append(dst, r.cqes[head&r.cqMask])
+	}
+	atomic.StoreUint32(r.cqHead, head)
+	return dst
+}
+
+// uringTransport has the queues of a server using io_uring.
+type uringTransport struct {
+	queues []*uringQueue
+
+	// wg counts the queue goroutines and the requests being
+	// processed, which use the queues' memory.
+	wg sync.WaitGroup
+}
+
+// uringQueue serves the requests of one CPU.
+//
+// The kernel hands a request to an entry through task work on the
+// thread that submitted the entry. If that thread blocked on a request
+// to the mount, e.g. because the file system accesses its own mount,
+// the request would never be delivered. Therefore, all submissions
+// happen on a thread that is locked to the queue's goroutine, and
+// request handlers pass their replies to it.
+type uringQueue struct {
+	ms   *Server
+	t    *uringTransport
+	qid  uint16
+	ring *ioURing
+
+	// Memory backing the entries.
+	headers, payloads []byte
+
+	entries []uringEntry
+
+	// efd is an eventfd that wakes up the queue, which always
+	// has a read on it pending.
+	efd    int
+	efdBuf [8]byte
+
+	mu sync.Mutex
+
+	// commits are the entries that have a reply ready.
+	commits []*uringEntry
+
+	// sleeping is set if the queue waits for completions, and
+	// must be woken up for new commits.
+	sleeping bool
+	stopping bool
+}
+
+// uringEntry is a request slot that the kernel fills in.
+type uringEntry struct {
+	q   *uringQueue
+	idx uint64
+
+	header  []byte
+	payload []byte
+	iov     [2]syscall.Iovec
+
+	// commitID identifies the request in the reply.
+	commitID uint64
+}
+
+// uringPossibleCPUs returns the number of queues the kernel expects:
+// one per possible CPU.
+func uringPossibleCPUs() int {
+	data, err := ioutil.ReadFile("/sys/devices/system/cpu/possible")
+	if err != nil {
+		return runtime.NumCPU()
+	}
+	n := 0
+	for _, r := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		lo, hi := r, r
+		if i := strings.Index(r, "-"); i >= 0 {
+			lo, hi = r[:i], r[i+1:]
+		}
+		l, err1 := strconv.Atoi(lo)
+		h, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil {
+			return runtime.NumCPU()
+		}
+		n += h - l + 1
+	}
+	return n
+}
+
+// startURing registers request buffers for every CPU with the
+// kernel. Once all queues are registered, the kernel sends requests
+// over io_uring rather than the FUSE device.
+func (ms *Server) startURing() error {
+	pageSize := syscall.Getpagesize()
+	maxPages := (ms.opts.MaxWrite-1)/pageSize + 1
+	if maxPages < _FUSE_DEFAULT_MAX_PAGES_PER_REQ {
+		maxPages = _FUSE_DEFAULT_MAX_PAGES_PER_REQ
+	}
+	payloadSize := maxPages * pageSize
+
+	t := &uringTransport{}
+	for qid := 0; qid < uringPossibleCPUs(); qid++ {
+		q, err := newURingQueue(ms, t, uint16(qid), payloadSize)
+		if err != nil {
+			t.close()
+			return err
+		}
+		t.queues = append(t.queues, q)
+	}
+	for _, q := range t.queues {
+		ready := make(chan error, 1)
+		t.wg.Add(1)
+		go q.serve(ready)
+		if err := <-ready; err != nil {
+			t.stop()
+			return err
+		}
+	}
+
+	ms.reqMu.Lock()
+	ms.uring = t
+	ms.reqMu.Unlock()
+	return nil
+}
+
+func newURingQueue(ms *Server, t *uringTransport, qid uint16, payloadSize int) (*uringQueue, error) {
+	ring, err := newIOURing(2 * uringQueueDepth)
+	if err != nil {
+		return nil, fmt.Errorf("io_uring_setup: %v", err)
+	}
+	q := &uringQueue{ms: ms, t: t, qid: qid, ring: ring, efd: -1}
+
+	efd, _, errno := syscall.Syscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		q.close()
+		return nil, errno
+	}
+	q.efd = int(efd)
+
+	anon := func(size int) ([]byte, error) {
+		return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS)
+	}
+	if q.headers, err = anon(uringQueueDepth * uringHeaderSize); err != nil {
+		q.close()
+		return nil, err
+	}
+	if q.payloads, err = anon(uringQueueDepth * payloadSize); err != nil {
+		q.close()
+		return nil, err
+	}
+
+	q.entries = make([]uringEntry, uringQueueDepth)
+	for i := range q.entries {
+		e := &q.entries[i]
+		e.q = q
+		e.idx = uint64(i)
+		e.header = q.headers[i*uringHeaderSize : (i+1)*uringHeaderSize]
+		e.payload = q.payloads[i*payloadSize : (i+1)*payloadSize]
+		e.iov[0].Base = &e.header[0]
+		e.iov[0].SetLen(len(e.header))
+		e.iov[1].Base = &e.payload[0]
+		e.iov[1].SetLen(len(e.payload))
+	}
+	return q, nil
+}
+
+func (q *uringQueue) close() {
+	if q.headers != nil {
+		syscall.Munmap(q.headers)
+	}
+	if q.payloads != nil {
+		syscall.Munmap(q.payloads)
+	}
+	if q.efd >= 0 {
+		syscall.Close(q.efd)
+	}
+	q.ring.close()
+}
+
+// stop wakes up the queues, and releases their resources once they
+// exit and all requests are answered.
+func (t *uringTransport) stop() {
+	for _, q := range t.queues {
+		q.mu.Lock()
+		q.stopping = true
+		q.mu.Unlock()
+		q.wakeup()
+	}
+	t.wg.Wait()
+	t.close()
+}
+
+func (t *uringTransport) close() {
+	for _, q := range t.queues {
+		q.close()
+	}
+	t.queues = nil
+}
+
+func (q *uringQueue) wakeup() {
+	var one [8]byte
+	*(*uint64)(unsafe.Pointer(&one[0])) = 1
+	syscall.Write(q.efd, one[:])
+}
+
+// armWakeup queues a read on the eventfd.
+func (q *uringQueue) armWakeup() error {
+	return q.ring.push(func(sqe *ioURingSQE) {
+		sqe.Opcode = _IORING_OP_READ
+		sqe.Fd = int32(q.efd)
+		sqe.Addr = uint64(uintptr(unsafe.Pointer(&q.efdBuf[0])))
+		sqe.Len = uint32(len(q.efdBuf))
+		sqe.UserData = uringWakeup
+	})
+}
+
+// commit hands a reply to the queue's thread.
+func (q *uringQueue) commit(e *uringEntry) {
+	q.mu.Lock()
+	q.commits = append(q.commits, e)
+	wake := q.sleeping
+	q.sleeping = false
+	q.mu.Unlock()
+	if wake {
+		q.wakeup()
+	}
+}
+
+// serve registers the queue's entries, and dispatches the requests
+// that the kernel puts in them. It returns when the queue is stopped,
+// or all entries were released by the kernel, e.g. on unmount.
+func (q *uringQueue) serve(ready chan<- error) {
+	defer q.t.wg.Done()
+
+	// The thread exits with the goroutine, so the kernel does not
+	// queue task work for it anymore.
+	runtime.LockOSThread()
+
+	err := q.armWakeup()
+	for i := 0; err == nil && i < len(q.entries); i++ {
+		err = q.entries[i].register()
+	}
+	if err == nil {
+		err = q.ring.enter(0)
+	}
+	ready <- err
+	if err != nil {
+		return
+	}
+
+	live := len(q.entries)
+	var cqes []ioURingCQE
+	var batch []*uringEntry
+	for live > 0 {
+		q.mu.Lock()
+		if q.stopping {
+			q.mu.Unlock()
+			return
+		}
+		batch, q.commits = q.commits, batch[:0]
+		q.sleeping = len(batch) == 0
+		q.mu.Unlock()
+
+		for _, e := range batch {
+			if err := e.commitAndFetch(); err != nil {
+				log.Printf("io_uring queue %d: commit: %v", q.qid, err)
+			}
+		}
+		var minComplete uint32
+		if len(batch) == 0 {
+			minComplete = 1
+		}
+		if err := q.ring.enter(minComplete); err != nil {
+			log.Printf("io_uring queue %d: %v", q.qid, err)
+			return
+		}
+
+		cqes = q.ring.reap(cqes[:0])
+		for _, c := range cqes {
+			if c.UserData == uringWakeup {
+				if c.Res < 0 {
+					log.Printf("io_uring queue %d: read eventfd: %v", q.qid, syscall.Errno(-c.Res))
+					return
+				}
+				q.armWakeup()
+				continue
+			}
+			if c.Res < 0 {
+				// The entry is not used anymore.
+				live--
+				errno := syscall.Errno(-c.Res)
+				if q.ms.opts.Debug || errno != syscall.ENOTCONN && errno != syscall.ECANCELED {
+					log.Printf("io_uring queue %d: entry %d: %v", q.qid, c.UserData, errno)
+				}
+				continue
+			}
+			q.ms.handleURingEntry(&q.entries[c.UserData])
+		}
+	}
+}
+
+// handleURingEntry copies the request in e to a buffer laid out as if
+// it were read from the FUSE device, and starts processing it.
+func (ms *Server) handleURingEntry(e *uringEntry) {
+	dest := ms.readPool.Get().([]byte)
+	n, code := e.copyRequest(dest)
+	if !code.Ok() {
+		ms.readPool.Put(dest)
+		log.Printf("io_uring queue %d: bad request: %v", e.q.qid, code)
+		e.reply(code)
+		return
+	}
+
+	req := ms.reqPool.Get().(*request)
+	req.uringEntry = e
+	req.startTime = time.Now()
+	gobbled := req.setInput(dest[:n])
+	if !gobbled {
+		ms.readPool.Put(dest)
+	}
+
+	ms.reqMu.Lock()
+	req.parseHeader()
+	ms.addInflight(req)
+	ms.reqMu.Unlock()
+
+	e.q.t.wg.Add(1)
+	if ms.serveSelfAccess(req, e.q.t.wg.Done) || ms.schedule(req, e.q.t.wg.Done) {
+		return
+	}
+	go func() {
+		ms.handleRequest(req)
+		e.q.t.wg.Done()
+	}()
+}
+
+var sizeOfInHeader = int(unsafe.Sizeof(InHeader{}))
+
+// copyRequest puts the request header, the per-op header and the
+// payload of e consecutively in dest.
+func (e *uringEntry) copyRequest(dest []byte) (int, Status) {
+	inOut := (*uringEntInOut)(unsafe.Pointer(&e.header[uringInOutSize+uringOpInSize]))
+	e.commitID = inOut.CommitID
+	in := (*InHeader)(unsafe.Pointer(&e.header[0]))
+
+	opSize := 0
+	if h := getHandler(in.Opcode); h != nil && int(h.InputSize) > sizeOfInHeader {
+		opSize = int(h.InputSize) - sizeOfInHeader
+	}
+	payloadSize := int(inOut.PayloadSz)
+	total := sizeOfInHeader + opSize + payloadSize
+	if opSize > uringOpInSize || payloadSize > len(e.payload) || total > len(dest) {
+		return 0, EIO
+	}
+
+	opIn := e.header[uringInOutSize : uringInOutSize+uringOpInSize]
+	copy(dest, e.header[:sizeOfInHeader])
+	copy(dest[sizeOfInHeader:], opIn[:opSize])
+	copy(dest[sizeOfInHeader+opSize:], e.payload[:payloadSize])
+	(*InHeader)(unsafe.Pointer(&dest[0])).Length = uint32(total)
+
+	// The kernel only writes the op header if there is one, so
+	// don't leave stale data for the next request.
+	for i := range opIn {
+		opIn[i] = 0
+	}
+	return total, OK
+}
+
+func (e *uringEntry) register() error {
+	return e.q.ring.push(func(sqe *ioURingSQE) {
+		sqe.Opcode = _IORING_OP_URING_CMD
+		sqe.Fd = int32(e.q.ms.mountFd)
+		sqe.CmdOp = _FUSE_IO_URING_CMD_REGISTER
+		sqe.Addr = uint64(uintptr(unsafe.Pointer(&e.iov[0])))
+		sqe.Len = uint32(len(e.iov))
+		sqe.UserData = e.idx
+		cmd := (*uringCmdReq)(unsafe.Pointer(&sqe.Cmd[0]))
+		cmd.Qid = e.q.qid
+	})
+}
+
+// commitAndFetch queues the reply in e, and makes e available for the
+// next request.
+func (e *uringEntry) commitAndFetch() error {
+	return e.q.ring.push(func(sqe *ioURingSQE) {
+		sqe.Opcode = _IORING_OP_URING_CMD
+		sqe.Fd = int32(e.q.ms.mountFd)
+		sqe.CmdOp = _FUSE_IO_URING_CMD_COMMIT_AND_FETCH
+		sqe.UserData = e.idx
+		cmd := (*uringCmdReq)(unsafe.Pointer(&sqe.Cmd[0]))
+		cmd.CommitID = e.commitID
+		cmd.Qid = e.q.qid
+	})
+}
+
+// setPayloadSize records the size of the reply payload.
+func (e *uringEntry) setPayloadSize(n int) {
+	inOut := (*uringEntInOut)(unsafe.Pointer(&e.header[uringInOutSize+uringOpInSize]))
+	inOut.PayloadSz = uint32(n)
+}
+
+// reply answers the request in e with an error. It is called on the
+// queue's thread.
+func (e *uringEntry) reply(code Status) {
+	in := (*InHeader)(unsafe.Pointer(&e.header[0]))
+	o := (*OutHeader)(unsafe.Pointer(&e.header[0]))
+	*o = OutHeader{
+		Length: uint32(sizeOfOutHeader),
+		Status: -int32(code),
+		Unique: in.Unique,
+	}
+	e.setPayloadSize(0)
+	e.q.commit(e)
+}
+
+// uringWrite puts the reply to req in its entry and commits it.
+func (ms *Server) uringWrite(req *request, header []byte) Status {
+	e := req.uringEntry
+	out := e.payload
+
+	var n int
+	if req.fdData != nil || req.funcData != nil {
+		// READ has no per-op reply header, so the data can be
+		// produced straight into the payload.
+		data, st := req.readResult.Bytes(out)
+		req.status = Status(st)
+		header = req.serializeHeader(len(data))
+		if req.status.Ok() {
+			n = len(data)
+		}
+	} else {
+		n = copy(out, header[sizeOfOutHeader:])
+		if req.slices != nil {
+			for _, s := range req.slices {
+				n += copy(out[n:], s)
+			}
+		} else {
+			n += copy(out[n:], req.flatData)
+		}
+	}
+	if req.readResult != nil {
+		req.readResult.Done()
+	}
+
+	o := (*OutHeader)(unsafe.Pointer(&header[0]))
+	if int(o.Length) != int(sizeOfOutHeader)+n {
+		// The reply does not fit in the payload buffer.
+		o.Status = -int32(EIO)
+		o.Length = uint32(sizeOfOutHeader)
+		n = 0
+	}
+	copy(e.header[:sizeOfOutHeader], header)
+	e.setPayloadSize(n)
+	e.q.commit(e)
+	return OK
+}